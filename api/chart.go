@@ -0,0 +1,51 @@
+package api
+
+import (
+	"sample/common/model"
+	"sample/common/response"
+	"sample/common/util"
+	"sample/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Chart struct {
+	chartService service.IChartService
+}
+
+func APIChartHandler(r *gin.Engine, chartService service.IChartService) {
+	handler := &Chart{
+		chartService: chartService,
+	}
+	Group := r.Group("v1/charts")
+	{
+		Group.GET("", handler.GetChart)
+	}
+}
+
+// GetChart godoc
+// @Summary Get chart
+// @Description Rank tracks, artists or genres by their counted plays of the last day, week or month
+// @Tags chart
+// @Id get-chart
+// @Accept json
+// @Produce json
+// @Param type query string false "track, artist or genre, default track"
+// @Param window query string false "day, week or month, default week"
+// @Param limit query int false "limit, default 10, at most 100"
+// @Success 200 {object} model.Chart
+// @Failure 400,500 {object} response.Problem
+// @Router /charts [get]
+func (h *Chart) GetChart(c *gin.Context) {
+	filter := model.ChartFilter{
+		Type:   c.DefaultQuery("type", model.ChartTrack),
+		Window: c.DefaultQuery("window", model.WindowWeek),
+		Limit:  util.ParseInt(c.Query("limit")),
+	}
+	chart, err := h.chartService.GetChart(c, filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(chart))
+}
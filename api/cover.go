@@ -0,0 +1,172 @@
+package api
+
+import (
+	"mime/multipart"
+	"net/http"
+	"sample/common/apperror"
+	"sample/common/artwork"
+	"sample/common/response"
+	"sample/common/util"
+	"sample/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// track covers are named after their image, clients bust caches with ?v=<cover.hash>
+	trackCoverCacheControl = "public, max-age=31536000"
+	// playlist covers may be mosaics which change with the tracks
+	playlistCoverCacheControl = "public, max-age=86400"
+)
+
+var errMissingImage = apperror.BadRequest(apperror.CodeMissingFile, "image is required")
+
+// coverFormat is WebP for the clients which accept it and JPEG for the others
+func coverFormat(c *gin.Context) artwork.Format {
+	if strings.Contains(c.GetHeader("Accept"), artwork.WebP.ContentType()) {
+		return artwork.WebP
+	}
+	return artwork.JPEG
+}
+
+// serveCover writes a cover with its hash and format as ETag, so unchanged covers are answered with 304
+func serveCover(c *gin.Context, cover *service.CoverFile, cacheControl string) {
+	defer cover.Close()
+	info, err := cover.Stat()
+	if err != nil {
+		writeError(c, apperror.Internal(err))
+		return
+	}
+	c.Header("Content-Type", cover.Format.ContentType())
+	c.Header("Cache-Control", cacheControl)
+	c.Header("Vary", "Accept")
+	c.Header("ETag", strconv.Quote(cover.Hash+"."+string(cover.Format)))
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), cover)
+}
+
+// openCoverUpload opens the image form file of a cover upload
+func openCoverUpload(c *gin.Context) (multipart.File, error) {
+	file, err := c.FormFile("image")
+	if err == http.ErrMissingFile {
+		return nil, errMissingImage
+	} else if err != nil {
+		return nil, errInvalidForm.Wrap(err)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, errInvalidForm.Wrap(err)
+	}
+	return f, nil
+}
+
+// GetTrackCover godoc
+// @Summary Get track cover
+// @Description Get the cover art of the track as a square WebP when the Accept header takes image/webp and as a JPEG otherwise, extracted from the audio or uploaded. It is cached for a year, add ?v=<cover.hash> to fetch a changed cover.
+// @Tags track
+// @Id get-track-cover
+// @Produce image/jpeg,image/webp
+// @Param id path string true "Track ID"
+// @Param size path int true "64, 300 or 1000"
+// @Success 200 {file} binary
+// @Success 304
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/cover/{size} [get]
+func (m *Track) GetTrackCover(c *gin.Context) {
+	cover, err := m.trackService.GetTrackCover(c, c.Param("id"), util.ParseInt(c.Param("size")), coverFormat(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	serveCover(c, cover, trackCoverCacheControl)
+}
+
+// PutTrackCover godoc
+// @Summary Put track cover
+// @Description Upload the cover art of the track, a JPEG, PNG, GIF or WebP of at most 10 MB. It replaces the cover extracted from the audio and is kept when the audio is replaced.
+// @Tags track
+// @Id put-track-cover
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param If-Match header string true "ETag of the track"
+// @Param image formData file true "image"
+// @Success 200 {object} model.Track
+// @Failure 400,404,412,428,500 {object} response.Problem
+// @Router /track/{id}/cover [put]
+func (m *Track) PutTrackCover(c *gin.Context) {
+	version, err := ifMatchVersion(c, m.trackVersion(c, c.Param("id")))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	image, err := openCoverUpload(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer image.Close()
+	track, err := m.trackService.PutTrackCover(c, c.Param("id"), version, image)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, track.Version)
+	c.JSON(response.OK(track))
+}
+
+// GetPlaylistCover godoc
+// @Summary Get playlist cover
+// @Description Get the cover art of the playlist as a square WebP when the Accept header takes image/webp and as a JPEG otherwise. Playlists without their own cover get a 2x2 mosaic of the first four different covers of their tracks, or the first one when there are fewer.
+// @Tags playlist
+// @Id get-playlist-cover
+// @Produce image/jpeg,image/webp
+// @Param id path string true "Playlist ID"
+// @Param size path int true "64, 300 or 1000"
+// @Success 200 {file} binary
+// @Success 304
+// @Failure 400,404,500 {object} response.Problem
+// @Router /playlist/{id}/cover/{size} [get]
+func (p *Playlist) GetPlaylistCover(c *gin.Context) {
+	cover, err := p.playListService.GetPlaylistCover(c, c.Param("id"), util.ParseInt(c.Param("size")), coverFormat(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	serveCover(c, cover, playlistCoverCacheControl)
+}
+
+// PutPlaylistCover godoc
+// @Summary Put playlist cover
+// @Description Upload the cover art of the playlist, a JPEG, PNG, GIF or WebP of at most 10 MB
+// @Tags playlist
+// @Id put-playlist-cover
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param image formData file true "image"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,412,428,500 {object} response.Problem
+// @Router /playlist/{id}/cover [put]
+func (p *Playlist) PutPlaylistCover(c *gin.Context) {
+	version, err := ifMatchVersion(c, p.playlistVersion(c, c.Param("id")))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	image, err := openCoverUpload(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer image.Close()
+	playlist, err := p.playListService.PutPlaylistCover(c, c.Param("id"), version, image)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
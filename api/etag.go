@@ -0,0 +1,82 @@
+package api
+
+import (
+	"sample/common/apperror"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errIfMatchRequired = apperror.PreconditionRequired(apperror.CodeIfMatchRequired, "If-Match header with the ETag of the resource is required")
+	errIfMatchInvalid  = apperror.PreconditionFailed(apperror.CodeVersionMismatch, "If-Match does not match the current ETag")
+)
+
+// setETag exposes the version of a track or playlist as a strong ETag
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// ifMatchVersion returns the version carried by the If-Match header, writes are
+// only accepted against a version the client has seen. "*" and lists of ETags are
+// resolved against the current version, which is looked up only for them.
+func ifMatchVersion(c *gin.Context, current func() (int64, error)) (int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if len(header) == 0 {
+		return 0, errIfMatchRequired
+	}
+	tags := strings.Split(header, ",")
+	if len(tags) == 1 && header != "*" {
+		return parseETag(header)
+	}
+	version, err := current()
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return version, nil
+		} else if listed, err := parseETag(tag); err == nil && listed == version {
+			return version, nil
+		}
+	}
+	return 0, errIfMatchInvalid
+}
+
+// parseETag reads the version of a single ETag, If-Match uses the strong
+// comparison, so weak and unknown tags never match
+func parseETag(etag string) (int64, error) {
+	tag, err := strconv.Unquote(etag)
+	if err != nil {
+		return 0, errIfMatchInvalid
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 0 {
+		return 0, errIfMatchInvalid
+	}
+	return version, nil
+}
+
+// trackVersion looks up the current version of a track for ifMatchVersion
+func (m *Track) trackVersion(c *gin.Context, trackUuid string) func() (int64, error) {
+	return func() (int64, error) {
+		track, err := m.trackService.GetTrackById(c, trackUuid)
+		if err != nil {
+			return 0, err
+		}
+		return track.Version, nil
+	}
+}
+
+// playlistVersion looks up the current version of a playlist for ifMatchVersion
+func (p *Playlist) playlistVersion(c *gin.Context, playlistUuid string) func() (int64, error) {
+	return func() (int64, error) {
+		playlist, err := p.playListService.GetPlaylistById(c, playlistUuid)
+		if err != nil {
+			return 0, err
+		}
+		return playlist.Version, nil
+	}
+}
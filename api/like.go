@@ -0,0 +1,135 @@
+package api
+
+import (
+	"sample/common/model"
+	"sample/common/response"
+	"sample/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Like struct {
+	likeService service.ILikeService
+}
+
+func APILikeHandler(r *gin.Engine, likeService service.ILikeService) {
+	handler := &Like{
+		likeService: likeService,
+	}
+	Group := r.Group("v1")
+	{
+		Group.PUT("track/:id/like", handler.LikeTrack)
+		Group.DELETE("track/:id/like", handler.UnlikeTrack)
+		Group.PUT("playlist/:id/like", handler.LikePlaylist)
+		Group.DELETE("playlist/:id/like", handler.UnlikePlaylist)
+		Group.GET("me/library", handler.GetLibrary)
+	}
+}
+
+// LikeTrack godoc
+// @Summary Like track
+// @Description Add the track to the library of the user, liking it again changes nothing
+// @Tags like
+// @Id like-track
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param X-User-ID header string true "User ID"
+// @Success 200 {object} model.LikeStatus
+// @Failure 400,401,404,500 {object} response.Problem
+// @Router /track/{id}/like [put]
+func (l *Like) LikeTrack(c *gin.Context) {
+	l.setLike(c, model.LikeTrack, true)
+}
+
+// UnlikeTrack godoc
+// @Summary Unlike track
+// @Description Remove the track from the library of the user, unliking it again changes nothing
+// @Tags like
+// @Id unlike-track
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param X-User-ID header string true "User ID"
+// @Success 200 {object} model.LikeStatus
+// @Failure 400,401,404,500 {object} response.Problem
+// @Router /track/{id}/like [delete]
+func (l *Like) UnlikeTrack(c *gin.Context) {
+	l.setLike(c, model.LikeTrack, false)
+}
+
+// LikePlaylist godoc
+// @Summary Like playlist
+// @Description Save the playlist to the library of the user, liking it again changes nothing
+// @Tags like
+// @Id like-playlist
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param X-User-ID header string true "User ID"
+// @Success 200 {object} model.LikeStatus
+// @Failure 400,401,404,500 {object} response.Problem
+// @Router /playlist/{id}/like [put]
+func (l *Like) LikePlaylist(c *gin.Context) {
+	l.setLike(c, model.LikePlaylist, true)
+}
+
+// UnlikePlaylist godoc
+// @Summary Unlike playlist
+// @Description Remove the playlist from the library of the user, unliking it again changes nothing
+// @Tags like
+// @Id unlike-playlist
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param X-User-ID header string true "User ID"
+// @Success 200 {object} model.LikeStatus
+// @Failure 400,401,404,500 {object} response.Problem
+// @Router /playlist/{id}/like [delete]
+func (l *Like) UnlikePlaylist(c *gin.Context) {
+	l.setLike(c, model.LikePlaylist, false)
+}
+
+func (l *Like) setLike(c *gin.Context, kind string, liked bool) {
+	userID, err := requireUser(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	var status *model.LikeStatus
+	if liked {
+		status, err = l.likeService.Like(c, userID, kind, c.Param("id"))
+	} else {
+		status, err = l.likeService.Unlike(c, userID, kind, c.Param("id"))
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(status))
+}
+
+// GetLibrary godoc
+// @Summary Get library
+// @Description Get the tracks and playlists liked by the user, most recently liked first
+// @Tags like
+// @Id get-library
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "User ID"
+// @Success 200 {object} model.Library
+// @Failure 401,500 {object} response.Problem
+// @Router /me/library [get]
+func (l *Like) GetLibrary(c *gin.Context) {
+	userID, err := requireUser(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	library, err := l.likeService.GetLibrary(c, userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(library))
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"regexp"
+	"sample/common/apperror"
+	"sample/common/log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	userIDHeader    = "X-User-ID"
+	userKey         = "user"
+)
+
+// an incoming request id or user id is only used when it is reasonably short and printable
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+var errMissingUser = apperror.Unauthorized(apperror.CodeUnauthorized, userIDHeader+" is required")
+
+// RequestIDMiddleware reuses the X-Request-ID of the request or assigns a new one,
+// and stores it in the request context so that common/log adds it to every line
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set(requestIDKey, requestID)
+		c.Request = c.Request.WithContext(log.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Writer.Header().Set(requestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// UserMiddleware identifies the caller by the X-User-ID header, the user is
+// logged with the request and read by the handlers through requireUser
+func UserMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID := c.GetHeader(userIDHeader); validRequestID.MatchString(userID) {
+			c.Set(userKey, userID)
+		}
+		c.Next()
+	}
+}
+
+// requireUser returns the user of the request, or an unauthorized error when it is unknown
+func requireUser(c *gin.Context) (string, error) {
+	userID := c.GetString(userKey)
+	if len(userID) == 0 {
+		return "", errMissingUser
+	}
+	return userID, nil
+}
+
+// AccessLogMiddleware writes one JSON access log line per request
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = c.Request.URL.Path
+		}
+		bytes := c.Writer.Size()
+		if bytes < 0 {
+			bytes = 0
+		}
+		fields := map[string]interface{}{
+			"request_id": c.GetString(requestIDKey),
+			"method":     c.Request.Method,
+			"route":      route,
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":      bytes,
+			"client_ip":  c.ClientIP(),
+			"user":       c.GetString(userKey),
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.String()
+		}
+		log.Access(fields)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"io"
+	"sample/common/apperror"
+	"sample/common/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	maxPatchSize          = 1 << 20
+)
+
+var (
+	errUnsupportedPatch = apperror.UnsupportedMediaType(apperror.CodeUnsupportedMedia,
+		"Content-Type must be "+mergePatchContentType+" or "+jsonPatchContentType)
+	errPatchTooLarge = apperror.TooLarge(apperror.CodePatchTooLarge, "the patch document must be at most 1 MB")
+)
+
+// readPatch reads a PATCH body, plain application/json is taken as a merge patch
+func readPatch(c *gin.Context) (model.Patch, error) {
+	patch := model.Patch{}
+	switch c.ContentType() {
+	case mergePatchContentType, "application/json":
+		patch.Type = model.MergePatch
+	case jsonPatchContentType:
+		patch.Type = model.JSONPatch
+	default:
+		return patch, errUnsupportedPatch
+	}
+	// one byte more than allowed tells a document at the limit from a larger one
+	document, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchSize+1))
+	if err != nil {
+		return patch, errInvalidBody.Wrap(err)
+	} else if len(document) > maxPatchSize {
+		return patch, errPatchTooLarge
+	}
+	patch.Document = document
+	return patch, nil
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"sample/common/model"
+	"sample/common/response"
+	"sample/common/util"
+	"sample/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultPlaysLimit = 50
+
+type Play struct {
+	playService service.IPlayService
+}
+
+func APIPlayHandler(r *gin.Engine, playService service.IPlayService) {
+	handler := &Play{
+		playService: playService,
+	}
+	Group := r.Group("v1")
+	{
+		Group.POST("track/:id/play", handler.PostPlay)
+		Group.GET("track/:id/plays", handler.GetPlayCount)
+		Group.GET("plays", handler.GetPlays)
+	}
+}
+
+// PostPlay godoc
+// @Summary Record a play
+// @Description Record that the user played a track. The play counts once 30 seconds or half of the track were played, plays overlapping the last counted play of the track are not counted again.
+// @Tags play
+// @Id post-play
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param X-User-ID header string true "User ID"
+// @Param play body model.PlayRequest true "play"
+// @Success 200 {object} model.Play
+// @Failure 400,401,404,500 {object} response.Problem
+// @Router /track/{id}/play [post]
+func (p *Play) PostPlay(c *gin.Context) {
+	userID, err := requireUser(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	request := model.PlayRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
+		return
+	}
+	play, err := p.playService.PostPlay(c, userID, c.Param("id"), request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(play))
+}
+
+// GetPlayCount godoc
+// @Summary Get play count of track
+// @Description Get the number of counted plays of a track
+// @Tags play
+// @Id get-play-count
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Success 200 {object} model.TrackPlayCount
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/plays [get]
+func (p *Play) GetPlayCount(c *gin.Context) {
+	playCount, err := p.playService.GetPlayCount(c, c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(playCount))
+}
+
+// GetPlays godoc
+// @Summary Get recent plays
+// @Description Get the plays of the user, newest first
+// @Tags play
+// @Id get-plays
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "User ID"
+// @Param track_id query string false "track id"
+// @Param limit query int false "limit, default 50"
+// @Param offset query int false "offset"
+// @Success 200 {array} model.Play
+// @Failure 400,401,500 {object} response.Problem
+// @Router /plays [get]
+func (p *Play) GetPlays(c *gin.Context) {
+	userID, err := requireUser(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	filter := model.PlayFilter{
+		UserID:  userID,
+		TrackID: c.Query("track_id"),
+		Limit:   util.ParseInt(c.Query("limit")),
+		Offset:  util.ParseInt(c.Query("offset")),
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPlaysLimit
+	}
+	plays, err := p.playService.GetPlays(c, filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(plays))
+}
@@ -1,14 +1,18 @@
 package api
 
 import (
+	"sample/common/apperror"
 	"sample/common/model"
 	"sample/common/response"
 	"sample/common/util"
 	"sample/service"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+var errInvalidExpand = apperror.BadRequest(apperror.CodeInvalidQuery, "expand must be a comma separated list of tracks and stats")
+
 type Playlist struct {
 	playListService service.IPlaylistService
 }
@@ -24,6 +28,15 @@ func APIPlaylistHandler(r *gin.Engine, playListService service.IPlaylistService)
 		Group.POST("", handler.PostPlaylist)
 		Group.DELETE(":id", handler.DeletePlaylistById)
 		Group.PUT(":id", handler.PutPlaylistById)
+		Group.PATCH(":id", handler.PatchPlaylistById)
+		Group.POST(":id/tracks", handler.AddPlaylistTracks)
+		Group.DELETE(":id/tracks", handler.RemovePlaylistTrack)
+		Group.POST(":id/tracks/move", handler.MovePlaylistTracks)
+		Group.PUT(":id/tracks/:index/priority", handler.SetPlaylistTrackPriority)
+		Group.GET(":id/export", handler.ExportPlaylist)
+		Group.GET(":id/cover/:size", handler.GetPlaylistCover)
+		Group.PUT(":id/cover", handler.PutPlaylistCover)
+		Group.POST("import", handler.ImportPlaylist)
 	}
 }
 
@@ -36,6 +49,7 @@ func APIPlaylistHandler(r *gin.Engine, playListService service.IPlaylistService)
 // @Produce json
 // @Param name query string false "name"
 // @Success 200 {object} model.Playlist
+// @Failure 400,404,500 {object} response.Problem
 // @Router /playlist [get]
 func (p *Playlist) GetPlaylists(c *gin.Context) {
 	filter := model.PlaylistFilter{
@@ -43,8 +57,12 @@ func (p *Playlist) GetPlaylists(c *gin.Context) {
 		Limit:  util.ParseInt(c.Query("limit")),
 		Offset: util.ParseInt(c.Query("offset")),
 	}
-	code, result := p.playListService.GetPlaylists(c, filter)
-	c.JSON(code, result)
+	playlists, err := p.playListService.GetPlaylists(c, filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(playlists))
 }
 
 // PostPlaylist godoc
@@ -56,43 +74,59 @@ func (p *Playlist) GetPlaylists(c *gin.Context) {
 // @Produce json
 // @Param playlist body model.PlaylistRequest true "playlist"
 // @Success 200 {object} model.Playlist
+// @Failure 400,404,500 {object} response.Problem
 // @Router /playlist [post]
 func (p *Playlist) PostPlaylist(c *gin.Context) {
 	playlist := model.PlaylistRequest{}
-	if err := c.BindJSON(&playlist); err != nil {
-		code, result := response.BadRequest()
-		c.JSON(code, result)
+	if err := c.ShouldBindJSON(&playlist); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
 		return
 	}
 	if err := playlist.Validate(); err != nil {
-		code, _ := response.BadRequest()
-		c.JSON(code, err)
+		writeError(c, err)
 		return
 	}
 
-	code, result := p.playListService.PostPlaylist(c, playlist)
-	c.JSON(code, result)
+	result, err := p.playListService.PostPlaylist(c, playlist)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, result.Version)
+	c.JSON(response.OK(result))
 }
 
 // GetPlaylistById godoc
 // @Summary Get playlist by id
-// @Description Get playlist by id
+// @Description Get playlist by id, expand=tracks adds the tracks and expand=stats the duration, genre and artist statistics
 // @Tags playlist
 // @Id get-playlist-id
 // @Accept json
 // @Produce json
 // @Param id path string true "Playlist ID"
-// @Success 200 {object} model.Playlist
+// @Param expand query string false "comma separated list of tracks and stats"
+// @Success 200 {object} model.PlaylistDetail
+// @Failure 400,404,500 {object} response.Problem
 // @Router /playlist/{id} [get]
 func (p *Playlist) GetPlaylistById(c *gin.Context) {
 	trackUuid := c.Param("id")
 	if trackUuid == "" {
-		c.JSON(response.BadRequestMsg("id is missing"))
+		writeError(c, errMissingID)
 		c.Abort()
 		return
 	}
-	code, result := p.playListService.GetPlaylistById(c, trackUuid)
-	c.JSON(code, result)
+	expand, err := parseExpand(c.Query("expand"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	playlist, err := p.playListService.GetPlaylistDetail(c, trackUuid, expand)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
 }
 
 // DeletePlaylistById godoc
@@ -103,17 +137,29 @@ func (p *Playlist) GetPlaylistById(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
 // @Success 200 {object} model.Playlist
+// @Failure 400,404,412,428,500 {object} response.Problem
 // @Router /playlist/{id} [delete]
 func (p *Playlist) DeletePlaylistById(c *gin.Context) {
 	playlistUuid := c.Param("id")
 	if playlistUuid == "" {
-		c.JSON(response.BadRequestMsg("id is missing"))
+		writeError(c, errMissingID)
 		c.Abort()
 		return
 	}
-	code, result := p.playListService.DeletePlaylistById(c, playlistUuid)
-	c.JSON(code, result)
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := p.playListService.DeletePlaylistById(c, playlistUuid, version); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(map[string]interface{}{
+		"delete success playlist id": playlistUuid,
+	}))
 }
 
 // PutPlaylistById godoc
@@ -124,23 +170,90 @@ func (p *Playlist) DeletePlaylistById(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
 // @Param playlist body model.PlaylistRequest true "playlist"
 // @Success 200 {object} model.Playlist
+// @Failure 400,404,412,428,500 {object} response.Problem
 // @Router /playlist/{id} [Put]
 func (p *Playlist) PutPlaylistById(c *gin.Context) {
 	playlistUuid := c.Param("id")
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
 	playlistUpdate := model.PlaylistRequest{}
-	if err := c.BindJSON(&playlistUpdate); err != nil {
-		code, result := response.BadRequest()
-		c.JSON(code, result)
+	if err := c.ShouldBindJSON(&playlistUpdate); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
 		return
 	}
 	if err := playlistUpdate.Validate(); err != nil {
-		code, _ := response.BadRequest()
-		c.JSON(code, err)
+		writeError(c, err)
+		return
+	}
+
+	playlist, err := p.playListService.PutPlaylistById(c, playlistUuid, version, playlistUpdate)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(map[string]interface{}{
+		"update success playlist id": playlistUuid,
+	}))
+}
+
+// PatchPlaylistById godoc
+// @Summary Patch playlist by id
+// @Description Update only the given fields with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// @Tags playlist
+// @Id patch-playlist
+// @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param patch body object true "merge patch document or JSON Patch operations"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,409,412,413,415,428,500 {object} response.Problem
+// @Router /playlist/{id} [patch]
+func (p *Playlist) PatchPlaylistById(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
 		return
 	}
+	patch, err := readPatch(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	playlist, err := p.playListService.PatchPlaylistById(c, playlistUuid, version, patch)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
 
-	code, result := p.playListService.PutPlaylistById(c, playlistUuid, playlistUpdate)
-	c.JSON(code, result)
+// parseExpand reads the expand query of a playlist read, e.g. "tracks,stats"
+func parseExpand(value string) (model.PlaylistExpand, error) {
+	expand := model.PlaylistExpand{}
+	if len(value) == 0 {
+		return expand, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		switch strings.TrimSpace(item) {
+		case "tracks":
+			expand.Tracks = true
+		case "stats":
+			expand.Stats = true
+		default:
+			return expand, errInvalidExpand
+		}
+	}
+	return expand, nil
 }
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"sample/common/apperror"
+	"sample/common/playlistformat"
+	"sample/common/response"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPlaylistFileSize = 5 << 20
+
+var (
+	errUnknownPlaylistFormat = apperror.BadRequest(apperror.CodeInvalidQuery, "format must be one of m3u8, pls, xspf or json")
+	errMissingPlaylistFile   = apperror.BadRequest(apperror.CodeMissingFile, "file is required")
+	errInvalidPlaylistFile   = apperror.BadRequest(apperror.CodeInvalidFileFormat, "playlist file could not be read")
+)
+
+// ExportPlaylist godoc
+// @Summary Export playlist
+// @Description Export a playlist as M3U8, PLS, XSPF or JSON, entries link to the track download
+// @Tags playlist
+// @Id export-playlist
+// @Produce audio/x-mpegurl
+// @Produce audio/x-scpls
+// @Produce application/xspf+xml
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param format query string false "m3u8, pls, xspf or json, default m3u8"
+// @Success 200 {file} file
+// @Failure 400,404,500 {object} response.Problem
+// @Router /playlist/{id}/export [get]
+func (p *Playlist) ExportPlaylist(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	format := c.DefaultQuery("format", playlistformat.M3U8)
+	if len(playlistformat.ContentType(format)) == 0 {
+		writeError(c, errUnknownPlaylistFormat)
+		return
+	}
+	doc, err := p.playListService.ExportPlaylist(c, playlistUuid)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	base := baseURL(c)
+	for i := range doc.Tracks {
+		doc.Tracks[i].Location = fmt.Sprintf("%s/v1/track/%s/download", base, doc.Tracks[i].TrackID)
+	}
+
+	var body bytes.Buffer
+	if err := playlistformat.Encode(&body, format, *doc); err != nil {
+		writeError(c, apperror.Internal(err))
+		return
+	}
+	filename := doc.Name
+	if len(strings.TrimSpace(filename)) == 0 {
+		filename = "playlist"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	c.Data(http.StatusOK, playlistformat.ContentType(format), body.Bytes())
+}
+
+// ImportPlaylist godoc
+// @Summary Import playlist
+// @Description Create a playlist from an M3U8, PLS, XSPF or JSON file. Entries are matched to tracks by id, file name, title and artist, then by fuzzy title; entries without a match are reported.
+// @Tags playlist
+// @Id import-playlist
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "playlist file"
+// @Param format query string false "m3u8, pls, xspf or json, default from the file extension"
+// @Param name query string false "playlist name, default from the file"
+// @Success 200 {object} model.PlaylistImportReport
+// @Failure 400,500 {object} response.Problem
+// @Router /playlist/import [post]
+func (p *Playlist) ImportPlaylist(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPlaylistFileSize)
+	fileHeader, err := c.FormFile("file")
+	if err == http.ErrMissingFile {
+		writeError(c, errMissingPlaylistFile)
+		return
+	} else if err != nil {
+		writeError(c, errInvalidForm.Wrap(err))
+		return
+	}
+	format := c.Query("format")
+	if len(format) == 0 {
+		format = playlistformat.FromFilename(fileHeader.Filename)
+	}
+	if len(playlistformat.ContentType(format)) == 0 {
+		writeError(c, errUnknownPlaylistFormat)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		writeError(c, apperror.Internal(err))
+		return
+	}
+	defer file.Close()
+	doc, err := playlistformat.Decode(file, format)
+	if err != nil {
+		writeError(c, errInvalidPlaylistFile.Wrap(err))
+		return
+	}
+	if name := c.Query("name"); len(name) > 0 {
+		doc.Name = name
+	} else if len(strings.TrimSpace(doc.Name)) == 0 {
+		doc.Name = strings.TrimSuffix(fileHeader.Filename, path.Ext(fileHeader.Filename))
+	}
+
+	report, err := p.playListService.ImportPlaylist(c, doc)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, report.Playlist.Version)
+	c.JSON(response.OK(report))
+}
+
+// baseURL is the scheme and host the client used to reach the server
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if proto := c.GetHeader("X-Forwarded-Proto"); len(proto) > 0 {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	} else if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
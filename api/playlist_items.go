@@ -0,0 +1,170 @@
+package api
+
+import (
+	"sample/common/apperror"
+	"sample/common/model"
+	"sample/common/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidIndex  = apperror.BadRequest(apperror.CodeInvalidQuery, "index must be a non-negative integer")
+	errRemoveByWhich = apperror.BadRequest(apperror.CodeInvalidQuery, "either track_id or index is required")
+)
+
+// AddPlaylistTracks godoc
+// @Summary Add tracks to playlist
+// @Description Insert tracks at a position of the playlist, or append them when no position is given.
+// @Tags playlist
+// @Id add-playlist-tracks
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param tracks body model.PlaylistTracksRequest true "tracks"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,409,412,428,500 {object} response.Problem
+// @Router /playlist/{id}/tracks [post]
+func (p *Playlist) AddPlaylistTracks(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	request := model.PlaylistTracksRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
+		return
+	}
+	playlist, err := p.playListService.AddPlaylistTracks(c, playlistUuid, version, request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
+
+// RemovePlaylistTrack godoc
+// @Summary Remove tracks from playlist
+// @Description Remove every entry of a track, or the entry at an index.
+// @Tags playlist
+// @Id remove-playlist-track
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param track_id query string false "track id"
+// @Param index query int false "entry index"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,409,412,428,500 {object} response.Problem
+// @Router /playlist/{id}/tracks [delete]
+func (p *Playlist) RemovePlaylistTrack(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	trackId, byTrack := c.GetQuery("track_id")
+	indexStr, byIndex := c.GetQuery("index")
+	if byTrack == byIndex {
+		writeError(c, errRemoveByWhich)
+		return
+	}
+
+	var playlist *model.Playlist
+	if byTrack {
+		playlist, err = p.playListService.RemovePlaylistTrack(c, playlistUuid, version, trackId)
+	} else {
+		index, convErr := strconv.Atoi(indexStr)
+		if convErr != nil || index < 0 {
+			writeError(c, errInvalidIndex)
+			return
+		}
+		playlist, err = p.playListService.RemovePlaylistTrackAt(c, playlistUuid, version, index)
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
+
+// MovePlaylistTracks godoc
+// @Summary Move tracks in playlist
+// @Description Move `count` entries starting at `from` so that the first one ends up at index `to`.
+// @Tags playlist
+// @Id move-playlist-tracks
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param move body model.PlaylistMoveRequest true "move"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,409,412,428,500 {object} response.Problem
+// @Router /playlist/{id}/tracks/move [post]
+func (p *Playlist) MovePlaylistTracks(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	request := model.PlaylistMoveRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
+		return
+	}
+	playlist, err := p.playListService.MovePlaylistTracks(c, playlistUuid, version, request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
+
+// SetPlaylistTrackPriority godoc
+// @Summary Set priority of a playlist entry
+// @Description Set the priority of the entry at an index.
+// @Tags playlist
+// @Id set-playlist-track-priority
+// @Accept json
+// @Produce json
+// @Param id path string true "Playlist ID"
+// @Param index path int true "entry index"
+// @Param If-Match header string true "ETag of the playlist"
+// @Param priority body model.PlaylistPriorityRequest true "priority"
+// @Success 200 {object} model.Playlist
+// @Failure 400,404,409,412,428,500 {object} response.Problem
+// @Router /playlist/{id}/tracks/{index}/priority [put]
+func (p *Playlist) SetPlaylistTrackPriority(c *gin.Context) {
+	playlistUuid := c.Param("id")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		writeError(c, errInvalidIndex)
+		return
+	}
+	version, err := ifMatchVersion(c, p.playlistVersion(c, playlistUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	request := model.PlaylistPriorityRequest{}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, errInvalidBody.Wrap(err))
+		return
+	}
+	playlist, err := p.playListService.SetPlaylistTrackPriority(c, playlistUuid, version, index, request.Priority)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, playlist.Version)
+	c.JSON(response.OK(playlist))
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"sample/common/apperror"
+	"sample/common/response"
+	"sample/common/util"
+	"sample/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errMissingSeed = apperror.BadRequest(apperror.CodeInvalidQuery, "seed or session is required")
+
+type Recommendation struct {
+	recommendationService service.IRecommendationService
+}
+
+func APIRecommendationHandler(r *gin.Engine, recommendationService service.IRecommendationService) {
+	handler := &Recommendation{
+		recommendationService: recommendationService,
+	}
+	Group := r.Group("v1")
+	{
+		Group.GET("track/:id/similar", handler.GetSimilarTracks)
+		Group.GET("radio", handler.GetRadio)
+	}
+}
+
+// GetSimilarTracks godoc
+// @Summary Get similar tracks
+// @Description Rank tracks by shared artist and genre, release year, playlists and listeners. Tracks the user played recently are left out.
+// @Tags recommendation
+// @Id get-similar-tracks
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param X-User-ID header string false "User ID"
+// @Param limit query int false "limit, default 10, at most 50"
+// @Success 200 {array} model.Recommendation
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/similar [get]
+func (r *Recommendation) GetSimilarTracks(c *gin.Context) {
+	recommendations, err := r.recommendationService.GetSimilarTracks(c, c.Param("id"), c.GetString(userKey), util.ParseInt(c.Query("limit")))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(recommendations))
+}
+
+// GetRadio godoc
+// @Summary Get radio queue
+// @Description Start an endless queue of tracks similar to the seed, pass the returned session to get the next tracks
+// @Tags recommendation
+// @Id get-radio
+// @Accept json
+// @Produce json
+// @Param seed query string false "Track ID to start from"
+// @Param session query string false "session of the queue to continue"
+// @Param X-User-ID header string false "User ID"
+// @Param limit query int false "limit, default 10, at most 50"
+// @Success 200 {object} model.RadioQueue
+// @Failure 400,404,500 {object} response.Problem
+// @Router /radio [get]
+func (r *Recommendation) GetRadio(c *gin.Context) {
+	seed, session := c.Query("seed"), c.Query("session")
+	if len(seed) == 0 && len(session) == 0 {
+		writeError(c, errMissingSeed)
+		return
+	}
+	queue, err := r.recommendationService.GetRadio(c, c.GetString(userKey), seed, session, util.ParseInt(c.Query("limit")))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(queue))
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"sample/common/apperror"
+	"sample/common/log"
+	"sample/common/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errMissingID         = apperror.BadRequest(apperror.CodeMissingID, "id is missing")
+	errInvalidBody       = apperror.BadRequest(apperror.CodeInvalidBody, "request body is not valid JSON")
+	errInvalidForm       = apperror.BadRequest(apperror.CodeInvalidForm, "request must be multipart/form-data")
+	errMissingFile       = apperror.BadRequest(apperror.CodeMissingFile, "mp3_file is required")
+	errInvalidFileFormat = apperror.BadRequest(apperror.CodeInvalidFileFormat, "Invalid file format. Please upload an MP3, WAV or FLAC audio file.")
+	errRouteNotFound     = apperror.NotFound(apperror.CodeNotFound, "resource not found")
+)
+
+// writeError maps err to an application/problem+json response, internal errors
+// are logged and never shown to the client
+func writeError(c *gin.Context, err error) {
+	if apperror.KindOf(err) == apperror.KindInternal {
+		log.WithContext(c).Error(err)
+	}
+	code, result := response.Error(err)
+	c.Header("Content-Type", response.ProblemContentType)
+	c.JSON(code, result)
+}
+
+func recoveryHandler(c *gin.Context, recovered any) {
+	log.WithContext(c).Errorf("panic recovered: %v", recovered)
+	writeError(c, apperror.Internal(nil))
+	c.Abort()
+}
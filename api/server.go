@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -19,7 +20,12 @@ type Server struct {
 
 func NewServer() *Server {
 	engine := gin.New()
-	engine.Use(gin.Recovery())
+	// let the request context (request id, deadlines) be reached through *gin.Context
+	engine.ContextWithFallback = true
+	engine.Use(RequestIDMiddleware())
+	engine.Use(UserMiddleware())
+	engine.Use(AccessLogMiddleware())
+	engine.Use(gin.CustomRecovery(recoveryHandler))
 	engine.Use(CORSMiddleware())
 	engine.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -28,6 +34,9 @@ func NewServer() *Server {
 			"time":    time.Now().Unix(),
 		})
 	})
+	engine.NoRoute(func(c *gin.Context) {
+		writeError(c, errRouteNotFound)
+	})
 	server := &Server{Engine: engine}
 	return server
 }
@@ -36,8 +45,9 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID, X-User-ID, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
 			return
@@ -46,7 +56,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-func (server *Server) Start(port string) {
+// Start serves on port until serving fails or ctx is done
+func (server *Server) Start(ctx context.Context, port string) {
 	v := make(chan struct{})
 	go func() {
 		if err := server.Engine.Run(":" + port); err != nil {
@@ -55,5 +66,9 @@ func (server *Server) Start(port string) {
 		}
 	}()
 	log.Infof("service %v listening on port %v", serviceName, port)
-	<-v
+	select {
+	case <-v:
+	case <-ctx.Done():
+		log.Infof("service %v stopping", serviceName)
+	}
 }
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sample/common/apperror"
+	"sample/common/hls"
+	"sample/common/model"
+	"sample/common/transcode"
+	"sample/common/util"
+	"sample/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultStreamBitrate = 128
+	hlsMediaPlaylist     = "index.m3u8"
+	hlsSegmentExtension  = ".mp3"
+)
+
+type Stream struct {
+	streamService service.IStreamService
+}
+
+func APIStreamHandler(r *gin.Engine, streamService service.IStreamService) {
+	handler := &Stream{
+		streamService: streamService,
+	}
+	Group := r.Group("v1/track")
+	{
+		Group.GET(":id/stream", handler.StreamTrack)
+		Group.GET(":id/preview", handler.GetPreview)
+		Group.GET(":id/hls/master.m3u8", handler.GetHLSMaster)
+		Group.GET(":id/hls/:rendition/:file", handler.GetHLSFile)
+	}
+}
+
+// StreamTrack godoc
+// @Summary Stream track
+// @Description Stream the track audio in a format and bitrate, transcoded on first request and cached. Range requests are supported.
+// @Tags track
+// @Id stream-track
+// @Produce audio/mpeg,audio/wav,audio/ogg
+// @Param id path string true "Track ID"
+// @Param format query string false "mp3, wav or opus, default mp3"
+// @Param bitrate query int false "64, 128 or 320 kbit/s, default 128, ignored for wav"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/stream [get]
+func (s *Stream) StreamTrack(c *gin.Context) {
+	bitrate := defaultStreamBitrate
+	if len(c.Query("bitrate")) > 0 {
+		bitrate = util.ParseInt(c.Query("bitrate"))
+	}
+	rendition, err := transcode.ParseRendition(c.DefaultQuery("format", transcode.MP3), bitrate)
+	if err != nil {
+		writeError(c, apperror.BadRequest(apperror.CodeInvalidQuery, err.Error()))
+		return
+	}
+	stream, err := s.streamService.Stream(c, c.Param("id"), rendition)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer stream.Close()
+	info, err := stream.Stat()
+	if err != nil {
+		writeError(c, apperror.Internal(err))
+		return
+	}
+	name := fmt.Sprintf("%s.%s", stream.Track.ID, rendition.Extension())
+	c.Header("Content-Type", rendition.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), stream)
+}
+
+// GetPreview godoc
+// @Summary Get track preview
+// @Description Get an excerpt of the track, cut at MP3 frames or WAV samples without re-encoding unless it fades in and out. FLAC tracks are previewed as WAV. Previews are cached and Range requests are supported.
+// @Tags track
+// @Id get-track-preview
+// @Produce audio/mpeg,audio/wav
+// @Param id path string true "Track ID"
+// @Param start query number false "start in seconds, default a configured share of the duration"
+// @Param length query number false "length in seconds, default 30, at most 120"
+// @Param fade query bool false "fade in and out, re-encodes the excerpt"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/preview [get]
+func (s *Stream) GetPreview(c *gin.Context) {
+	request := model.PreviewRequest{
+		Length: util.ParseFloat64(c.Query("length")),
+		Fade:   c.Query("fade") == "true",
+	}
+	if len(c.Query("start")) > 0 {
+		start := util.ParseFloat64(c.Query("start"))
+		request.Start = &start
+	}
+	preview, err := s.streamService.Preview(c, c.Param("id"), request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer preview.Close()
+	info, err := preview.Stat()
+	if err != nil {
+		writeError(c, apperror.Internal(err))
+		return
+	}
+	name := fmt.Sprintf("%s_preview.%s", preview.Track.ID, preview.Extension)
+	c.Header("Content-Type", preview.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), preview)
+}
+
+// GetHLSMaster godoc
+// @Summary Get HLS master playlist
+// @Description List the mp3 renditions of the track for HTTP Live Streaming, with their peak and average bandwidth
+// @Tags track
+// @Id get-hls-master
+// @Produce application/vnd.apple.mpegurl
+// @Param id path string true "Track ID"
+// @Success 200 {file} binary
+// @Failure 404,500 {object} response.Problem
+// @Router /track/{id}/hls/master.m3u8 [get]
+func (s *Stream) GetHLSMaster(c *gin.Context) {
+	playlist, err := s.streamService.HLSMaster(c, c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Header("Content-Type", hls.ContentType)
+	c.Status(http.StatusOK)
+	playlist.WriteTo(c.Writer)
+}
+
+// GetHLSFile godoc
+// @Summary Get HLS media playlist or segment
+// @Description Get the media playlist (index.m3u8) of an mp3 rendition, or one of its segments (<n>.mp3). Segments hold whole mp3 frames and start with an ID3 timestamp tag.
+// @Tags track
+// @Id get-hls-file
+// @Produce application/vnd.apple.mpegurl,audio/mpeg
+// @Param id path string true "Track ID"
+// @Param rendition path string true "rendition like mp3_128"
+// @Param file path string true "index.m3u8 or segment like 0.mp3"
+// @Success 200 {file} binary
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/hls/{rendition}/{file} [get]
+func (s *Stream) GetHLSFile(c *gin.Context) {
+	rendition, err := transcode.ParseRenditionName(c.Param("rendition"))
+	if err != nil {
+		writeError(c, apperror.BadRequest(apperror.CodeBadRequest, err.Error()))
+		return
+	}
+	file := c.Param("file")
+	if file == hlsMediaPlaylist {
+		playlist, err := s.streamService.HLSMedia(c, c.Param("id"), rendition)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header("Content-Type", hls.ContentType)
+		c.Status(http.StatusOK)
+		playlist.WriteTo(c.Writer)
+		return
+	}
+
+	index, err := strconv.Atoi(strings.TrimSuffix(file, hlsSegmentExtension))
+	if err != nil || !strings.HasSuffix(file, hlsSegmentExtension) {
+		writeError(c, apperror.BadRequest(apperror.CodeBadRequest, "file must be index.m3u8 or a segment like 0.mp3"))
+		return
+	}
+	segment, err := s.streamService.HLSSegment(c, c.Param("id"), rendition, index)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer segment.Close()
+	c.DataFromReader(http.StatusOK, segment.Size, rendition.ContentType(), segment, nil)
+}
@@ -1,18 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
-	"os"
-	"sample/common/log"
+	"sample/common/apperror"
 	"sample/common/model"
 	"sample/common/response"
 	"sample/common/util"
 	"sample/service"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+var errUnknownWaveformFormat = apperror.BadRequest(apperror.CodeInvalidQuery, "format must be json or dat")
+
 type Track struct {
 	trackService service.ITrackService
 }
@@ -24,11 +27,17 @@ func APIMusicTrackHandler(r *gin.Engine, trackService service.ITrackService) {
 	Group := r.Group("v1/track")
 	{
 		Group.GET("", handler.GetTracks)
+		Group.GET("duplicates", handler.GetDuplicates)
 		Group.GET(":id", handler.GetTrackById)
 		Group.POST("", handler.PostTrack)
 		Group.PUT(":id", handler.PutTrackById)
+		Group.PATCH(":id", handler.PatchTrackById)
 		Group.DELETE(":id", handler.DeleteTrackById)
 		Group.GET(":id/download", handler.DownloadTrackById)
+		Group.GET(":id/waveform", handler.GetWaveform)
+		Group.GET(":id/playback-hints", handler.GetPlaybackHints)
+		Group.GET(":id/cover/:size", handler.GetTrackCover)
+		Group.PUT(":id/cover", handler.PutTrackCover)
 	}
 }
 
@@ -43,7 +52,11 @@ func APIMusicTrackHandler(r *gin.Engine, trackService service.ITrackService) {
 // @Param artist query string false "artist"
 // @Param album query string false "album"
 // @Param genre query string false "genre"
+// @Param bpm_min query number false "lowest tempo in BPM"
+// @Param bpm_max query number false "highest tempo in BPM"
+// @Param key query string false "musical key, e.g. A minor, Am or Bb"
 // @Success 200 {object} model.Track
+// @Failure 400,404,500 {object} response.Problem
 // @Router /track [get]
 func (m *Track) GetTracks(c *gin.Context) {
 	filter := model.TrackFilter{
@@ -53,9 +66,35 @@ func (m *Track) GetTracks(c *gin.Context) {
 		Genre:  c.Query("genre"),
 		Limit:  util.ParseInt(c.Query("limit")),
 		Offset: util.ParseInt(c.Query("offset")),
+		BPMMin: util.ParseFloat64(c.Query("bpm_min")),
+		BPMMax: util.ParseFloat64(c.Query("bpm_max")),
+		Key:    c.Query("key"),
 	}
-	code, result := m.trackService.GetTracks(c, filter)
-	c.JSON(code, result)
+	tracks, err := m.trackService.GetTracks(c, filter)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(tracks))
+}
+
+// GetDuplicates godoc
+// @Summary Get duplicate tracks
+// @Description Get the groups of tracks in the catalog with the same audio, by content hash or acoustic fingerprint
+// @Tags track
+// @Id get-track-duplicates
+// @Accept json
+// @Produce json
+// @Success 200 {array} model.DuplicateCluster
+// @Failure 500 {object} response.Problem
+// @Router /track/duplicates [get]
+func (m *Track) GetDuplicates(c *gin.Context) {
+	clusters, err := m.trackService.GetDuplicates(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(clusters))
 }
 
 // PostTracks godoc
@@ -68,54 +107,29 @@ func (m *Track) GetTracks(c *gin.Context) {
 // @Param track body model.TrackRequest true "track"
 // @Param mp3_file formData file true "mp3_file"
 // @Success 200 {object} model.Track
+// @Failure 400,404,409,413,500 {object} response.Problem
 // @Router /track [post]
 func (m *Track) PostTrack(c *gin.Context) {
-	file, err := c.FormFile("mp3_file")
+	trackRequest, upload, err := m.readTrackForm(c)
 	if err != nil {
-		if err == http.ErrMissingFile {
-			c.JSON(response.BadRequestMsg("mp3_file is required"))
-			return
-		} else {
-			log.Error(err)
-			c.JSON(response.ServiceUnavailableMsg(err.Error()))
-			return
-		}
-	}
-
-	// Check file upload valid audio file
-	fileType := file.Header.Get("Content-type")
-	if fileType != "audio/mp3" && fileType != "audio/mpeg" && fileType != "audio/wav" {
-		c.JSON(response.BadRequestMsg("Invalid file format. Please upload an MP3 audio file."))
+		writeError(c, err)
+		return
+	} else if upload == nil {
+		writeError(c, errMissingFile)
 		return
 	}
-
-	trackRequest := model.TrackRequest{
-		Title:       c.PostForm("title"),
-		Artist:      c.PostForm("artist"),
-		Album:       c.PostForm("album"),
-		Genre:       c.PostForm("genre"),
-		ReleaseYear: util.ParseInt(c.PostForm("release_year")),
-	}
+	defer upload.Close()
 	if err := trackRequest.Validate(); err != nil {
-		code, _ := response.BadRequest()
-		c.JSON(code, err)
+		writeError(c, err)
 		return
 	}
-	code, result := m.trackService.PostTrack(c, trackRequest, file)
-	if code == http.StatusOK {
-		// if create success, upload file to audio dir
-		track := result.(model.Track)
-		audioDir := util.GetAudioDir() + "/" + track.ID
-		if _, err := os.Stat(audioDir); os.IsNotExist(err) {
-			os.MkdirAll(audioDir, 0755)
-		}
-		if err := c.SaveUploadedFile(file, audioDir+"/"+track.MP3File); err != nil {
-			log.Error(err)
-			c.JSON(response.ServiceUnavailableMsg(err.Error()))
-			return
-		}
+	track, err := m.trackService.PostTrack(c, *trackRequest, upload)
+	if err != nil {
+		writeError(c, err)
+		return
 	}
-	c.JSON(code, result)
+	setETag(c, track.Version)
+	c.JSON(response.OK(track))
 }
 
 // GetTrackById godoc
@@ -127,16 +141,22 @@ func (m *Track) PostTrack(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Track ID"
 // @Success 200 {object} model.Track
+// @Failure 400,404,500 {object} response.Problem
 // @Router /track/{id} [get]
 func (m *Track) GetTrackById(c *gin.Context) {
 	trackUuid := c.Param("id")
 	if trackUuid == "" {
-		c.JSON(response.BadRequestMsg("id is missing"))
+		writeError(c, errMissingID)
 		c.Abort()
 		return
 	}
-	code, result := m.trackService.GetTrackById(c, trackUuid)
-	c.JSON(code, result)
+	track, err := m.trackService.GetTrackById(c, trackUuid)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, track.Version)
+	c.JSON(response.OK(track))
 }
 
 // DeleteTrackById godoc
@@ -147,17 +167,29 @@ func (m *Track) GetTrackById(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Track ID"
+// @Param If-Match header string true "ETag of the track"
 // @Success 200 {object} model.Track
+// @Failure 400,404,412,428,500 {object} response.Problem
 // @Router /track/{id} [delete]
 func (m *Track) DeleteTrackById(c *gin.Context) {
 	trackUuid := c.Param("id")
 	if trackUuid == "" {
-		c.JSON(response.BadRequestMsg("id is missing"))
+		writeError(c, errMissingID)
 		c.Abort()
 		return
 	}
-	code, result := m.trackService.DeleteTrackById(c, trackUuid)
-	c.JSON(code, result)
+	version, err := ifMatchVersion(c, m.trackVersion(c, trackUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := m.trackService.DeleteTrackById(c, trackUuid, version); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(response.OK(map[string]interface{}{
+		"delete success track id": trackUuid,
+	}))
 }
 
 // PutTrackById godoc
@@ -168,56 +200,76 @@ func (m *Track) DeleteTrackById(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Track ID"
+// @Param If-Match header string true "ETag of the track"
 // @Param track body model.TrackRequest true "track"
 // @Param mp3_file formData file false "mp3_file"
 // @Success 200 {object} model.Track
+// @Failure 400,404,409,412,413,428,500 {object} response.Problem
 // @Router /track/{id} [Put]
 func (m *Track) PutTrackById(c *gin.Context) {
 	trackUuid := c.Param("id")
-	file, err := c.FormFile("mp3_file")
-	if err != nil && err != http.ErrMissingFile {
-		log.Error(err)
-		c.JSON(response.ServiceUnavailableMsg(err.Error()))
+	version, err := ifMatchVersion(c, m.trackVersion(c, trackUuid))
+	if err != nil {
+		writeError(c, err)
 		return
 	}
-
-	// Check file upload valid audio file
-	if file != nil {
-		fileType := file.Header.Get("Content-type")
-		if fileType != "audio/mp3" && fileType != "audio/mpeg" && fileType != "audio/wav" {
-			c.JSON(response.BadRequestMsg("Invalid file format. Please upload an MP3 audio file."))
-			return
-		}
+	trackPost, upload, err := m.readTrackForm(c)
+	if err != nil {
+		writeError(c, err)
+		return
 	}
-
-	trackPost := model.TrackRequest{
-		Title:       c.PostForm("title"),
-		Artist:      c.PostForm("artist"),
-		Album:       c.PostForm("album"),
-		Genre:       c.PostForm("genre"),
-		ReleaseYear: util.ParseInt(c.PostForm("release_year")),
+	var audio service.AudioSource
+	if upload != nil {
+		defer upload.Close()
+		audio = upload
 	}
 	if err := trackPost.Validate(); err != nil {
-		code, _ := response.BadRequest()
-		c.JSON(code, err)
+		writeError(c, err)
+		return
+	}
+	track, err := m.trackService.PutTrackById(c, trackUuid, version, *trackPost, audio)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
+	setETag(c, track.Version)
+	c.JSON(response.OK(track))
+}
 
-	code, result := m.trackService.PutTrackById(c, trackUuid, trackPost, file)
-	if code == http.StatusOK && file != nil {
-		// if update success, upload file to audio dir
-		track := result.(model.Track)
-		audioDir := util.GetAudioDir() + "/" + track.ID
-		if _, err := os.Stat(audioDir); os.IsNotExist(err) {
-			os.MkdirAll(audioDir, 0755)
-		}
-		if err := c.SaveUploadedFile(file, audioDir+"/"+track.MP3File); err != nil {
-			log.Error(err)
-			c.JSON(response.ServiceUnavailableMsg(err.Error()))
-			return
-		}
+// PatchTrackById godoc
+// @Summary Patch track by id
+// @Description Update only the given metadata fields with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// @Tags track
+// @Id patch-track
+// @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Param If-Match header string true "ETag of the track"
+// @Param patch body object true "merge patch document or JSON Patch operations"
+// @Success 200 {object} model.Track
+// @Failure 400,404,409,412,413,415,428,500 {object} response.Problem
+// @Router /track/{id} [patch]
+func (m *Track) PatchTrackById(c *gin.Context) {
+	trackUuid := c.Param("id")
+	version, err := ifMatchVersion(c, m.trackVersion(c, trackUuid))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	patch, err := readPatch(c)
+	if err != nil {
+		writeError(c, err)
+		return
 	}
-	c.JSON(code, result)
+	track, err := m.trackService.PatchTrackById(c, trackUuid, version, patch)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setETag(c, track.Version)
+	c.JSON(response.OK(track))
 }
 
 // DownloadTrackById godoc
@@ -229,43 +281,82 @@ func (m *Track) PutTrackById(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Track ID"
 // @Success 200 {object} model.Track
+// @Failure 400,404,500 {object} response.Problem
 // @Router /track/{id}/download [get]
 func (m *Track) DownloadTrackById(c *gin.Context) {
 	trackUuid := c.Param("id")
 	if trackUuid == "" {
-		c.JSON(response.BadRequestMsg("id is missing"))
+		writeError(c, errMissingID)
 		c.Abort()
 		return
 	}
-	code, result := m.trackService.GetTrackById(c, trackUuid)
-	if code != http.StatusOK {
-		c.JSON(code, result)
+	download, err := m.trackService.DownloadTrack(c, trackUuid)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
-	track := result.(*model.Track)
-	audioDir := util.GetAudioDir() + "/" + trackUuid + "/" + track.MP3File
-	audioByte, err := os.ReadFile(audioDir)
+	defer download.Close()
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Track.MP3File))
+	c.Header("Content-Type", download.ContentType)
+	c.Header("Cache-Control", "no-cache, must-revalidate")
+	// no modification time, the tags of a download may change while the file does not
+	http.ServeContent(c.Writer, c.Request, download.Track.MP3File, time.Time{}, download)
+}
+
+// GetPlaybackHints godoc
+// @Summary Get track playback hints
+// @Description Get where the audio of the track starts and ends after its leading and trailing silence, and its gains, for gapless and crossfaded playback
+// @Tags track
+// @Id get-track-playback-hints
+// @Accept json
+// @Produce json
+// @Param id path string true "Track ID"
+// @Success 200 {object} model.PlaybackHints
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/playback-hints [get]
+func (m *Track) GetPlaybackHints(c *gin.Context) {
+	hints, err := m.trackService.GetPlaybackHints(c, c.Param("id"))
 	if err != nil {
-		c.JSON(response.ServiceUnavailableMsg(err.Error()))
+		writeError(c, err)
 		return
 	}
-	f, err := os.Open(audioDir)
-	if err != nil {
-		c.JSON(response.ServiceUnavailableMsg(err.Error()))
+	c.JSON(response.OK(hints))
+}
+
+// GetWaveform godoc
+// @Summary Get track waveform
+// @Description Get the min and max peaks of the track audio, as audiowaveform JSON or binary .dat
+// @Tags track
+// @Id get-track-waveform
+// @Accept json
+// @Produce json,octet-stream
+// @Param id path string true "Track ID"
+// @Param samples query int false "at most this many peak pairs, default 1000"
+// @Param format query string false "json or dat, default json"
+// @Success 200 {object} audio.Waveform
+// @Failure 400,404,500 {object} response.Problem
+// @Router /track/{id}/waveform [get]
+func (m *Track) GetWaveform(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "dat" {
+		writeError(c, errUnknownWaveformFormat)
 		return
 	}
-	defer f.Close()
-	fi, err := f.Stat()
+	trackUuid := c.Param("id")
+	waveform, err := m.trackService.GetWaveform(c, trackUuid, util.ParseInt(c.Query("samples")))
 	if err != nil {
-		c.JSON(response.ServiceUnavailableMsg(err.Error()))
+		writeError(c, err)
+		return
+	}
+	if format == "json" {
+		c.JSON(response.OK(waveform))
+		return
+	}
+	var body bytes.Buffer
+	if _, err := waveform.WriteTo(&body); err != nil {
+		writeError(c, apperror.Internal(err))
 		return
 	}
-	contentType := http.DetectContentType(audioByte[:512])
-	c.Writer.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%q", track.MP3File))
-	c.Writer.Header().Add("Content-Type", contentType)
-	c.Writer.Header().Add("Cache-Control", "no-cache, must-revalidate")
-	c.Writer.Header().Add("Accept-Ranges", "bytes")
-	c.Writer.Header().Add("Content-Length", fmt.Sprintf("%d", fi.Size()))
-	c.Data(http.StatusOK, contentType, audioByte)
-	return
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", trackUuid+".dat"))
+	c.Data(http.StatusOK, "application/octet-stream", body.Bytes())
 }
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"io"
+	"sample/common/apperror"
+	"sample/common/model"
+	"sample/common/util"
+	"sample/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxFormValueBytes bounds each text field of an upload form
+const maxFormValueBytes = 64 << 10
+
+var errFormValueTooLarge = apperror.TooLarge(apperror.CodeFormValueTooLarge, "each form field must be at most 64 KB")
+
+// readTrackForm reads a multipart track form part by part. The audio file is handed
+// to the track service as it arrives instead of being buffered by the form parser,
+// the caller closes it. Fields may come before or after the file. Url encoded forms
+// carry the fields only.
+func (m *Track) readTrackForm(c *gin.Context) (*model.TrackRequest, *service.UploadedAudio, error) {
+	if c.ContentType() != binding.MIMEMultipartPOSTForm {
+		if err := c.Request.ParseForm(); err != nil {
+			return nil, nil, errInvalidForm.Wrap(err)
+		}
+		return trackRequestOf(c.PostForm), nil, nil
+	}
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, nil, errInvalidForm.Wrap(err)
+	}
+	var upload *service.UploadedAudio
+	fail := func(err error) (*model.TrackRequest, *service.UploadedAudio, error) {
+		if upload != nil {
+			upload.Close()
+		}
+		return nil, nil, err
+	}
+	values := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(errInvalidForm.Wrap(err))
+		}
+		switch {
+		case part.FormName() == "mp3_file" && upload == nil:
+			fileType := part.Header.Get("Content-type")
+			switch fileType {
+			case "audio/mp3", "audio/mpeg", "audio/wav", "audio/flac", "audio/x-flac":
+			default:
+				return fail(errInvalidFileFormat)
+			}
+			if upload, err = m.trackService.ReceiveAudio(c, part, part.FileName()); err != nil {
+				return fail(err)
+			}
+		case len(part.FileName()) == 0:
+			// one byte more than allowed tells a field at the limit from a larger one
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueBytes+1))
+			if err != nil {
+				return fail(errInvalidForm.Wrap(err))
+			} else if len(value) > maxFormValueBytes {
+				return fail(errFormValueTooLarge)
+			}
+			values[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+	return trackRequestOf(func(key string) string { return values[key] }), upload, nil
+}
+
+func trackRequestOf(value func(key string) string) *model.TrackRequest {
+	return &model.TrackRequest{
+		Title:       value("title"),
+		Artist:      value("artist"),
+		Album:       value("album"),
+		Genre:       value("genre"),
+		ReleaseYear: util.ParseInt(value("release_year")),
+	}
+}
@@ -0,0 +1,212 @@
+package apperror
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/validator.v2"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindBadRequest
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindUnauthorized
+	KindUnsupportedMediaType
+	KindPreconditionFailed
+	KindPreconditionRequired
+	KindTooLarge
+)
+
+// Stable error codes returned to clients in the problem `code` member
+const (
+	CodeInternal             = "internal_error"
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeUnauthorized         = "unauthorized"
+	CodeMissingID            = "missing_id"
+	CodeInvalidQuery         = "invalid_query"
+	CodeMissingFile          = "missing_file"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidForm          = "invalid_form"
+	CodeInvalidFileFormat    = "invalid_file_format"
+	CodeInvalidAudio         = "invalid_audio"
+	CodeTrackNotFound        = "track_not_found"
+	CodePlaylistNotFound     = "playlist_not_found"
+	CodeEntryNotFound        = "playlist_entry_not_found"
+	CodeAudioNotFound        = "audio_file_not_found"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeVersionMismatch      = "version_mismatch"
+	CodeIfMatchRequired      = "if_match_required"
+	CodeSmartPlaylist        = "smart_playlist"
+	CodeRadioSessionNotFound = "radio_session_not_found"
+	CodeDuplicateAudio       = "duplicate_audio"
+	CodeWaveformUnavailable  = "waveform_unavailable"
+	CodeRenditionUnavailable = "rendition_unavailable"
+	CodeSegmentNotFound      = "hls_segment_not_found"
+	CodeInvalidImage         = "invalid_image"
+	CodeCoverNotFound        = "cover_not_found"
+	CodeUploadTooLarge       = "upload_too_large"
+	CodePatchTooLarge        = "patch_too_large"
+	CodeFormValueTooLarge    = "form_value_too_large"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error. Message and Fields are safe to show to clients,
+// the wrapped Err is only meant for logs.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns a copy of e carrying err as its internal cause
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func New(kind Kind, code, msg string) *Error {
+	return &Error{Kind: kind, Code: code, Message: msg}
+}
+
+func BadRequest(code, msg string) *Error {
+	return New(KindBadRequest, code, msg)
+}
+
+func NotFound(code, msg string) *Error {
+	return New(KindNotFound, code, msg)
+}
+
+func Conflict(code, msg string) *Error {
+	return New(KindConflict, code, msg)
+}
+
+func Unauthorized(code, msg string) *Error {
+	return New(KindUnauthorized, code, msg)
+}
+
+func UnsupportedMediaType(code, msg string) *Error {
+	return New(KindUnsupportedMediaType, code, msg)
+}
+
+func PreconditionFailed(code, msg string) *Error {
+	return New(KindPreconditionFailed, code, msg)
+}
+
+func PreconditionRequired(code, msg string) *Error {
+	return New(KindPreconditionRequired, code, msg)
+}
+
+func TooLarge(code, msg string) *Error {
+	return New(KindTooLarge, code, msg)
+}
+
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: "internal error", Err: err}
+}
+
+// Validation builds a validation error with field details from the errors
+// returned by validator.Validate(v). Field names are the json names of v.
+func Validation(err error, v any) *Error {
+	appErr := &Error{Kind: KindValidation, Code: CodeValidation, Message: "request validation failed", Err: err}
+	var errMap validator.ErrorMap
+	if !errors.As(err, &errMap) {
+		return appErr
+	}
+	names := jsonNames(v)
+	for field, errs := range errMap {
+		name, ok := names[field]
+		if !ok {
+			name = field
+		}
+		for _, fieldErr := range errs {
+			code, msg := validatorMessage(fieldErr)
+			appErr.Fields = append(appErr.Fields, FieldError{Field: name, Code: code, Message: msg})
+		}
+	}
+	sort.SliceStable(appErr.Fields, func(i, j int) bool {
+		return appErr.Fields[i].Field < appErr.Fields[j].Field
+	})
+	return appErr
+}
+
+// FieldValidation builds a validation error for fields checked by hand
+func FieldValidation(fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidation, Message: "request validation failed", Fields: fields}
+}
+
+func validatorMessage(err error) (string, string) {
+	switch err {
+	case validator.ErrZeroValue:
+		return "required", "is required"
+	case validator.ErrMin:
+		return "min", "is less than the minimum"
+	case validator.ErrMax:
+		return "max", "is greater than the maximum"
+	case validator.ErrLen:
+		return "len", "has an invalid length"
+	case validator.ErrRegexp:
+		return "format", "has an invalid format"
+	default:
+		return "invalid", "is invalid"
+	}
+}
+
+func jsonNames(v any) map[string]string {
+	names := map[string]string{}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			names[field.Name] = name
+		}
+	}
+	return names
+}
+
+// KindOf returns the kind of the first *Error in the chain of err,
+// errors which are not domain errors are internal
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
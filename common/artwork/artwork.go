@@ -0,0 +1,99 @@
+package artwork
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Sizes are the edges in pixels covers are stored at, smallest first
+var Sizes = []int{64, 300, 1000}
+
+// Format is a file format covers are stored in, named by its file extension
+type Format string
+
+const (
+	JPEG Format = "jpg"
+	WebP Format = "webp"
+)
+
+// Formats are the formats each cover is stored in, the first is the fallback
+// for clients which take no WebP
+var Formats = []Format{JPEG, WebP}
+
+const (
+	// MaxBytes bounds the size of an image file
+	MaxBytes = 10 << 20
+	// maxEdge bounds the edges of an image, checked before it is decoded
+	maxEdge = 8000
+	quality = 85
+)
+
+// ErrInvalidImage is returned for data which is no JPEG, PNG, GIF or WebP image of a sensible size
+var ErrInvalidImage = errors.New("image must be a JPEG, PNG, GIF or WebP of at most 8000 pixels per edge")
+
+// Decode validates and decodes an image, its size is checked before the pixels are
+func Decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width > maxEdge || config.Height > maxEdge {
+		return nil, ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return img, nil
+}
+
+// Square crops the center square out of img and scales it to size pixels
+func Square(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-edge)/2
+	y := bounds.Min.Y + (bounds.Dy()-edge)/2
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+edge, y+edge), draw.Src, nil)
+	return dst
+}
+
+// Mosaic tiles four images 2x2 into a square of size pixels, in reading order
+func Mosaic(images [4]image.Image, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	half := size / 2
+	for i, img := range images {
+		x, y := i%2*half, i/2*half
+		// the right and bottom tiles take the odd pixel
+		tile := image.Rect(x, y, x+half, y+half)
+		if i%2 == 1 {
+			tile.Max.X = size
+		}
+		if i/2 == 1 {
+			tile.Max.Y = size
+		}
+		draw.Draw(dst, tile, Square(img, tile.Dx()), image.Point{}, draw.Src)
+	}
+	return dst
+}
+
+// ContentType is the media type of the format
+func (f Format) ContentType() string {
+	if f == WebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// Encode writes img as a cover in the format
+func (f Format) Encode(w io.Writer, img image.Image) error {
+	if f == WebP {
+		return encodeWebP(w, img, quality)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
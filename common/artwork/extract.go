@@ -0,0 +1,296 @@
+package artwork
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// frontCover is the picture type of the front cover in ID3 and FLAC
+const frontCover = 3
+
+// maxTagSize bounds the tags and blocks read into memory for their pictures
+const maxTagSize = 16 << 20
+
+var errInvalidTag = errors.New("invalid picture tag")
+
+// Picture is an image embedded in an audio file
+type Picture struct {
+	MIMEType string
+	Type     byte
+	Data     []byte
+}
+
+// Extract returns the front cover embedded in an mp3, flac or wav file, or
+// its first picture when none is marked as front cover. It returns nil when
+// the file has no pictures.
+func Extract(r io.Reader) (*Picture, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(12)
+	if len(head) < 4 {
+		return nil, nil
+	}
+	var pictures []Picture
+	var err error
+	switch {
+	case bytes.Equal(head[0:3], []byte("ID3")):
+		pictures, err = readID3Pictures(br)
+	case bytes.Equal(head[0:4], []byte("fLaC")):
+		pictures, err = readFLACPictures(br)
+	case len(head) >= 12 && bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		pictures, err = readWAVPictures(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range pictures {
+		if pictures[i].Type == frontCover {
+			return &pictures[i], nil
+		}
+	}
+	if len(pictures) > 0 {
+		return &pictures[0], nil
+	}
+	return nil, nil
+}
+
+// readID3Pictures reads the APIC frames of an ID3v2.3 or v2.4 tag and the PIC
+// frames of an ID3v2.2 tag at the start of r
+func readID3Pictures(r io.Reader) ([]Picture, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errInvalidTag
+	}
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	if size > maxTagSize {
+		return nil, errInvalidTag
+	}
+	tag := make([]byte, size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, errInvalidTag
+	}
+	// before v2.4 unsynchronisation applies to the whole tag, since then to each frame
+	if flags&0x80 != 0 && version < 4 {
+		tag = unsynchronise(tag)
+	}
+	if flags&0x40 != 0 && version >= 3 {
+		if len(tag) < 4 {
+			return nil, errInvalidTag
+		}
+		extended := int(binary.BigEndian.Uint32(tag[0:4])) + 4
+		if version == 4 {
+			extended = syncsafe(tag[0:4])
+		}
+		if extended > len(tag) {
+			return nil, errInvalidTag
+		}
+		tag = tag[extended:]
+	}
+
+	pictures := make([]Picture, 0)
+	idLength, headerLength := 4, 10
+	if version == 2 {
+		idLength, headerLength = 3, 6
+	}
+	for len(tag) >= headerLength && tag[0] != 0 {
+		id := string(tag[0:idLength])
+		var frameSize int
+		var formatFlags byte
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:8]))
+			// compression, encryption and grouping become their v2.4 bits
+			formatFlags = (tag[9]&0x80)>>4 | (tag[9]&0x40)>>4 | (tag[9]&0x20)<<1
+		default:
+			frameSize = syncsafe(tag[4:8])
+			formatFlags = tag[9]
+		}
+		if frameSize < 0 || headerLength+frameSize > len(tag) {
+			return pictures, nil
+		}
+		frame := tag[headerLength : headerLength+frameSize]
+		tag = tag[headerLength+frameSize:]
+		if (id != "APIC" && id != "PIC") || formatFlags&0x0C != 0 {
+			continue
+		}
+		if formatFlags&0x40 != 0 && len(frame) > 0 {
+			frame = frame[1:]
+		}
+		if formatFlags&0x01 != 0 && len(frame) >= 4 {
+			frame = frame[4:]
+		}
+		if formatFlags&0x02 != 0 || (flags&0x80 != 0 && version == 4) {
+			frame = unsynchronise(frame)
+		}
+		if picture, ok := parsePictureFrame(frame, id == "PIC"); ok {
+			pictures = append(pictures, picture)
+		}
+	}
+	return pictures, nil
+}
+
+// parsePictureFrame reads an APIC frame, or a PIC frame which names the image
+// format with three letters instead of a MIME type
+func parsePictureFrame(frame []byte, pic bool) (Picture, bool) {
+	if len(frame) < 2 {
+		return Picture{}, false
+	}
+	encoding := frame[0]
+	frame = frame[1:]
+	var mimeType string
+	if pic {
+		if len(frame) < 3 {
+			return Picture{}, false
+		}
+		mimeType = "image/" + string(bytes.ToLower(frame[0:3]))
+		frame = frame[3:]
+	} else {
+		end := bytes.IndexByte(frame, 0)
+		if end < 0 {
+			return Picture{}, false
+		}
+		mimeType = string(frame[:end])
+		frame = frame[end+1:]
+	}
+	if len(frame) < 1 {
+		return Picture{}, false
+	}
+	pictureType := frame[0]
+	frame = frame[1:]
+
+	// the description ends with a null of the width of its encoding
+	if encoding == 1 || encoding == 2 {
+		end := -1
+		for i := 0; i+1 < len(frame); i += 2 {
+			if frame[i] == 0 && frame[i+1] == 0 {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return Picture{}, false
+		}
+		frame = frame[end+2:]
+	} else {
+		end := bytes.IndexByte(frame, 0)
+		if end < 0 {
+			return Picture{}, false
+		}
+		frame = frame[end+1:]
+	}
+	if len(frame) == 0 {
+		return Picture{}, false
+	}
+	return Picture{MIMEType: mimeType, Type: pictureType, Data: frame}, true
+}
+
+// readFLACPictures reads the PICTURE blocks of the metadata at the start of a flac file
+func readFLACPictures(r io.Reader) ([]Picture, error) {
+	if _, err := io.CopyN(io.Discard, r, 4); err != nil {
+		return nil, errInvalidTag
+	}
+	pictures := make([]Picture, 0)
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, errInvalidTag
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7F
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if blockType == 6 {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, errInvalidTag
+			}
+			if picture, ok := parsePictureBlock(block); ok {
+				pictures = append(pictures, picture)
+			}
+		} else if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return nil, errInvalidTag
+		}
+		if last {
+			return pictures, nil
+		}
+	}
+}
+
+func parsePictureBlock(block []byte) (Picture, bool) {
+	// the fields are big endian and prefixed by their length
+	field := func() ([]byte, bool) {
+		if len(block) < 4 {
+			return nil, false
+		}
+		length := int(binary.BigEndian.Uint32(block[0:4]))
+		if length < 0 || 4+length > len(block) {
+			return nil, false
+		}
+		value := block[4 : 4+length]
+		block = block[4+length:]
+		return value, true
+	}
+	if len(block) < 4 {
+		return Picture{}, false
+	}
+	pictureType := binary.BigEndian.Uint32(block[0:4])
+	block = block[4:]
+	mimeType, ok := field()
+	if !ok {
+		return Picture{}, false
+	}
+	if _, ok := field(); !ok {
+		return Picture{}, false
+	}
+	// width, height, color depth and palette size
+	if len(block) < 16 {
+		return Picture{}, false
+	}
+	block = block[16:]
+	data, ok := field()
+	if !ok || len(data) == 0 {
+		return Picture{}, false
+	}
+	return Picture{MIMEType: string(mimeType), Type: byte(pictureType), Data: data}, true
+}
+
+// readWAVPictures reads the pictures of the ID3 tag a wav file may carry in an "id3 " chunk
+func readWAVPictures(r io.Reader) ([]Picture, error) {
+	if _, err := io.CopyN(io.Discard, r, 12); err != nil {
+		return nil, errInvalidTag
+	}
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if id := string(header[0:4]); id == "id3 " || id == "ID3 " {
+			return readID3Pictures(io.LimitReader(r, size))
+		}
+		if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+			return nil, nil
+		}
+	}
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// unsynchronise drops the zero bytes inserted after 0xFF to keep false frame syncs out of tags
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
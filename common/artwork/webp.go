@@ -0,0 +1,716 @@
+package artwork
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// A lossy WebP encoder: one VP8 key frame, each macroblock predicted as a whole
+// by the best of the 16x16 and 8x8 intra modes, with the default token
+// probabilities and the normal loop filter. It is simpler than libwebp and
+// makes larger files at the same quality, but needs no cgo.
+
+// intra prediction modes of 16x16 luma and 8x8 chroma
+const (
+	vp8DC = iota
+	vp8V
+	vp8H
+	vp8TM
+	vp8Modes
+)
+
+// vp8MaxEdge bounds the edges of a VP8 frame, which are coded in 14 bits
+const vp8MaxEdge = 1<<14 - 1
+
+// boolEncoder is the boolean entropy encoder of section 7
+type boolEncoder struct {
+	out    []byte
+	rng    uint32
+	bottom uint32
+	bits   int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bits: 24}
+}
+
+// put codes bit, which is false with probability prob/256
+func (e *boolEncoder) put(bit bool, prob uint8) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.carry()
+		}
+		e.bottom <<= 1
+		e.bits--
+		if e.bits == 0 {
+			e.out = append(e.out, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bits = 8
+		}
+	}
+}
+
+func (e *boolEncoder) carry() {
+	i := len(e.out) - 1
+	for ; i >= 0 && e.out[i] == 255; i-- {
+		e.out[i] = 0
+	}
+	if i >= 0 {
+		e.out[i]++
+	}
+}
+
+// literal codes the n low bits of v, the highest first, at even odds
+func (e *boolEncoder) literal(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.put(v>>i&1 == 1, 128)
+	}
+}
+
+// flush writes out the bits still held and returns the coded bytes
+func (e *boolEncoder) flush() []byte {
+	v := e.bottom
+	if v&(1<<(32-e.bits)) != 0 {
+		e.carry()
+	}
+	v <<= e.bits & 7
+	for c := e.bits >> 3; c > 0; c-- {
+		v <<= 8
+	}
+	for i := 0; i < 4; i++ {
+		e.out = append(e.out, byte(v>>24))
+		v <<= 8
+	}
+	return e.out
+}
+
+// vp8Plane is one of the Y, U and V planes, padded to whole macroblocks
+type vp8Plane struct {
+	pix    []uint8
+	stride int
+}
+
+// vp8Macroblock holds the modes and the quantized coefficients of a macroblock,
+// each block of coefficients in raster order
+type vp8Macroblock struct {
+	yMode, uvMode int
+	y2            [16]int32
+	y             [16][16]int32
+	// the four U blocks and then the four V blocks
+	uv   [8][16]int32
+	skip bool
+}
+
+// vp8Steps are the quantizer steps of the DC and AC coefficients of a plane
+type vp8Steps [2]int32
+
+type vp8Encoder struct {
+	width, height int
+	mbw, mbh      int
+	// src and rec are the Y, U and V planes of the source and as the decoder rebuilds them
+	src, rec [3]vp8Plane
+	// index is the quantizer index of the frame
+	index  int
+	y1, y2 vp8Steps
+	uv     vp8Steps
+}
+
+// encodeWebP writes img as a lossy WebP, quality runs from 0 to 100
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	e, err := newVP8Encoder(img, quality)
+	if err != nil {
+		return err
+	}
+	frame := e.encode(vp8FilterLevel(e.index))
+
+	var riff bytes.Buffer
+	riff.WriteString("RIFF")
+	binary.Write(&riff, binary.LittleEndian, uint32(12+len(frame)+len(frame)%2))
+	riff.WriteString("WEBPVP8 ")
+	binary.Write(&riff, binary.LittleEndian, uint32(len(frame)))
+	riff.Write(frame)
+	if len(frame)%2 == 1 {
+		riff.WriteByte(0)
+	}
+	_, err = w.Write(riff.Bytes())
+	return err
+}
+
+func newVP8Encoder(img image.Image, quality int) (*vp8Encoder, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 || bounds.Dx() > vp8MaxEdge || bounds.Dy() > vp8MaxEdge {
+		return nil, errors.New("image size not supported by webp")
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Rect.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	}
+	index := vp8QuantIndex(quality)
+	e := &vp8Encoder{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		mbw:    (bounds.Dx() + 15) / 16,
+		mbh:    (bounds.Dy() + 15) / 16,
+		index:  index,
+		y1:     vp8Steps{vp8DCSteps[index], vp8ACSteps[index]},
+		y2:     vp8Steps{2 * vp8DCSteps[index], max(8, vp8ACSteps[index]*155/100)},
+		uv:     vp8Steps{vp8DCSteps[min(index, 117)], vp8ACSteps[index]},
+	}
+	e.convert(rgba)
+	return e, nil
+}
+
+// encode codes the image as a VP8 key frame, leaving the pixels the decoder
+// rebuilds before its loop filter in rec
+func (e *vp8Encoder) encode(filterLevel int) []byte {
+	mbs := make([]vp8Macroblock, 0, e.mbw*e.mbh)
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mbs = append(mbs, e.encodeMacroblock(mbx, mby))
+		}
+	}
+	return e.frame(mbs, filterLevel)
+}
+
+// vp8QuantIndex maps the quality to a quantizer index, 100 being the finest
+func vp8QuantIndex(quality int) int {
+	quality = max(0, min(100, quality))
+	return (100 - quality) * 127 / 100
+}
+
+// vp8FilterLevel strengthens the loop filter with the quantizer, coarser steps
+// leave stronger block edges
+func vp8FilterLevel(index int) int {
+	return min(63, index*2/5+4)
+}
+
+// convert fills the source planes with the BT.601 studio range YUV of img,
+// as libwebp does, repeating the last column and row up to whole macroblocks
+func (e *vp8Encoder) convert(img *image.RGBA) {
+	for i := range e.src {
+		edge := 16
+		if i > 0 {
+			edge = 8
+		}
+		e.src[i] = vp8Plane{pix: make([]uint8, edge*e.mbw*edge*e.mbh), stride: edge * e.mbw}
+		e.rec[i] = vp8Plane{pix: make([]uint8, edge*e.mbw*edge*e.mbh), stride: edge * e.mbw}
+	}
+	rgb := func(x, y int) (int32, int32, int32) {
+		x, y = min(x, e.width-1), min(y, e.height-1)
+		p := img.Pix[y*img.Stride+x*4:]
+		return int32(p[0]), int32(p[1]), int32(p[2])
+	}
+	y := e.src[0]
+	for j := 0; j < 16*e.mbh; j++ {
+		for i := 0; i < y.stride; i++ {
+			r, g, b := rgb(i, j)
+			y.pix[j*y.stride+i] = uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	u, v := e.src[1], e.src[2]
+	for j := 0; j < 8*e.mbh; j++ {
+		for i := 0; i < u.stride; i++ {
+			// the sums of 2x2 pixels
+			var r, g, b int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*i+d[0], 2*j+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			u.pix[j*u.stride+i] = clip8((-9719*r - 19081*g + 28800*b + 1<<17 + 128<<18) >> 18)
+			v.pix[j*v.stride+i] = clip8((28800*r - 24116*g - 4684*b + 1<<17 + 128<<18) >> 18)
+		}
+	}
+}
+
+func clip8(v int32) uint8 {
+	return uint8(max(0, min(255, v)))
+}
+
+// predict fills pred with the n x n prediction by mode of the macroblock at
+// mbx, mby from the rebuilt pixels around it. Beyond the top of the frame the
+// pixels are 127 and beyond the left 129, as in section 12.2.
+func predict(p *vp8Plane, n, mbx, mby, mode int, pred []uint8) {
+	x0, y0 := mbx*n, mby*n
+	top := func(i int) int32 {
+		if mby == 0 {
+			return 127
+		}
+		return int32(p.pix[(y0-1)*p.stride+x0+i])
+	}
+	left := func(j int) int32 {
+		if mbx == 0 {
+			return 129
+		}
+		return int32(p.pix[(y0+j)*p.stride+x0-1])
+	}
+	switch mode {
+	case vp8DC:
+		sum, count := int32(0), int32(0)
+		if mby > 0 {
+			for i := 0; i < n; i++ {
+				sum += top(i)
+			}
+			count += int32(n)
+		}
+		if mbx > 0 {
+			for j := 0; j < n; j++ {
+				sum += left(j)
+			}
+			count += int32(n)
+		}
+		dc := uint8(128)
+		if count > 0 {
+			dc = uint8((sum + count/2) / count)
+		}
+		for i := range pred[:n*n] {
+			pred[i] = dc
+		}
+	case vp8V:
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				pred[j*n+i] = uint8(top(i))
+			}
+		}
+	case vp8H:
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				pred[j*n+i] = uint8(left(j))
+			}
+		}
+	case vp8TM:
+		corner := int32(127)
+		if mby > 0 && mbx == 0 {
+			corner = 129
+		} else if mby > 0 {
+			corner = int32(p.pix[(y0-1)*p.stride+x0-1])
+		}
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				pred[j*n+i] = clip8(left(j) + top(i) - corner)
+			}
+		}
+	}
+}
+
+// bestMode picks the mode whose prediction is closest to the source of the planes
+func (e *vp8Encoder) bestMode(planes []int, n, mbx, mby int) (int, [][]uint8) {
+	bestMode, bestError := 0, int64(-1)
+	var best [][]uint8
+	for mode := 0; mode < vp8Modes; mode++ {
+		preds := make([][]uint8, len(planes))
+		sse := int64(0)
+		for k, plane := range planes {
+			preds[k] = make([]uint8, n*n)
+			predict(&e.rec[plane], n, mbx, mby, mode, preds[k])
+			src := &e.src[plane]
+			for j := 0; j < n; j++ {
+				for i := 0; i < n; i++ {
+					d := int64(src.pix[(mby*n+j)*src.stride+mbx*n+i]) - int64(preds[k][j*n+i])
+					sse += d * d
+				}
+			}
+		}
+		if bestError < 0 || sse < bestError {
+			bestMode, bestError, best = mode, sse, preds
+		}
+	}
+	return bestMode, best
+}
+
+// residual transforms the difference between the source and pred of the 4x4
+// block at bx, by of the macroblock
+func (e *vp8Encoder) residual(plane, n, mbx, mby, bx, by int, pred []uint8) [16]int32 {
+	src := &e.src[plane]
+	var block [16]int32
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			x, y := bx*4+i, by*4+j
+			block[j*4+i] = int32(src.pix[(mby*n+y)*src.stride+mbx*n+x]) - int32(pred[y*n+x])
+		}
+	}
+	return forwardDCT(block)
+}
+
+// rebuild adds the inverse transform of coeffs to pred and stores the block as
+// the decoder will see it
+func (e *vp8Encoder) rebuild(plane, n, mbx, mby, bx, by int, pred []uint8, coeffs [16]int32) {
+	rec := &e.rec[plane]
+	out := inverseDCT(coeffs)
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			x, y := bx*4+i, by*4+j
+			rec.pix[(mby*n+y)*rec.stride+mbx*n+x] = clip8(int32(pred[y*n+x]) + out[j*4+i])
+		}
+	}
+}
+
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) vp8Macroblock {
+	var mb vp8Macroblock
+
+	mode, preds := e.bestMode([]int{0}, 16, mbx, mby)
+	mb.yMode = mode
+	var coeffs [16][16]int32
+	var dcs [16]int32
+	for b := range coeffs {
+		coeffs[b] = e.residual(0, 16, mbx, mby, b%4, b/4, preds[0])
+		dcs[b] = coeffs[b][0]
+	}
+	// the DC coefficients of the luma blocks are coded apart, in the Y2 block
+	y2 := forwardWHT(dcs)
+	var dequantized [16]int32
+	for i := range y2 {
+		mb.y2[i] = quantize(y2[i], e.y2, i)
+		dequantized[i] = mb.y2[i] * e.y2[min(i, 1)]
+	}
+	dcs = inverseWHT(dequantized)
+	for b := range coeffs {
+		block := [16]int32{dcs[b]}
+		for i := 1; i < 16; i++ {
+			mb.y[b][i] = quantize(coeffs[b][i], e.y1, i)
+			block[i] = mb.y[b][i] * e.y1[1]
+		}
+		e.rebuild(0, 16, mbx, mby, b%4, b/4, preds[0], block)
+	}
+
+	mode, preds = e.bestMode([]int{1, 2}, 8, mbx, mby)
+	mb.uvMode = mode
+	for k := range mb.uv {
+		plane, b := 1+k/4, k%4
+		residual := e.residual(plane, 8, mbx, mby, b%2, b/2, preds[k/4])
+		var block [16]int32
+		for i := range residual {
+			mb.uv[k][i] = quantize(residual[i], e.uv, i)
+			block[i] = mb.uv[k][i] * e.uv[min(i, 1)]
+		}
+		e.rebuild(plane, 8, mbx, mby, b%2, b/2, preds[k/4], block)
+	}
+
+	mb.skip = mb.y2 == [16]int32{}
+	for b := range mb.y {
+		mb.skip = mb.skip && mb.y[b] == [16]int32{}
+	}
+	for k := range mb.uv {
+		mb.skip = mb.skip && mb.uv[k] == [16]int32{}
+	}
+	return mb
+}
+
+// quantize divides the coefficient at position i in raster order by its step,
+// rounding the AC coefficients towards zero a little more than the DC one
+func quantize(c int32, steps vp8Steps, i int) int32 {
+	step, bias := steps[1], steps[1]*110>>8
+	if i == 0 {
+		step, bias = steps[0], steps[0]>>1
+	}
+	q := min(2048, (abs32(c)+bias)/step)
+	if c < 0 {
+		return -q
+	}
+	return q
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// forwardDCT is the 4x4 transform of the reference encoder, whose output the
+// inverse transform of section 14.3 takes back
+func forwardDCT(in [16]int32) [16]int32 {
+	var tmp, out [16]int32
+	for i := 0; i < 4; i++ {
+		r := in[i*4 : i*4+4]
+		a, b := (r[0]+r[3])*8, (r[1]+r[2])*8
+		c, d := (r[1]-r[2])*8, (r[0]-r[3])*8
+		tmp[i*4+0] = a + b
+		tmp[i*4+2] = a - b
+		tmp[i*4+1] = (c*2217 + d*5352 + 14500) >> 12
+		tmp[i*4+3] = (d*2217 - c*5352 + 7500) >> 12
+	}
+	for i := 0; i < 4; i++ {
+		a, b := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		c, d := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a + b + 7) >> 4
+		out[8+i] = (a - b + 7) >> 4
+		out[4+i] = (c*2217 + d*5352 + 12000) >> 16
+		if d != 0 {
+			out[4+i]++
+		}
+		out[12+i] = (d*2217 - c*5352 + 51000) >> 16
+	}
+	return out
+}
+
+// inverseDCT is the inverse transform of section 14.3 as decoders compute it
+func inverseDCT(in [16]int32) [16]int32 {
+	const c1, c2 = 85627, 35468
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i]*c2)>>16 - (in[12+i]*c1)>>16
+		d := (in[4+i]*c1)>>16 + (in[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	var out [16]int32
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		out[j*4+0] = (a + d) >> 3
+		out[j*4+1] = (b + c) >> 3
+		out[j*4+2] = (b - c) >> 3
+		out[j*4+3] = (a - d) >> 3
+	}
+	return out
+}
+
+// walsh is the butterfly of the Walsh-Hadamard transform on four values
+func walsh(x0, x1, x2, x3 int32) (int32, int32, int32, int32) {
+	a0, a1, a2, a3 := x0+x3, x1+x2, x1-x2, x0-x3
+	return a0 + a1, a3 + a2, a0 - a1, a3 - a2
+}
+
+// forwardWHT transforms the DC coefficients of the 16 luma blocks, by half
+// the scale inverseWHT divides by
+func forwardWHT(in [16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := 0; i < 4; i++ {
+		m[i], m[4+i], m[8+i], m[12+i] = walsh(in[i], in[4+i], in[8+i], in[12+i])
+	}
+	for i := 0; i < 4; i++ {
+		r := m[i*4 : i*4+4]
+		a, b, c, d := walsh(r[0], r[1], r[2], r[3])
+		for k, v := range [4]int32{a, b, c, d} {
+			if v < 0 {
+				out[i*4+k] = -((-v + 1) >> 1)
+			} else {
+				out[i*4+k] = (v + 1) >> 1
+			}
+		}
+	}
+	return out
+}
+
+// inverseWHT is the inverse transform of section 14.3 as decoders compute it,
+// it returns the DC coefficient of each luma block
+func inverseWHT(in [16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := 0; i < 4; i++ {
+		m[i], m[4+i], m[8+i], m[12+i] = walsh(in[i], in[4+i], in[8+i], in[12+i])
+	}
+	for i := 0; i < 4; i++ {
+		r := m[i*4 : i*4+4]
+		a, b, c, d := walsh(r[0]+3, r[1], r[2], r[3])
+		out[i*4+0], out[i*4+1], out[i*4+2], out[i*4+3] = a>>3, b>>3, c>>3, d>>3
+	}
+	return out
+}
+
+// vp8Context tells which blocks along an edge of a macroblock have coefficients
+type vp8Context struct {
+	y    [4]uint8
+	u, v [2]uint8
+	y2   uint8
+}
+
+// frame codes the macroblocks as a VP8 key frame, section 9
+func (e *vp8Encoder) frame(mbs []vp8Macroblock, filterLevel int) []byte {
+	skipped := 0
+	for i := range mbs {
+		if mbs[i].skip {
+			skipped++
+		}
+	}
+
+	first := newBoolEncoder()
+	first.literal(0, 1) // color space
+	first.literal(0, 1) // clamping
+	first.literal(0, 1) // no segmentation
+	first.literal(0, 1) // the normal loop filter
+	first.literal(uint32(filterLevel), 6)
+	first.literal(0, 3) // sharpness
+	first.literal(0, 1) // no filter deltas
+	first.literal(0, 2) // one token partition
+	first.literal(uint32(e.index), 7)
+	for i := 0; i < 5; i++ {
+		first.literal(0, 1) // no quantizer deltas
+	}
+	first.literal(0, 1) // refresh the entropy probabilities
+	for i := range vp8UpdateProbs {
+		for j := range vp8UpdateProbs[i] {
+			for k := range vp8UpdateProbs[i][j] {
+				for _, prob := range vp8UpdateProbs[i][j][k] {
+					first.put(false, prob)
+				}
+			}
+		}
+	}
+	skipProb := uint8(0)
+	if skipped > 0 {
+		skipProb = uint8(max(1, min(254, 256*(len(mbs)-skipped)/len(mbs))))
+		first.literal(1, 1)
+		first.literal(uint32(skipProb), 8)
+	} else {
+		first.literal(0, 1)
+	}
+
+	tokens := newBoolEncoder()
+	above := make([]vp8Context, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		var left vp8Context
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &mbs[mby*e.mbw+mbx]
+			if skipped > 0 {
+				first.put(mb.skip, skipProb)
+			}
+			writeModes(first, mb)
+			if mb.skip {
+				left, above[mbx] = vp8Context{}, vp8Context{}
+				continue
+			}
+			writeCoefficients(tokens, mb, &left, &above[mbx])
+		}
+	}
+
+	part1, part2 := first.flush(), tokens.flush()
+	frame := make([]byte, 0, 10+len(part1)+len(part2))
+	// a shown key frame of version 0 and the size of the first partition
+	tag := uint32(len(part1))<<5 | 1<<4
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16))
+	frame = append(frame, 0x9d, 0x01, 0x2a)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(e.width))
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(e.height))
+	frame = append(frame, part1...)
+	return append(frame, part2...)
+}
+
+// writeModes codes the prediction modes of a macroblock with the fixed key
+// frame probabilities of section 11.2
+func writeModes(e *boolEncoder, mb *vp8Macroblock) {
+	e.put(true, 145) // not predicted by 4x4 blocks
+	switch mb.yMode {
+	case vp8DC, vp8V:
+		e.put(false, 156)
+		e.put(mb.yMode == vp8V, 163)
+	default:
+		e.put(true, 156)
+		e.put(mb.yMode == vp8TM, 128)
+	}
+	e.put(mb.uvMode != vp8DC, 142)
+	if mb.uvMode != vp8DC {
+		e.put(mb.uvMode != vp8V, 114)
+		if mb.uvMode != vp8V {
+			e.put(mb.uvMode == vp8TM, 183)
+		}
+	}
+}
+
+// writeCoefficients codes the blocks of a macroblock in the order of section 13:
+// Y2, the 16 luma blocks, then the four U and the four V blocks
+func writeCoefficients(e *boolEncoder, mb *vp8Macroblock, left, above *vp8Context) {
+	nz := writeBlock(e, &mb.y2, vp8PlaneY2, 0, left.y2+above.y2)
+	left.y2, above.y2 = nz, nz
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			nz := writeBlock(e, &mb.y[y*4+x], vp8PlaneY1WithY2, 1, left.y[y]+above.y[x])
+			left.y[y], above.y[x] = nz, nz
+		}
+	}
+	for k, plane := range []struct{ left, above *[2]uint8 }{{&left.u, &above.u}, {&left.v, &above.v}} {
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				nz := writeBlock(e, &mb.uv[k*4+y*2+x], vp8PlaneUV, 0, plane.left[y]+plane.above[x])
+				plane.left[y], plane.above[x] = nz, nz
+			}
+		}
+	}
+}
+
+// writeBlock codes the tokens of the coefficients of a block from position
+// first in zigzag order, and returns 1 when any of them is not zero
+func writeBlock(e *boolEncoder, coeffs *[16]int32, plane, first int, context uint8) uint8 {
+	probs := &vp8TokenProbs[plane]
+	last := -1
+	for n := first; n < 16; n++ {
+		if coeffs[vp8Zigzag[n]] != 0 {
+			last = n
+		}
+	}
+	p := probs[vp8Band[first]][context]
+	if last < 0 {
+		e.put(false, p[0]) // end of block
+		return 0
+	}
+	e.put(true, p[0])
+	for n := first; n <= last; n++ {
+		c := coeffs[vp8Zigzag[n]]
+		v := abs32(c)
+		if v == 0 {
+			e.put(false, p[1])
+			// no end of block can follow a zero
+			p = probs[vp8Band[n+1]][0]
+			continue
+		}
+		e.put(true, p[1])
+		e.put(v > 1, p[2])
+		if v > 1 {
+			writeLarge(e, &p, v)
+		}
+		e.put(c < 0, 128)
+		p = probs[vp8Band[n+1]][min(v, 2)]
+		if n < 15 {
+			e.put(n < last, p[0])
+		}
+	}
+	return 1
+}
+
+// vp8CategoryBase is the smallest value of each category of large coefficients
+var vp8CategoryBase = [6]int32{5, 7, 11, 19, 35, 67}
+
+// writeLarge codes a coefficient of 2 or more with the token tree of section 13.2
+func writeLarge(e *boolEncoder, p *[vp8Probs]uint8, v int32) {
+	if v <= 4 {
+		e.put(false, p[3])
+		e.put(v > 2, p[4])
+		if v > 2 {
+			e.put(v == 4, p[5])
+		}
+		return
+	}
+	cat := 0
+	for cat < 5 && v >= vp8CategoryBase[cat+1] {
+		cat++
+	}
+	e.put(true, p[3])
+	e.put(cat >= 2, p[6])
+	if cat < 2 {
+		e.put(cat == 1, p[7])
+	} else {
+		e.put(cat >= 4, p[8])
+		e.put(cat%2 == 1, p[9+cat/4])
+	}
+	extra, probs := v-vp8CategoryBase[cat], vp8Categories[cat]
+	for i, prob := range probs {
+		e.put(extra>>(len(probs)-1-i)&1 == 1, prob)
+	}
+}
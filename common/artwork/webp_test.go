@@ -0,0 +1,133 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/vp8"
+	"golang.org/x/image/webp"
+)
+
+func gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	return img
+}
+
+func noise(size int) image.Image {
+	random := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	random.Read(img.Pix)
+	return img
+}
+
+// lumaPSNR compares the luma of decoded with the studio range luma of img
+func lumaPSNR(img image.Image, decoded *image.YCbCr) float64 {
+	bounds := img.Bounds()
+	sse := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			want := (16839*int(r>>8) + 33059*int(g>>8) + 6420*int(b>>8) + 16<<16 + 1<<15) >> 16
+			d := float64(int(decoded.Y[decoded.YOffset(x, y)]) - want)
+			sse += d * d
+		}
+	}
+	if sse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255*float64(bounds.Dx()*bounds.Dy())/sse)
+}
+
+func TestEncodeWebP(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     image.Image
+		minPSNR float64
+	}{
+		{name: "one pixel", img: gradient(1, 1), minPSNR: 40},
+		{name: "odd size", img: gradient(17, 33), minPSNR: 35},
+		{name: "cover size", img: gradient(300, 300), minPSNR: 35},
+		{name: "offset bounds", img: gradient(40, 40).(*image.RGBA).SubImage(image.Rect(3, 5, 35, 29)), minPSNR: 35},
+		{name: "noise", img: noise(64), minPSNR: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WebP.Encode(&buf, tt.img); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("webp.Decode() error = %v", err)
+			}
+			ycbcr, ok := decoded.(*image.YCbCr)
+			if !ok || ycbcr.Bounds().Size() != tt.img.Bounds().Size() {
+				t.Fatalf("decoded %T of %v, want %v", decoded, decoded.Bounds().Size(), tt.img.Bounds().Size())
+			}
+			// the decoder keeps the origin at 0, 0
+			translated := image.NewRGBA(image.Rect(0, 0, tt.img.Bounds().Dx(), tt.img.Bounds().Dy()))
+			for y := 0; y < translated.Rect.Dy(); y++ {
+				for x := 0; x < translated.Rect.Dx(); x++ {
+					translated.Set(x, y, tt.img.At(tt.img.Bounds().Min.X+x, tt.img.Bounds().Min.Y+y))
+				}
+			}
+			if psnr := lumaPSNR(translated, ycbcr); psnr < tt.minPSNR {
+				t.Errorf("luma PSNR = %.1f dB, want at least %.0f dB", psnr, tt.minPSNR)
+			}
+		})
+	}
+	if err := WebP.Encode(&bytes.Buffer{}, image.NewRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Error("Encode() of an empty image error = nil, want an error")
+	}
+}
+
+// TestVP8Reconstruction checks the encoder predicts from the pixels the decoder
+// rebuilds, any difference would add up from macroblock to macroblock
+func TestVP8Reconstruction(t *testing.T) {
+	for _, quality := range []int{0, 50, 85, 100} {
+		for _, img := range []image.Image{gradient(45, 37), noise(48)} {
+			e, err := newVP8Encoder(img, quality)
+			if err != nil {
+				t.Fatalf("newVP8Encoder() error = %v", err)
+			}
+			frame := e.encode(0)
+			d := vp8.NewDecoder()
+			d.Init(bytes.NewReader(frame), len(frame))
+			if _, err := d.DecodeFrameHeader(); err != nil {
+				t.Fatalf("DecodeFrameHeader() error = %v", err)
+			}
+			decoded, err := d.DecodeFrame()
+			if err != nil {
+				t.Fatalf("DecodeFrame() error = %v", err)
+			}
+			planes := []struct {
+				pix    []uint8
+				stride int
+				width  int
+				height int
+			}{
+				{decoded.Y, decoded.YStride, e.width, e.height},
+				{decoded.Cb, decoded.CStride, (e.width + 1) / 2, (e.height + 1) / 2},
+				{decoded.Cr, decoded.CStride, (e.width + 1) / 2, (e.height + 1) / 2},
+			}
+			for i, plane := range planes {
+				for y := 0; y < plane.height; y++ {
+					for x := 0; x < plane.width; x++ {
+						if got, want := plane.pix[y*plane.stride+x], e.rec[i].pix[y*e.rec[i].stride+x]; got != want {
+							t.Fatalf("quality %d: plane %d at %d, %d decoded %d, want %d", quality, i, x, y, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
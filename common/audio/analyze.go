@@ -0,0 +1,27 @@
+package audio
+
+import "io"
+
+// Analyzer measures the interleaved samples of a decoder, see Analyze
+type Analyzer interface {
+	Process(samples []float32)
+}
+
+// Analyze decodes d to the end once and hands every block of samples to all analyzers
+func Analyze(d Decoder, analyzers ...Analyzer) error {
+	buf := make([]float32, 4096*max(d.Channels(), 1))
+	for {
+		n, err := d.Read(buf)
+		n -= n % max(d.Channels(), 1)
+		if n > 0 {
+			for _, analyzer := range analyzers {
+				analyzer.Process(buf[:n])
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+type Format string
+
+const (
+	FormatMP3  Format = "mp3"
+	FormatWAV  Format = "wav"
+	FormatFLAC Format = "flac"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown audio format")
+	// ErrNotDecodable is returned for formats which can be framed and hashed but not decoded to PCM
+	ErrNotDecodable = errors.New("audio format can not be decoded to PCM")
+)
+
+// Decoder reads interleaved PCM samples between -1 and 1
+type Decoder interface {
+	SampleRate() int
+	Channels() int
+	// Read fills samples and returns how many were read, io.EOF after the last one
+	Read(samples []float32) (int, error)
+}
+
+// decoders holds the PCM decoders by format
+var decoders = map[Format]func(r io.Reader) (Decoder, error){
+	FormatWAV:  newWAVDecoder,
+	FormatMP3:  newMP3Decoder,
+	FormatFLAC: newFLACDecoder,
+}
+
+// NewDecoder returns a PCM decoder of r, ErrNotDecodable when format has none
+func NewDecoder(r io.Reader, format Format) (Decoder, error) {
+	newDecoder, ok := decoders[format]
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	return newDecoder(r)
+}
+
+// Decodable tells whether audio of format can be decoded to PCM
+func Decodable(format Format) bool {
+	_, ok := decoders[format]
+	return ok
+}
+
+// DetectFormat guesses the format from the first bytes of a file, at least 12 are needed
+func DetectFormat(head []byte) (Format, error) {
+	switch {
+	case len(head) >= 12 && bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		return FormatWAV, nil
+	case len(head) >= 4 && bytes.Equal(head[0:4], []byte("fLaC")):
+		return FormatFLAC, nil
+	case len(head) >= 3 && bytes.Equal(head[0:3], []byte("ID3")):
+		return FormatMP3, nil
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return FormatMP3, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// ForEachMono mixes the channels of d down to mono, resamples them to rate
+// (0 keeps the rate of d) and hands them to fn in blocks
+func ForEachMono(d Decoder, rate int, fn func(block []float32) error) error {
+	if d.Channels() <= 0 || d.SampleRate() <= 0 {
+		return errors.New("invalid audio format")
+	}
+	resampler := newMonoResampler(d.SampleRate(), d.Channels(), rate)
+	buf := make([]float32, 4096*d.Channels())
+	for {
+		n, err := d.Read(buf)
+		if n > 0 {
+			if block := resampler.process(buf[:n]); len(block) > 0 {
+				if err := fn(block); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// monoResampler mixes interleaved samples down to mono and resamples them by linear interpolation
+type monoResampler struct {
+	channels int
+	step     float64
+	// work starts with the last sample of the previous block, so interpolation runs across blocks
+	work     []float32
+	out      []float32
+	position float64
+}
+
+// newMonoResampler converts from rate to outRate, 0 keeps the rate
+func newMonoResampler(rate, channels, outRate int) *monoResampler {
+	if outRate <= 0 {
+		outRate = rate
+	}
+	return &monoResampler{channels: channels, step: float64(rate) / float64(outRate)}
+}
+
+// process returns the output for samples, only valid until the next call
+func (r *monoResampler) process(samples []float32) []float32 {
+	n := len(samples) - len(samples)%r.channels
+	start := len(r.work)
+	for i := 0; i < n; i += r.channels {
+		sum := float32(0)
+		for c := 0; c < r.channels; c++ {
+			sum += samples[i+c]
+		}
+		r.work = append(r.work, sum/float32(r.channels))
+	}
+	if len(r.work) == start {
+		return nil
+	}
+	r.out = r.out[:0]
+	if r.step == 1 {
+		r.out = append(r.out, r.work[start:]...)
+		r.work = r.work[:0]
+		return r.out
+	}
+	for ; r.position < float64(len(r.work)-1); r.position += r.step {
+		index := int(r.position)
+		frac := float32(r.position - float64(index))
+		r.out = append(r.out, r.work[index]+(r.work[index+1]-r.work[index])*frac)
+	}
+	r.position -= float64(len(r.work) - 1)
+	r.work = append(r.work[:0], r.work[len(r.work)-1])
+	return r.out
+}
@@ -0,0 +1,109 @@
+package audio
+
+import (
+	"bufio"
+	"io"
+	"math"
+
+	"github.com/tcolgate/mp3"
+)
+
+// CutMP3 writes the frames of r from the one playing at start up to start+length
+// seconds to w, as they are. Tags and the Xing or Info frame are left out.
+func CutMP3(r io.Reader, w io.Writer, start, length float64) error {
+	end := start + length
+	position := 0.0
+	err := ForEachMP3Frame(r, func(frame *mp3.Frame) error {
+		frameStart := position
+		position += float64(frame.Samples()) / float64(frame.Header().SampleRate())
+		if position <= start {
+			return nil
+		} else if frameStart >= end {
+			return io.EOF
+		}
+		_, err := io.Copy(w, frame.Reader())
+		return err
+	})
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// CutWAV writes the samples of the wav file r from start up to start+length
+// seconds to w as a wav file of the same format
+func CutWAV(r io.Reader, w io.Writer, start, length float64) error {
+	format, data, err := ReadWAVHeader(r)
+	if err != nil {
+		return err
+	}
+	frameSize := int64(format.Channels * format.BitsPerSample / 8)
+	if frameSize <= 0 {
+		return errInvalidWAV
+	}
+	frames := data.N / frameSize
+	first := min(int64(math.Round(start*float64(format.SampleRate))), frames)
+	count := min(int64(math.Round(length*float64(format.SampleRate))), frames-first)
+	if format.AudioFormat == wavFormatExtensible {
+		// too short to name its sub format, which the plain fmt chunk of the cut can not carry
+		format.AudioFormat = wavFormatPCM
+	}
+
+	if _, err := io.CopyN(io.Discard, data, first*frameSize); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if err := WriteWAVHeader(bw, format, uint32(count*frameSize)); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(bw, data, count*frameSize); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Excerpt decodes start up to start+length seconds of d, fading in and out over
+// fade seconds
+func Excerpt(d Decoder, start, length, fade float64) Decoder {
+	rate := float64(d.SampleRate())
+	return &excerpt{
+		Decoder: d,
+		skip:    int64(math.Round(start * rate)),
+		frames:  int64(math.Round(length * rate)),
+		fade:    int64(math.Round(fade * rate)),
+	}
+}
+
+type excerpt struct {
+	Decoder
+	skip     int64 // frames left to skip
+	frames   int64 // frames of the excerpt
+	position int64
+	fade     int64
+}
+
+func (e *excerpt) Read(samples []float32) (int, error) {
+	channels := e.Channels()
+	for e.skip > 0 {
+		n, err := e.Decoder.Read(samples[:min(int64(len(samples)), e.skip*int64(channels))])
+		e.skip -= int64(n / channels)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if e.position >= e.frames {
+		return 0, io.EOF
+	}
+	limit := min(int64(len(samples)), (e.frames-e.position)*int64(channels))
+	n, err := e.Decoder.Read(samples[:limit])
+	for i := 0; i < n; i++ {
+		frame := e.position + int64(i/channels)
+		gain := 1.0
+		if e.fade > 0 {
+			gain = math.Min(1, math.Min(float64(frame)/float64(e.fade), float64(e.frames-frame)/float64(e.fade)))
+		}
+		samples[i] *= float32(gain)
+	}
+	e.position += int64(n / channels)
+	return n, err
+}
@@ -0,0 +1,183 @@
+package audio
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+	"math/bits"
+	"math/cmplx"
+
+	"github.com/tcolgate/mp3"
+)
+
+const (
+	fingerprintRate   = 11025
+	fingerprintFrame  = 4096
+	fingerprintHop    = fingerprintFrame / 3
+	fingerprintMinHz  = 28
+	fingerprintMaxHz  = 3520
+	fingerprintOffset = 40 // sub fingerprints two fingerprints may be shifted by when compared
+)
+
+// ContentHash hashes the audio data of r: the frames of an mp3 or flac file or
+// the samples of a wav file, so that retagging a file does not change its hash
+func ContentHash(r io.Reader, format Format) (string, error) {
+	hash := sha256.New()
+	switch format {
+	case FormatMP3:
+		err := ForEachMP3Frame(r, func(frame *mp3.Frame) error {
+			_, err := io.Copy(hash, frame.Reader())
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	case FormatWAV:
+		_, data, err := ReadWAVHeader(bufio.NewReader(r))
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, data); err != nil {
+			return "", err
+		}
+	case FormatFLAC:
+		br := bufio.NewReader(r)
+		if _, err := ReadFLACHeader(br); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, br); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrUnknownFormat
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// AcousticFingerprint computes a chromaprint style fingerprint of d: one 32 bit
+// sub fingerprint per ~124ms, built from how the energy of the 12 pitch classes
+// compares between neighbouring classes and between consecutive frames.
+// Unlike the content hash it survives re-encoding.
+func AcousticFingerprint(d Decoder) ([]uint32, error) {
+	window := hann(fingerprintFrame)
+	buf := make([]complex128, fingerprintFrame)
+	pending := make([]float32, 0, fingerprintFrame*2)
+	chroma := make([][12]float64, 0)
+
+	err := ForEachMono(d, fingerprintRate, func(block []float32) error {
+		pending = append(pending, block...)
+		for len(pending) >= fingerprintFrame {
+			for i := range buf {
+				buf[i] = complex(float64(pending[i])*window[i], 0)
+			}
+			chroma = append(chroma, chromaOf(buf))
+			pending = pending[:copy(pending, pending[fingerprintHop:])]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(chroma) < 2 {
+		return nil, nil
+	}
+
+	fingerprint := make([]uint32, len(chroma)-1)
+	for t := range fingerprint {
+		fingerprint[t] = subFingerprint(chroma[t], chroma[t+1])
+	}
+	return fingerprint, nil
+}
+
+// chromaOf returns the normalized energy of the 12 pitch classes in frame
+func chromaOf(frame []complex128) [12]float64 {
+	fft(frame)
+	var chroma [12]float64
+	binHz := float64(fingerprintRate) / float64(len(frame))
+	for bin := int(fingerprintMinHz / binHz); bin <= int(fingerprintMaxHz/binHz) && bin < len(frame)/2; bin++ {
+		if bin == 0 {
+			continue
+		}
+		note := 12*math.Log2(float64(bin)*binHz/440) + 69
+		class := int(math.Round(note)) % 12
+		if class < 0 {
+			class += 12
+		}
+		magnitude := cmplx.Abs(frame[bin])
+		chroma[class] += magnitude * magnitude
+	}
+	norm := 0.0
+	for _, v := range chroma {
+		norm += v * v
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range chroma {
+			chroma[i] /= norm
+		}
+	}
+	return chroma
+}
+
+// subFingerprint packs 32 comparisons of the chroma of two consecutive frames
+func subFingerprint(current, next [12]float64) uint32 {
+	var v uint32
+	bit := 0
+	set := func(b bool) {
+		if b {
+			v |= 1 << bit
+		}
+		bit++
+	}
+	for i := 0; i < 12; i++ {
+		set(current[i] > current[(i+1)%12])
+	}
+	for i := 0; i < 12; i++ {
+		set(next[i] > current[i])
+	}
+	for i := 0; i < 6; i++ {
+		set(current[i] > current[i+6])
+	}
+	low, high, currentSum, nextSum := 0.0, 0.0, 0.0, 0.0
+	for i := 0; i < 12; i++ {
+		if i < 6 {
+			low += current[i]
+		} else {
+			high += current[i]
+		}
+		currentSum += current[i]
+		nextSum += next[i]
+	}
+	set(low > high)
+	set(nextSum > currentSum)
+	return v
+}
+
+// CompareFingerprints returns the share of equal bits of a and b, between 0
+// and 1, at the best alignment of the two. Unrelated audio scores around 0.5.
+func CompareFingerprints(a, b []uint32) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	best := 0.0
+	for offset := -fingerprintOffset; offset <= fingerprintOffset; offset++ {
+		differing, compared := 0, 0
+		for i := range a {
+			j := i + offset
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			differing += bits.OnesCount32(a[i] ^ b[j])
+			compared++
+		}
+		// alignments sharing less than half of the shorter fingerprint say little
+		if compared == 0 || compared*2 < min(len(a), len(b)) {
+			continue
+		}
+		if score := 1 - float64(differing)/float64(32*compared); score > best {
+			best = score
+		}
+	}
+	return best
+}
@@ -0,0 +1,196 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// sliceDecoder decodes interleaved samples held in memory
+type sliceDecoder struct {
+	rate     int
+	channels int
+	samples  []float32
+}
+
+func (d *sliceDecoder) SampleRate() int {
+	return d.rate
+}
+
+func (d *sliceDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *sliceDecoder) Read(samples []float32) (int, error) {
+	if len(d.samples) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(samples, d.samples)
+	d.samples = d.samples[n:]
+	return n, nil
+}
+
+// melody renders notes, given as MIDI numbers, of noteSeconds each with two
+// harmonics, after lead seconds of silence, scaled by gain and with noise added
+func melody(rate int, notes []int, noteSeconds, lead, gain, noise float64) *sliceDecoder {
+	random := rand.New(rand.NewSource(1))
+	samples := make([]float32, int(lead*float64(rate)))
+	for _, note := range notes {
+		freq := 440 * math.Pow(2, float64(note-69)/12)
+		for i := 0; i < int(noteSeconds*float64(rate)); i++ {
+			x := 2 * math.Pi * freq * float64(i) / float64(rate)
+			v := 0.5*math.Sin(x) + 0.25*math.Sin(2*x) + 0.125*math.Sin(3*x)
+			samples = append(samples, float32(gain*v+noise*(2*random.Float64()-1)))
+		}
+	}
+	return &sliceDecoder{rate: rate, channels: 1, samples: samples}
+}
+
+func fingerprintOf(t *testing.T, d Decoder) []uint32 {
+	t.Helper()
+	fingerprint, err := AcousticFingerprint(d)
+	if err != nil {
+		t.Fatalf("AcousticFingerprint() error = %v", err)
+	}
+	return fingerprint
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	a := make([]uint32, 200)
+	for i := range a {
+		a[i] = random.Uint32()
+	}
+	unrelated := make([]uint32, 200)
+	for i := range unrelated {
+		unrelated[i] = random.Uint32()
+	}
+	inverted := make([]uint32, len(a))
+	for i := range a {
+		inverted[i] = ^a[i]
+	}
+	// every sub fingerprint off by four bits
+	noisy := make([]uint32, len(a))
+	for i := range a {
+		noisy[i] = a[i] ^ 0x01010101
+	}
+	// a few sub fingerprints of unrelated audio put in front
+	shifted := append(append([]uint32{}, unrelated[:10]...), a...)
+	tooFar := append(append([]uint32{}, unrelated[:fingerprintOffset+10]...), a...)
+	// the first part of a after unrelated audio, overlapping a[:20] by half or less
+	halfOverlap := append(append([]uint32{}, unrelated[:10]...), a[:10]...)
+	shortOverlap := append(append([]uint32{}, unrelated[:12]...), a[:8]...)
+
+	tests := []struct {
+		name     string
+		a, b     []uint32
+		min, max float64
+	}{
+		{name: "empty", a: nil, b: a, min: 0, max: 0},
+		{name: "identical", a: a, b: a, min: 1, max: 1},
+		{name: "inverted", a: a, b: inverted, min: 0, max: 0.6},
+		{name: "noisy", a: a, b: noisy, min: 0.875, max: 0.875},
+		{name: "shifted", a: a, b: shifted, min: 1, max: 1},
+		{name: "shifted the other way", a: shifted, b: a, min: 1, max: 1},
+		{name: "shifted too far", a: a, b: tooFar, min: 0.4, max: 0.6},
+		{name: "unrelated", a: a, b: unrelated, min: 0.4, max: 0.6},
+		{name: "prefix", a: a[:150], b: a, min: 1, max: 1},
+		{name: "overlap of half", a: a[:20], b: halfOverlap, min: 1, max: 1},
+		{name: "overlap below half", a: a[:20], b: shortOverlap, min: 0.3, max: 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareFingerprints(tt.a, tt.b); got < tt.min || got > tt.max {
+				t.Errorf("CompareFingerprints() = %.3f, want between %.3f and %.3f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestAcousticFingerprint(t *testing.T) {
+	const rate = 22050
+	tune := []int{60, 62, 64, 65, 67, 69, 71, 72, 71, 69, 67, 65, 64, 62, 60, 67, 64, 60, 72, 67}
+	other := []int{57, 57, 64, 64, 66, 66, 64, 62, 62, 61, 61, 59, 59, 57, 64, 62, 62, 61, 61, 59}
+	original := fingerprintOf(t, melody(rate, tune, 0.5, 0, 1, 0))
+
+	tests := []struct {
+		name      string
+		audio     Decoder
+		wantMatch bool
+	}{
+		{name: "same audio", audio: melody(rate, tune, 0.5, 0, 1, 0), wantMatch: true},
+		{name: "quieter", audio: melody(rate, tune, 0.5, 0, 0.3, 0), wantMatch: true},
+		{name: "with noise", audio: melody(rate, tune, 0.5, 0, 1, 0.02), wantMatch: true},
+		{name: "later start", audio: melody(rate, tune, 0.5, 1.5, 1, 0), wantMatch: true},
+		{name: "other sample rate", audio: melody(44100, tune, 0.5, 0, 1, 0), wantMatch: true},
+		{name: "other tune", audio: melody(rate, other, 0.5, 0, 1, 0), wantMatch: false},
+		{name: "transposed", audio: melody(rate, func() []int {
+			up := make([]int, len(tune))
+			for i := range tune {
+				up[i] = tune[i] + 5
+			}
+			return up
+		}(), 0.5, 0, 1, 0), wantMatch: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := CompareFingerprints(original, fingerprintOf(t, tt.audio))
+			// the duplicate detection takes 0.8 as the same recording
+			if match := score >= 0.8; match != tt.wantMatch {
+				t.Errorf("CompareFingerprints() = %.3f, want a match %v", score, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestAcousticFingerprintShortAudio(t *testing.T) {
+	fingerprint := fingerprintOf(t, &sliceDecoder{rate: 44100, channels: 2, samples: make([]float32, 2000)})
+	if len(fingerprint) != 0 {
+		t.Errorf("AcousticFingerprint() = %d sub fingerprints, want none", len(fingerprint))
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	samples := wavChunk{"data", littleEndian(int16(1), int16(2), int16(3), int16(4))}
+	plain := wavFile(fmtChunk(wavFormatPCM, 1, 8000, 16, 0), samples)
+	tagged := wavFile(wavChunk{"LIST", []byte("INFOINAM\x05\x00\x00\x00Song\x00")}, fmtChunk(wavFormatPCM, 1, 8000, 16, 0), samples)
+	changed := wavFile(fmtChunk(wavFormatPCM, 1, 8000, 16, 0), wavChunk{"data", littleEndian(int16(1), int16(2), int16(3), int16(5))})
+	frame := flacFrame{samples: [][]int64{{1, 2, 3, 4}}, subframes: []flacSubframe{{kind: "verbatim"}}}
+	otherFrame := flacFrame{samples: [][]int64{{1, 2, 3, 5}}, subframes: []flacSubframe{{kind: "verbatim"}}}
+
+	hash := func(file []byte) string {
+		t.Helper()
+		format, err := DetectFormat(file)
+		if err != nil {
+			t.Fatalf("DetectFormat() error = %v", err)
+		}
+		h, err := ContentHash(bytes.NewReader(file), format)
+		if err != nil {
+			t.Fatalf("ContentHash() error = %v", err)
+		}
+		return h
+	}
+	tests := []struct {
+		name  string
+		a, b  []byte
+		equal bool
+	}{
+		{name: "same file", a: plain, b: plain, equal: true},
+		{name: "other tags", a: plain, b: tagged, equal: true},
+		{name: "other samples", a: plain, b: changed, equal: false},
+		{name: "flac with other padding", a: flacFile(8000, 16, 0, frame), b: flacFile(8000, 16, 300, frame), equal: true},
+		{name: "flac with other samples", a: flacFile(8000, 16, 0, frame), b: flacFile(8000, 16, 0, otherFrame), equal: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := hash(tt.a) == hash(tt.b); equal != tt.equal {
+				t.Errorf("hashes equal = %v, want %v", equal, tt.equal)
+			}
+		})
+	}
+	if _, err := ContentHash(bytes.NewReader(plain), Format("ogg")); err != ErrUnknownFormat {
+		t.Errorf("ContentHash() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,517 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// flacStreamInfo is the type of the metadata block with the format of the stream
+const flacStreamInfo = 0
+
+var errInvalidFLAC = errors.New("invalid flac file")
+
+// FLACInfo is the STREAMINFO block of a flac file
+type FLACInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	// TotalSamples counts the samples of one channel, 0 when unknown
+	TotalSamples int64
+}
+
+// Duration returns the length in seconds of the stream
+func (i FLACInfo) Duration() float64 {
+	if i.SampleRate <= 0 {
+		return 0
+	}
+	return float64(i.TotalSamples) / float64(i.SampleRate)
+}
+
+// ReadFLACHeader reads the "fLaC" marker and the metadata blocks of r, which is
+// left at the first frame
+func ReadFLACHeader(r io.Reader) (FLACInfo, error) {
+	var info FLACInfo
+	var marker [4]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || string(marker[:]) != "fLaC" {
+		return info, errInvalidFLAC
+	}
+	haveInfo := false
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return info, errInvalidFLAC
+		}
+		last = header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		switch blockType {
+		case flacStreamInfo:
+			if size < 34 {
+				return info, errInvalidFLAC
+			}
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return info, errInvalidFLAC
+			}
+			// 20 bits of sample rate, 3 of channels-1, 5 of bits per sample-1, 36 of total samples
+			packed := binary.BigEndian.Uint64(block[10:18])
+			info = FLACInfo{
+				SampleRate:    int(packed >> 44),
+				Channels:      int(packed>>41&0x7) + 1,
+				BitsPerSample: int(packed>>36&0x1F) + 1,
+				TotalSamples:  int64(packed & 0xFFFFFFFFF),
+			}
+			haveInfo = true
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return info, errInvalidFLAC
+			}
+		}
+	}
+	if !haveInfo || info.SampleRate <= 0 || info.BitsPerSample < 4 {
+		return info, errInvalidFLAC
+	}
+	return info, nil
+}
+
+// flacBits reads big endian bit fields
+type flacBits struct {
+	r     io.ByteReader
+	cache uint64
+	n     uint
+}
+
+func (b *flacBits) bits(n uint) (uint64, error) {
+	for b.n < n {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.cache = b.cache<<8 | uint64(c)
+		b.n += 8
+	}
+	b.n -= n
+	v := b.cache >> b.n & (1<<n - 1)
+	b.cache &= 1<<b.n - 1
+	return v, nil
+}
+
+func (b *flacBits) signed(n uint) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	v, err := b.bits(n)
+	return int64(v<<(64-n)) >> (64 - n), err
+}
+
+// unary counts the zero bits up to the next one
+func (b *flacBits) unary() (uint64, error) {
+	count := uint64(0)
+	for {
+		bit, err := b.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// align drops the bits left of the current byte
+func (b *flacBits) align() {
+	b.n -= b.n % 8
+	b.cache &= 1<<b.n - 1
+}
+
+// channel assignments of a frame beyond the independent ones
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+var flacSampleSizes = [...]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+type flacDecoder struct {
+	info    FLACInfo
+	bits    flacBits
+	block   [][]int64
+	size    int
+	pos     int
+	scale   float32
+	lastErr error
+}
+
+func newFLACDecoder(r io.Reader) (Decoder, error) {
+	br := bufio.NewReader(r)
+	info, err := ReadFLACHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &flacDecoder{
+		info:  info,
+		bits:  flacBits{r: br},
+		block: make([][]int64, info.Channels),
+		scale: 1 / float32(int64(1)<<(info.BitsPerSample-1)),
+	}, nil
+}
+
+func (d *flacDecoder) SampleRate() int {
+	return d.info.SampleRate
+}
+
+func (d *flacDecoder) Channels() int {
+	return d.info.Channels
+}
+
+func (d *flacDecoder) Read(samples []float32) (int, error) {
+	channels := d.info.Channels
+	n := 0
+	for n+channels <= len(samples) {
+		if d.pos == d.size {
+			if d.lastErr != nil {
+				break
+			}
+			if err := d.readFrame(); err != nil {
+				d.lastErr = err
+				break
+			}
+			continue
+		}
+		for c := 0; c < channels; c++ {
+			samples[n+c] = float32(d.block[c][d.pos]) * d.scale
+		}
+		d.pos++
+		n += channels
+	}
+	if n == 0 {
+		if d.lastErr == nil {
+			return 0, io.EOF
+		}
+		return 0, d.lastErr
+	}
+	return n, nil
+}
+
+// readFrame decodes the next frame into block, io.EOF at the end of the stream
+func (d *flacDecoder) readFrame() error {
+	sync, err := d.bits.r.ReadByte()
+	if err == io.EOF {
+		return io.EOF
+	} else if err != nil {
+		return err
+	}
+	if sync != 0xFF {
+		return errInvalidFLAC
+	}
+	header, err := d.bits.bits(24)
+	if err != nil {
+		return err
+	}
+	if header>>17 != 0x7C {
+		return errInvalidFLAC
+	}
+	sizeCode := header >> 12 & 0xF
+	rateCode := header >> 8 & 0xF
+	assignment := int(header >> 4 & 0xF)
+	sampleSize := flacSampleSizes[header>>1&0x7]
+	if sampleSize == 0 {
+		sampleSize = d.info.BitsPerSample
+	}
+	if sampleSize != d.info.BitsPerSample {
+		return errors.New("unsupported change of flac sample size")
+	}
+
+	// the frame or sample number, coded like UTF-8
+	first, err := d.bits.bits(8)
+	if err != nil {
+		return err
+	}
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		if mask != 0x80 {
+			if _, err := d.bits.bits(8); err != nil {
+				return err
+			}
+		}
+	}
+
+	size := 0
+	switch {
+	case sizeCode == 1:
+		size = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		size = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		v, err := d.bits.bits(8)
+		if err != nil {
+			return err
+		}
+		size = int(v) + 1
+	case sizeCode == 7:
+		v, err := d.bits.bits(16)
+		if err != nil {
+			return err
+		}
+		size = int(v) + 1
+	case sizeCode >= 8:
+		size = 256 << (sizeCode - 8)
+	default:
+		return errInvalidFLAC
+	}
+	// the sample rate is taken from the stream info
+	switch rateCode {
+	case 12:
+		_, err = d.bits.bits(8)
+	case 13, 14:
+		_, err = d.bits.bits(16)
+	case 15:
+		err = errInvalidFLAC
+	}
+	if err != nil {
+		return err
+	}
+	// the CRC-8 of the header
+	if _, err := d.bits.bits(8); err != nil {
+		return err
+	}
+
+	channels := d.info.Channels
+	if assignment >= flacLeftSide {
+		if assignment > flacMidSide || channels != 2 {
+			return errInvalidFLAC
+		}
+	} else if assignment+1 != channels {
+		return errInvalidFLAC
+	}
+	for c := 0; c < channels; c++ {
+		bps := uint(sampleSize)
+		// the side channel takes one more bit
+		if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 || assignment == flacSideRight && c == 0 {
+			bps++
+		}
+		if cap(d.block[c]) < size {
+			d.block[c] = make([]int64, size)
+		}
+		d.block[c] = d.block[c][:size]
+		if err := d.readSubframe(d.block[c], bps); err != nil {
+			return err
+		}
+	}
+
+	switch assignment {
+	case flacLeftSide:
+		for i := 0; i < size; i++ {
+			d.block[1][i] = d.block[0][i] - d.block[1][i]
+		}
+	case flacSideRight:
+		for i := 0; i < size; i++ {
+			d.block[0][i] += d.block[1][i]
+		}
+	case flacMidSide:
+		for i := 0; i < size; i++ {
+			mid, side := d.block[0][i]<<1|d.block[1][i]&1, d.block[1][i]
+			d.block[0][i], d.block[1][i] = (mid+side)>>1, (mid-side)>>1
+		}
+	}
+
+	// the footer: padding up to a byte and the CRC-16 of the frame
+	d.bits.align()
+	if _, err := d.bits.bits(16); err != nil {
+		return err
+	}
+	d.size, d.pos = size, 0
+	return nil
+}
+
+func (d *flacDecoder) readSubframe(samples []int64, bps uint) error {
+	header, err := d.bits.bits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return errInvalidFLAC
+	}
+	kind := header >> 1 & 0x3F
+	wasted := uint(0)
+	if header&1 != 0 {
+		count, err := d.bits.unary()
+		if err != nil {
+			return err
+		}
+		wasted = uint(count) + 1
+		if wasted >= bps {
+			return errInvalidFLAC
+		}
+		bps -= wasted
+	}
+
+	switch {
+	case kind == 0:
+		v, err := d.bits.signed(bps)
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case kind == 1:
+		for i := range samples {
+			if samples[i], err = d.bits.signed(bps); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		if err := d.readFixed(samples, bps, int(kind-8)); err != nil {
+			return err
+		}
+	case kind >= 32:
+		if err := d.readLPC(samples, bps, int(kind-31)); err != nil {
+			return err
+		}
+	default:
+		return errInvalidFLAC
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// fixedCoefficients are the predictors of the fixed subframes by order
+var fixedCoefficients = [...][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+func (d *flacDecoder) readFixed(samples []int64, bps uint, order int) error {
+	if order > len(samples) {
+		return errInvalidFLAC
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.bits.signed(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+	if err := d.readResidual(samples, order); err != nil {
+		return err
+	}
+	predict(samples, fixedCoefficients[order], 0)
+	return nil
+}
+
+func (d *flacDecoder) readLPC(samples []int64, bps uint, order int) error {
+	if order > len(samples) {
+		return errInvalidFLAC
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.bits.signed(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+	precision, err := d.bits.bits(4)
+	if err != nil {
+		return err
+	}
+	if precision == 15 {
+		return errInvalidFLAC
+	}
+	shift, err := d.bits.signed(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return errInvalidFLAC
+	}
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		if coefficients[i], err = d.bits.signed(uint(precision) + 1); err != nil {
+			return err
+		}
+	}
+	if err := d.readResidual(samples, order); err != nil {
+		return err
+	}
+	predict(samples, coefficients, uint(shift))
+	return nil
+}
+
+// predict adds to the residuals after the warm up samples the prediction of
+// the samples before them
+func predict(samples []int64, coefficients []int64, shift uint) {
+	order := len(coefficients)
+	for i := order; i < len(samples); i++ {
+		sum := int64(0)
+		for j, c := range coefficients {
+			sum += c * samples[i-1-j]
+		}
+		samples[i] += sum >> shift
+	}
+}
+
+// readResidual reads the rice coded residuals of samples after the first order ones
+func (d *flacDecoder) readResidual(samples []int64, order int) error {
+	method, err := d.bits.bits(2)
+	if err != nil {
+		return err
+	}
+	paramBits, escape := uint(4), uint64(15)
+	switch method {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return errInvalidFLAC
+	}
+	partitionOrder, err := d.bits.bits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	if len(samples)%partitions != 0 || len(samples)/partitions < order {
+		return errInvalidFLAC
+	}
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * len(samples) / partitions
+		param, err := d.bits.bits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			width, err := d.bits.bits(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if samples[i], err = d.bits.signed(uint(width)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			high, err := d.bits.unary()
+			if err != nil {
+				return err
+			}
+			low, err := d.bits.bits(uint(param))
+			if err != nil {
+				return err
+			}
+			u := high<<param | low
+			samples[i] = int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// bitWriter packs big endian bit fields
+type bitWriter struct {
+	buf []byte
+	n   uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := n; i > 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>(i-1)&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) signed(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *bitWriter) unary(zeros uint64) {
+	for i := uint64(0); i < zeros; i++ {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *bitWriter) align() {
+	w.n += (8 - w.n%8) % 8
+}
+
+// flacSubframe tells how encodeSubframe codes the samples of a channel
+type flacSubframe struct {
+	kind           string // constant, verbatim, fixed or lpc
+	order          int
+	coefficients   []int64
+	precision      uint
+	shift          uint
+	wasted         uint
+	partitionOrder uint
+	escape         bool
+}
+
+// flacFrame is a block of samples by channel, before the stereo decorrelation
+type flacFrame struct {
+	samples    [][]int64
+	assignment int
+	subframes  []flacSubframe
+}
+
+// flacFile encodes frames as a flac file, with a padding block after the stream
+// info. The checksums are left zero, as the decoder does not check them.
+func flacFile(rate, bps int, padding int, frames ...flacFrame) []byte {
+	channels, total := len(frames[0].samples), 0
+	for _, frame := range frames {
+		total += len(frame.samples[0])
+	}
+	file := []byte("fLaC")
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:18], uint64(rate)<<44|uint64(channels-1)<<41|uint64(bps-1)<<36|uint64(total))
+	file = append(file, 0, 0, 0, 34)
+	file = append(file, info...)
+	file = append(file, 0x80|1, byte(padding>>16), byte(padding>>8), byte(padding))
+	file = append(file, make([]byte, padding)...)
+
+	for number, frame := range frames {
+		size := len(frame.samples[0])
+		assignment := frame.assignment
+		if assignment == 0 {
+			assignment = channels - 1
+		}
+		w := &bitWriter{}
+		w.write(0xFFF8, 16)
+		w.write(7, 4) // the block size follows in 16 bits
+		w.write(0, 4) // the sample rate of the stream info
+		w.write(uint64(assignment), 4)
+		w.write(0, 4) // the sample size of the stream info
+		w.write(uint64(number), 8)
+		w.write(uint64(size-1), 16)
+		w.write(0, 8)
+		for c, samples := range decorrelate(frame.samples, assignment) {
+			width := uint(bps)
+			if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 || assignment == flacSideRight && c == 0 {
+				width++
+			}
+			encodeSubframe(w, samples, width, frame.subframes[c])
+		}
+		w.align()
+		w.write(0, 16)
+		file = append(file, w.buf...)
+	}
+	return file
+}
+
+func decorrelate(samples [][]int64, assignment int) [][]int64 {
+	if assignment < flacLeftSide {
+		return samples
+	}
+	left, right := samples[0], samples[1]
+	a, b := make([]int64, len(left)), make([]int64, len(left))
+	for i := range left {
+		switch assignment {
+		case flacLeftSide:
+			a[i], b[i] = left[i], left[i]-right[i]
+		case flacSideRight:
+			a[i], b[i] = left[i]-right[i], right[i]
+		case flacMidSide:
+			a[i], b[i] = (left[i]+right[i])>>1, left[i]-right[i]
+		}
+	}
+	return [][]int64{a, b}
+}
+
+func encodeSubframe(w *bitWriter, samples []int64, bps uint, sf flacSubframe) {
+	kinds := map[string]uint64{"constant": 0, "verbatim": 1, "fixed": 8 + uint64(sf.order), "lpc": 31 + uint64(sf.order)}
+	w.write(0, 1)
+	w.write(kinds[sf.kind], 6)
+	if sf.wasted > 0 {
+		w.write(1, 1)
+		w.unary(uint64(sf.wasted - 1))
+		shifted := make([]int64, len(samples))
+		for i := range samples {
+			shifted[i] = samples[i] >> sf.wasted
+		}
+		samples, bps = shifted, bps-sf.wasted
+	} else {
+		w.write(0, 1)
+	}
+
+	coefficients, shift := fixedCoefficients[0], uint(0)
+	switch sf.kind {
+	case "constant":
+		w.signed(samples[0], bps)
+		return
+	case "verbatim":
+		for _, s := range samples {
+			w.signed(s, bps)
+		}
+		return
+	case "fixed":
+		coefficients = fixedCoefficients[sf.order]
+	case "lpc":
+		coefficients, shift = sf.coefficients, sf.shift
+	}
+	for _, s := range samples[:sf.order] {
+		w.signed(s, bps)
+	}
+	if sf.kind == "lpc" {
+		w.write(uint64(sf.precision-1), 4)
+		w.signed(int64(sf.shift), 5)
+		for _, c := range sf.coefficients {
+			w.signed(c, sf.precision)
+		}
+	}
+
+	w.write(0, 2)
+	w.write(uint64(sf.partitionOrder), 4)
+	partitions := 1 << sf.partitionOrder
+	i := sf.order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * len(samples) / partitions
+		if sf.escape {
+			w.write(15, 4)
+			w.write(uint64(bps+2), 5)
+		} else {
+			w.write(3, 4)
+		}
+		for ; i < end; i++ {
+			sum := int64(0)
+			for j, c := range coefficients {
+				sum += c * samples[i-1-j]
+			}
+			residual := samples[i] - sum>>shift
+			if sf.escape {
+				w.signed(residual, bps+2)
+				continue
+			}
+			u := uint64(residual<<1 ^ residual>>63)
+			w.unary(u >> 3)
+			w.write(u&7, 3)
+		}
+	}
+}
+
+// flacWave is a sine of amplitude scaled to the multiple of step below it
+func flacWave(n int, amplitude float64, period float64, step int64) []int64 {
+	samples := make([]int64, n)
+	for i := range samples {
+		samples[i] = int64(amplitude*math.Sin(2*math.Pi*float64(i)/period)) / step * step
+	}
+	return samples
+}
+
+func TestFLACDecoder(t *testing.T) {
+	mono := func(sf flacSubframe) []flacSubframe { return []flacSubframe{sf} }
+	stereo := []flacSubframe{{kind: "fixed", order: 2}, {kind: "fixed", order: 1}}
+	left, right := flacWave(300, 20000, 40, 1), flacWave(300, 12000, 25, 1)
+
+	tests := []struct {
+		name   string
+		bps    int
+		frames []flacFrame
+	}{
+		{name: "constant", bps: 16, frames: []flacFrame{{samples: [][]int64{{-7, -7, -7, -7}}, subframes: mono(flacSubframe{kind: "constant"})}}},
+		{name: "verbatim", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(50, 30000, 9, 1)}, subframes: mono(flacSubframe{kind: "verbatim"})}}},
+		{name: "fixed order 0", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 0})}}},
+		{name: "fixed order 1", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 1})}}},
+		{name: "fixed order 2", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 2})}}},
+		{name: "fixed order 3", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 3})}}},
+		{name: "fixed order 4", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 4})}}},
+		{name: "lpc", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(128, 25000, 32, 1)},
+			subframes: mono(flacSubframe{kind: "lpc", order: 2, coefficients: []int64{1924, -1024}, precision: 12, shift: 10})}}},
+		{name: "partitions", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 2, partitionOrder: 2})}}},
+		{name: "escaped partitions", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 30000, 5, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 1, partitionOrder: 1, escape: true})}}},
+		{name: "wasted bits", bps: 16, frames: []flacFrame{{samples: [][]int64{flacWave(64, 20000, 16, 8)}, subframes: mono(flacSubframe{kind: "verbatim", wasted: 3})}}},
+		{name: "24 bit", bps: 24, frames: []flacFrame{{samples: [][]int64{flacWave(64, 8000000, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 2, escape: true})}}},
+		{name: "frames", bps: 16, frames: []flacFrame{
+			{samples: [][]int64{flacWave(40, 100, 16, 1)}, subframes: mono(flacSubframe{kind: "fixed", order: 2})},
+			{samples: [][]int64{flacWave(17, 1000, 8, 1)}, subframes: mono(flacSubframe{kind: "verbatim"})},
+		}},
+		{name: "independent stereo", bps: 16, frames: []flacFrame{{samples: [][]int64{left, right}, subframes: []flacSubframe{{kind: "verbatim"}, {kind: "verbatim"}}}}},
+		{name: "left side", bps: 16, frames: []flacFrame{{samples: [][]int64{left, right}, assignment: flacLeftSide, subframes: stereo}}},
+		{name: "side right", bps: 16, frames: []flacFrame{{samples: [][]int64{left, right}, assignment: flacSideRight, subframes: stereo}}},
+		{name: "mid side", bps: 16, frames: []flacFrame{{samples: [][]int64{left, right}, assignment: flacMidSide, subframes: stereo}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []float32
+			channels := len(tt.frames[0].samples)
+			for _, frame := range tt.frames {
+				for i := range frame.samples[0] {
+					for c := 0; c < channels; c++ {
+						want = append(want, float32(frame.samples[c][i])/float32(int64(1)<<(tt.bps-1)))
+					}
+				}
+			}
+
+			file := flacFile(44100, tt.bps, 10, tt.frames...)
+			d, err := NewDecoder(bytes.NewReader(file), FormatFLAC)
+			if err != nil {
+				t.Fatalf("NewDecoder() error = %v", err)
+			}
+			if d.Channels() != channels || d.SampleRate() != 44100 {
+				t.Errorf("format = %d channels at %d Hz, want %d at 44100 Hz", d.Channels(), d.SampleRate(), channels)
+			}
+			samples := decodeAll(t, d)
+			if len(samples) != len(want) {
+				t.Fatalf("decoded %d samples, want %d", len(samples), len(want))
+			}
+			for i := range want {
+				if samples[i] != want[i] {
+					t.Fatalf("sample %d = %v, want %v", i, samples[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFLACDecoderErrors(t *testing.T) {
+	valid := flacFile(8000, 16, 0, flacFrame{samples: [][]int64{flacWave(64, 100, 16, 1)}, subframes: []flacSubframe{{kind: "verbatim"}}})
+	// the frames start after the marker, two block headers and the stream info
+	frames := 4 + 4 + 34 + 4
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "truncated frame", file: valid[:len(valid)-20]},
+		{name: "lost sync", file: append(append([]byte{}, valid[:frames]...), 0xFE, 0xF8, 0x70, 0x00)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecoder(bytes.NewReader(tt.file), FormatFLAC)
+			if err != nil {
+				t.Fatalf("NewDecoder() error = %v", err)
+			}
+			buf := make([]float32, 4096)
+			for err == nil {
+				_, err = d.Read(buf)
+			}
+			if err == io.EOF {
+				t.Error("Read() error = io.EOF, want an error")
+			}
+		})
+	}
+
+	for name, file := range map[string][]byte{
+		"not flac":       []byte("OggS\x00\x02\x00\x00"),
+		"no stream info": {'f', 'L', 'a', 'C', 0x81, 0, 0, 2, 0, 0},
+		"truncated":      valid[:20],
+	} {
+		if _, err := NewDecoder(bytes.NewReader(file), FormatFLAC); err == nil {
+			t.Errorf("NewDecoder() of %s error = nil, want an error", name)
+		}
+	}
+}
+
+func TestReadFLACHeader(t *testing.T) {
+	frame := flacFrame{samples: [][]int64{flacWave(4410, 100, 16, 1), flacWave(4410, 100, 16, 1)}, subframes: []flacSubframe{{kind: "constant"}, {kind: "constant"}}}
+	file := flacFile(44100, 24, 100, frame, frame, frame)
+	r := bytes.NewReader(file)
+	info, err := ReadFLACHeader(r)
+	if err != nil {
+		t.Fatalf("ReadFLACHeader() error = %v", err)
+	}
+	want := FLACInfo{SampleRate: 44100, Channels: 2, BitsPerSample: 24, TotalSamples: 3 * 4410}
+	if info != want {
+		t.Errorf("ReadFLACHeader() = %+v, want %+v", info, want)
+	}
+	if info.Duration() != 0.3 {
+		t.Errorf("Duration() = %v, want 0.3", info.Duration())
+	}
+	if rest := r.Len(); rest != len(file)-4-38-104 {
+		t.Errorf("ReadFLACHeader() left %d bytes, want the frames", rest)
+	}
+}
@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const (
+	keyFrame = 4096
+	keyHop   = 2048
+)
+
+var pitchClasses = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// flats are written as the sharp of the same pitch class
+var flatPitchClasses = map[string]string{"Db": "C#", "Eb": "D#", "Gb": "F#", "Ab": "G#", "Bb": "A#", "Cb": "B", "Fb": "E"}
+
+// Krumhansl-Kessler key profiles, starting at the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+var errInvalidKey = errors.New("invalid musical key")
+
+// KeyDetector estimates the musical key by correlating the chroma of the
+// audio with the major and minor key profiles
+type KeyDetector struct {
+	resampler *monoResampler
+	window    []float64
+	pending   []float32
+	buf       []complex128
+	chroma    [12]float64
+}
+
+func NewKeyDetector(rate, channels int) *KeyDetector {
+	return &KeyDetector{
+		resampler: newMonoResampler(rate, channels, fingerprintRate),
+		window:    hann(keyFrame),
+		buf:       make([]complex128, keyFrame),
+	}
+}
+
+func (k *KeyDetector) Process(samples []float32) {
+	k.pending = append(k.pending, k.resampler.process(samples)...)
+	for len(k.pending) >= keyFrame {
+		for i := range k.buf {
+			k.buf[i] = complex(float64(k.pending[i])*k.window[i], 0)
+		}
+		// frames are normalized so loud passages do not outweigh the rest
+		for class, v := range chromaOf(k.buf) {
+			k.chroma[class] += v
+		}
+		k.pending = k.pending[:copy(k.pending, k.pending[keyHop:])]
+	}
+}
+
+// Key returns the most likely key like "A minor", empty for audio without pitch
+func (k *KeyDetector) Key() string {
+	best, bestScore := "", 0.0
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []struct {
+			name    string
+			profile [12]float64
+		}{{"major", majorProfile}, {"minor", minorProfile}} {
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[i] = k.chroma[(tonic+i)%12]
+			}
+			if score := correlate(rotated[:], mode.profile[:]); score > bestScore {
+				best, bestScore = pitchClasses[tonic]+" "+mode.name, score
+			}
+		}
+	}
+	return best
+}
+
+// correlate returns the Pearson correlation of a and b, 0 when either is constant
+func correlate(a, b []float64) float64 {
+	meanA, meanB := 0.0, 0.0
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// ParseKey normalizes a key like "Am", "a min", "Bb major" or "A# minor" to the
+// form returned by KeyDetector.Key, "A minor" or "A# major"
+func ParseKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return "", errInvalidKey
+	}
+	tonic := strings.ToUpper(key[:1])
+	rest := key[1:]
+	if len(rest) > 0 && (rest[0] == '#' || rest[0] == 'b') {
+		tonic += rest[:1]
+		rest = rest[1:]
+	}
+	if sharp, ok := flatPitchClasses[tonic]; ok {
+		tonic = sharp
+	}
+	valid := false
+	for _, class := range pitchClasses {
+		valid = valid || class == tonic
+	}
+	if !valid {
+		return "", errInvalidKey
+	}
+	switch strings.ToLower(strings.TrimSpace(rest)) {
+	case "", "maj", "major":
+		return tonic + " major", nil
+	case "m", "min", "minor":
+		return tonic + " minor", nil
+	}
+	return "", errInvalidKey
+}
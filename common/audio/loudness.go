@@ -0,0 +1,305 @@
+package audio
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// SilenceFloor is reported for loudness and peaks of silent audio, in LUFS and dBTP
+	SilenceFloor = -70.0
+
+	absoluteGate      = -70.0
+	integratedGate    = -10.0 // relative to the ungated loudness of the blocks above the absolute gate
+	rangeGate         = -20.0
+	histogramMin      = absoluteGate
+	histogramMax      = 5.0
+	histogramBinWidth = 0.1
+	oversampling      = 4
+	oversamplingTaps  = 12 // taps per phase of the true peak interpolation filter
+)
+
+// HistogramBins is the length of Loudness.Histogram
+var HistogramBins = int((histogramMax - histogramMin) / histogramBinWidth)
+
+// Loudness is the EBU R128 measurement of a piece of audio
+type Loudness struct {
+	Integrated float64 // LUFS
+	Range      float64 // LU
+	TruePeak   float64 // dBTP
+	SamplePeak float64 // linear, 1 is full scale
+	// Histogram counts the 400ms blocks above the absolute gate in 0.1 LU bins
+	// from -70 LUFS, so that the loudness of several tracks can be combined
+	Histogram []uint32
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stages of the BS.1770 K-weighting filter for rate
+func kWeighting(rate int) [2]biquad {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / float64(rate))
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / float64(rate))
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// LoudnessMeter measures integrated loudness, loudness range and true peak
+// following EBU R128, from 100ms sub blocks of K-weighted power
+type LoudnessMeter struct {
+	rate     int
+	channels int
+	weights  []float64
+	filters  [][2]biquad
+
+	subBlockSize int
+	subBlockFill int
+	subBlockSum  float64
+	subBlocks    []float64 // mean weighted power of every 100ms
+
+	samplePeak float64
+	truePeak   float64
+	taps       [oversampling][oversamplingTaps]float64
+	history    [][]float64
+}
+
+func NewLoudnessMeter(rate, channels int) *LoudnessMeter {
+	m := &LoudnessMeter{
+		rate:         rate,
+		channels:     channels,
+		weights:      make([]float64, channels),
+		filters:      make([][2]biquad, channels),
+		subBlockSize: max(int(math.Round(float64(rate)/10)), 1),
+		history:      make([][]float64, channels),
+	}
+	for c := range m.weights {
+		m.weights[c] = 1
+		m.filters[c] = kWeighting(rate)
+		m.history[c] = make([]float64, oversamplingTaps)
+	}
+	// in 5.1 wav files the fourth channel is the LFE, left out, and the surrounds weigh more
+	if channels == 6 {
+		m.weights[3], m.weights[4], m.weights[5] = 0, 1.41, 1.41
+	}
+	// windowed sinc interpolation filter, phase p yields the sample p/4 after the newest one
+	for p := 0; p < oversampling; p++ {
+		for t := 0; t < oversamplingTaps; t++ {
+			x := float64(t-oversamplingTaps/2+1) - float64(p)/oversampling
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			window := 0.5 + 0.5*math.Cos(math.Pi*x/(oversamplingTaps/2+1))
+			m.taps[p][t] = sinc * window
+		}
+	}
+	return m
+}
+
+func (m *LoudnessMeter) Process(samples []float32) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		power := 0.0
+		for c := 0; c < m.channels; c++ {
+			x := float64(samples[i+c])
+			m.peak(c, x)
+			y := m.filters[c][1].process(m.filters[c][0].process(x))
+			power += m.weights[c] * y * y
+		}
+		m.subBlockSum += power
+		if m.subBlockFill++; m.subBlockFill == m.subBlockSize {
+			m.subBlocks = append(m.subBlocks, m.subBlockSum/float64(m.subBlockSize))
+			m.subBlockSum, m.subBlockFill = 0, 0
+		}
+	}
+}
+
+// peak tracks the sample peak and the peak of the 4x oversampled signal
+func (m *LoudnessMeter) peak(c int, x float64) {
+	m.samplePeak = max(m.samplePeak, math.Abs(x))
+	history := m.history[c]
+	copy(history, history[1:])
+	history[len(history)-1] = x
+	if m.rate >= 176400 {
+		m.truePeak = max(m.truePeak, math.Abs(x))
+		return
+	}
+	for p := 0; p < oversampling; p++ {
+		y := 0.0
+		for t, tap := range m.taps[p] {
+			y += tap * history[len(history)-1-t]
+		}
+		m.truePeak = max(m.truePeak, math.Abs(y))
+	}
+}
+
+// Result returns the measurement of the samples processed so far
+func (m *LoudnessMeter) Result() Loudness {
+	result := Loudness{
+		SamplePeak: m.samplePeak,
+		TruePeak:   max(decibels(m.truePeak), SilenceFloor),
+		Histogram:  make([]uint32, HistogramBins),
+	}
+
+	// 400ms blocks overlapping by 75% for the integrated loudness
+	blocks := windows(m.subBlocks, 4)
+	for _, power := range blocks {
+		if loudness := lufs(power); loudness > absoluteGate {
+			result.Histogram[histogramBin(loudness)]++
+		}
+	}
+	result.Integrated = gatedLoudness(blocks, integratedGate)
+
+	// 3s blocks moving by 100ms for the loudness range
+	shortTerm := windows(m.subBlocks, 30)
+	gate := gatedThreshold(shortTerm, rangeGate)
+	values := make([]float64, 0, len(shortTerm))
+	for _, power := range shortTerm {
+		if loudness := lufs(power); loudness > absoluteGate && loudness > gate {
+			values = append(values, loudness)
+		}
+	}
+	if len(values) > 0 {
+		sort.Float64s(values)
+		low := values[int(math.Round(0.10*float64(len(values)-1)))]
+		high := values[int(math.Round(0.95*float64(len(values)-1)))]
+		result.Range = high - low
+	}
+	return result
+}
+
+// HistogramLoudness returns the integrated loudness of the audio whose block
+// histograms are given, e.g. all tracks of an album
+func HistogramLoudness(histograms ...[]uint32) float64 {
+	blocks := make([]float64, 0)
+	counts := make([]uint32, 0)
+	for bin := 0; bin < HistogramBins; bin++ {
+		count := uint32(0)
+		for _, histogram := range histograms {
+			if bin < len(histogram) {
+				count += histogram[bin]
+			}
+		}
+		if count > 0 {
+			center := histogramMin + (float64(bin)+0.5)*histogramBinWidth
+			blocks = append(blocks, math.Pow(10, (center+0.691)/10))
+			counts = append(counts, count)
+		}
+	}
+	return weightedGatedLoudness(blocks, counts, integratedGate)
+}
+
+// windows returns the mean power of every run of size sub blocks
+func windows(subBlocks []float64, size int) []float64 {
+	if len(subBlocks) < size {
+		return nil
+	}
+	result := make([]float64, 0, len(subBlocks)-size+1)
+	sum := 0.0
+	for i, power := range subBlocks {
+		sum += power
+		if i >= size {
+			sum -= subBlocks[i-size]
+		}
+		if i >= size-1 {
+			result = append(result, max(sum, 0)/float64(size))
+		}
+	}
+	return result
+}
+
+func gatedLoudness(blocks []float64, relativeGate float64) float64 {
+	counts := make([]uint32, len(blocks))
+	for i := range counts {
+		counts[i] = 1
+	}
+	return weightedGatedLoudness(blocks, counts, relativeGate)
+}
+
+// gatedThreshold returns the relative gate of blocks in LUFS
+func gatedThreshold(blocks []float64, relativeGate float64) float64 {
+	sum, n := 0.0, 0
+	for _, power := range blocks {
+		if lufs(power) > absoluteGate {
+			sum += power
+			n++
+		}
+	}
+	if n == 0 {
+		return absoluteGate
+	}
+	return lufs(sum/float64(n)) + relativeGate
+}
+
+// weightedGatedLoudness applies the absolute and the relative gate to blocks,
+// each of which stands for counts of them
+func weightedGatedLoudness(blocks []float64, counts []uint32, relativeGate float64) float64 {
+	sum, n := 0.0, 0.0
+	for i, power := range blocks {
+		if lufs(power) > absoluteGate {
+			sum += power * float64(counts[i])
+			n += float64(counts[i])
+		}
+	}
+	if n == 0 {
+		return SilenceFloor
+	}
+	gate := lufs(sum/n) + relativeGate
+	sum, n = 0, 0
+	for i, power := range blocks {
+		if loudness := lufs(power); loudness > absoluteGate && loudness > gate {
+			sum += power * float64(counts[i])
+			n += float64(counts[i])
+		}
+	}
+	if n == 0 {
+		return SilenceFloor
+	}
+	return max(lufs(sum/n), SilenceFloor)
+}
+
+func lufs(power float64) float64 {
+	if power <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(power)
+}
+
+func decibels(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(amplitude)
+}
+
+func histogramBin(loudness float64) int {
+	return min(max(int((loudness-histogramMin)/histogramBinWidth), 0), HistogramBins-1)
+}
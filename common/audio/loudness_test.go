@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// toneSegment is a stereo sine of a level in dBFS, as in the EBU test signals
+type toneSegment struct {
+	level   float64
+	seconds float64
+}
+
+// stereoTone interleaves in phase stereo sines of freq Hz, one segment after another
+func stereoTone(rate int, freq float64, segments ...toneSegment) []float32 {
+	samples := make([]float32, 0)
+	n := 0
+	for _, segment := range segments {
+		amplitude := math.Pow(10, segment.level/20)
+		for i := 0; i < int(segment.seconds*float64(rate)); i++ {
+			x := float32(amplitude * math.Sin(2*math.Pi*freq*float64(n)/float64(rate)))
+			samples = append(samples, x, x)
+			n++
+		}
+	}
+	return samples
+}
+
+func measure(rate, channels int, samples []float32) Loudness {
+	meter := NewLoudnessMeter(rate, channels)
+	// in blocks as Analyze hands them over
+	block := 4096 * channels
+	for i := 0; i < len(samples); i += block {
+		meter.Process(samples[i:min(i+block, len(samples))])
+	}
+	return meter.Result()
+}
+
+// TestIntegratedLoudness runs the minimum requirements test signals of EBU Tech 3341
+func TestIntegratedLoudness(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []toneSegment
+		want     float64
+	}{
+		{name: "case 1", segments: []toneSegment{{-23, 20}}, want: -23},
+		{name: "case 2", segments: []toneSegment{{-33, 20}}, want: -33},
+		{name: "case 3", segments: []toneSegment{{-36, 10}, {-23, 60}, {-36, 10}}, want: -23},
+		{name: "case 4", segments: []toneSegment{{-72, 10}, {-36, 10}, {-23, 60}, {-36, 10}, {-72, 10}}, want: -23},
+		{name: "case 5", segments: []toneSegment{{-26, 20}, {-20, 20.1}, {-26, 20}}, want: -23},
+	}
+	for _, rate := range []int{44100, 48000} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s at %d Hz", tt.name, rate), func(t *testing.T) {
+				got := measure(rate, 2, stereoTone(rate, 1000, tt.segments...)).Integrated
+				if math.Abs(got-tt.want) > 0.1 {
+					t.Errorf("Integrated = %.2f LUFS, want %.1f ±0.1", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestLoudnessRange runs the test signals of EBU Tech 3342
+func TestLoudnessRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []toneSegment
+		want     float64
+	}{
+		{name: "case 1", segments: []toneSegment{{-20, 20}, {-30, 20}}, want: 10},
+		{name: "case 2", segments: []toneSegment{{-20, 20}, {-15, 20}}, want: 5},
+		{name: "case 3", segments: []toneSegment{{-40, 20}, {-20, 20}}, want: 20},
+		{name: "case 4", segments: []toneSegment{{-50, 20}, {-35, 20}, {-20, 20}, {-35, 20}, {-50, 20}}, want: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measure(48000, 2, stereoTone(48000, 1000, tt.segments...)).Range
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("Range = %.2f LU, want %.0f ±1", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTruePeak checks the peaks between samples, which a 0 dBFS sine at a quarter of
+// the sample rate shifted by 45° never hits
+func TestTruePeak(t *testing.T) {
+	rate := 48000
+	samples := make([]float32, 0, 2*rate)
+	for i := 0; i < rate; i++ {
+		x := float32(math.Sin(math.Pi/2*float64(i) + math.Pi/4))
+		samples = append(samples, x, x)
+	}
+	result := measure(rate, 2, samples)
+	if got := decibels(result.SamplePeak); math.Abs(got-(-3.01)) > 0.01 {
+		t.Errorf("SamplePeak = %.2f dBFS, want -3.01", got)
+	}
+	if result.TruePeak < -0.4 || result.TruePeak > 0.2 {
+		t.Errorf("TruePeak = %.2f dBTP, want 0 -0.4/+0.2", result.TruePeak)
+	}
+}
+
+func TestSilence(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float32
+	}{
+		{name: "no samples", samples: nil},
+		{name: "shorter than a block", samples: stereoTone(48000, 1000, toneSegment{-20, 0.3})},
+		{name: "digital silence", samples: make([]float32, 2*48000*5)},
+		{name: "below the absolute gate", samples: stereoTone(48000, 1000, toneSegment{-80, 5})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := measure(48000, 2, tt.samples)
+			if result.Integrated != SilenceFloor || result.Range != 0 {
+				t.Errorf("Integrated = %v, Range = %v, want %v and 0", result.Integrated, result.Range, SilenceFloor)
+			}
+			if len(result.Histogram) != HistogramBins {
+				t.Errorf("len(Histogram) = %d, want %d", len(result.Histogram), HistogramBins)
+			}
+		})
+	}
+}
+
+func TestHistogramLoudness(t *testing.T) {
+	quiet := measure(48000, 2, stereoTone(48000, 1000, toneSegment{-30, 20}))
+	loud := measure(48000, 2, stereoTone(48000, 1000, toneSegment{-20, 20}))
+	both := measure(48000, 2, stereoTone(48000, 1000, toneSegment{-30, 20}, toneSegment{-20, 20}))
+
+	tests := []struct {
+		name       string
+		histograms [][]uint32
+		want       float64
+	}{
+		{name: "one track", histograms: [][]uint32{loud.Histogram}, want: loud.Integrated},
+		{name: "album", histograms: [][]uint32{quiet.Histogram, loud.Histogram}, want: both.Integrated},
+		{name: "no tracks", histograms: nil, want: SilenceFloor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the bins are 0.1 LU wide
+			if got := HistogramLoudness(tt.histograms...); math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("HistogramLoudness() = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	gomp3 "github.com/hajimehoshi/go-mp3"
+	"github.com/tcolgate/mp3"
+)
+
+// SkipID3v2 reads past the ID3v2 tags at the start of r
+func SkipID3v2(r *bufio.Reader) error {
+	for {
+		header, err := r.Peek(10)
+		if err != nil || !bytes.Equal(header[0:3], []byte("ID3")) {
+			// shorter files have no tag, the frame decoder reports them
+			return nil
+		}
+		if _, err := io.CopyN(io.Discard, r, id3v2Size(header)); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyID3v2 copies the ID3v2 tags at the start of r to w
+func CopyID3v2(r *bufio.Reader, w io.Writer) error {
+	for {
+		header, err := r.Peek(10)
+		if err != nil || !bytes.Equal(header[0:3], []byte("ID3")) {
+			return nil
+		}
+		if _, err := io.CopyN(w, r, id3v2Size(header)); err != nil {
+			return err
+		}
+	}
+}
+
+// id3v2Size returns the size of the ID3v2 tag starting with the 10 byte header
+func id3v2Size(header []byte) int64 {
+	// the size is syncsafe, 7 bits per byte, and a footer adds another 10 bytes
+	size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// ForEachMP3Frame calls fn with every audio frame of r. ID3v2 tags and the
+// Xing or Info frame written by encoders in front of the audio are skipped.
+func ForEachMP3Frame(r io.Reader, fn func(frame *mp3.Frame) error) error {
+	br := bufio.NewReader(r)
+	if err := SkipID3v2(br); err != nil {
+		return err
+	}
+	decoder := mp3.NewDecoder(br)
+	var frame mp3.Frame
+	skipped := 0
+	for first := true; ; first = false {
+		if err := decoder.Decode(&frame, &skipped); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if first && isInfoFrame(&frame) {
+			continue
+		}
+		if err := fn(&frame); err != nil {
+			return err
+		}
+	}
+}
+
+// isInfoFrame tells whether frame is an empty frame carrying a Xing, Info or VBRI header
+func isInfoFrame(frame *mp3.Frame) bool {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(frame.Reader()); err != nil {
+		return false
+	}
+	data := buf.Bytes()
+	offset := 4
+	if frame.Header().Protection() {
+		offset += 2
+	}
+	if sideInfo, err := frame.SideInfoLength(); err == nil && len(data) >= offset+sideInfo+4 {
+		tag := string(data[offset+sideInfo : offset+sideInfo+4])
+		if tag == "Xing" || tag == "Info" {
+			return true
+		}
+	}
+	// VBRI always sits 32 bytes after the header
+	return len(data) >= 40 && string(data[36:40]) == "VBRI"
+}
+
+// mp3Decoder decodes mp3 with go-mp3, which always yields 16 bit stereo
+type mp3Decoder struct {
+	decoder *gomp3.Decoder
+	buf     []byte
+}
+
+func newMP3Decoder(r io.Reader) (Decoder, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	// go-mp3 skips a single leading tag only
+	if err := SkipID3v2(br); err != nil {
+		return nil, err
+	}
+	decoder, err := gomp3.NewDecoder(br)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Decoder{decoder: decoder}, nil
+}
+
+func (d *mp3Decoder) SampleRate() int {
+	return d.decoder.SampleRate()
+}
+
+func (d *mp3Decoder) Channels() int {
+	return 2
+}
+
+func (d *mp3Decoder) Read(samples []float32) (int, error) {
+	if cap(d.buf) < len(samples)*2 {
+		d.buf = make([]byte, len(samples)*2)
+	}
+	buf := d.buf[:len(samples)*2]
+	n, err := io.ReadFull(d.decoder, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	count := n / 2
+	for i := 0; i < count; i++ {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(buf[i*2:]))) / 32768
+	}
+	if count == 0 && err == nil {
+		err = io.EOF
+	}
+	return count, err
+}
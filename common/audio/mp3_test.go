@@ -0,0 +1,168 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/tcolgate/mp3"
+)
+
+// silentFrame is a 128 kbit/s 44.1 kHz mono MPEG-1 layer III frame, which with
+// empty side information decodes to silence. A tag, such as "Info", is written
+// after the side information.
+func silentFrame(tag string) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC4})
+	copy(frame[4+17:], tag)
+	return frame
+}
+
+// id3Tag is an ID3v2.4 tag of size bytes after the header, with a footer if asked
+func id3Tag(size int, footer bool) []byte {
+	flags := byte(0)
+	if footer {
+		flags = 0x10
+	}
+	tag := []byte{'I', 'D', '3', 4, 0, flags, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	tag = append(tag, make([]byte, size)...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', 4, 0, flags, tag[6], tag[7], tag[8], tag[9])
+	}
+	return tag
+}
+
+func mp3File(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestID3v2(t *testing.T) {
+	frame := silentFrame("")
+	tests := []struct {
+		name string
+		file []byte
+		tags int
+	}{
+		{name: "no tag", file: mp3File(frame), tags: 0},
+		{name: "tag", file: mp3File(id3Tag(20, false), frame), tags: 30},
+		{name: "tag with footer", file: mp3File(id3Tag(20, true), frame), tags: 40},
+		{name: "syncsafe size", file: mp3File(id3Tag(300, false), frame), tags: 310},
+		{name: "two tags", file: mp3File(id3Tag(20, false), id3Tag(5, false), frame), tags: 45},
+		{name: "shorter than a header", file: []byte("ID3"), tags: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(tt.file))
+			if err := SkipID3v2(r); err != nil {
+				t.Fatalf("SkipID3v2() error = %v", err)
+			}
+			if rest := r.Buffered(); rest != len(tt.file)-tt.tags {
+				t.Errorf("SkipID3v2() left %d bytes, want %d", rest, len(tt.file)-tt.tags)
+			}
+
+			var tags bytes.Buffer
+			if err := CopyID3v2(bufio.NewReader(bytes.NewReader(tt.file)), &tags); err != nil {
+				t.Fatalf("CopyID3v2() error = %v", err)
+			}
+			if !bytes.Equal(tags.Bytes(), tt.file[:tt.tags]) {
+				t.Errorf("CopyID3v2() copied %d bytes, want %d", tags.Len(), tt.tags)
+			}
+		})
+	}
+	truncated := id3Tag(20, false)[:15]
+	if err := SkipID3v2(bufio.NewReader(bytes.NewReader(truncated))); err == nil {
+		t.Error("SkipID3v2() of a truncated tag error = nil, want an error")
+	}
+}
+
+func TestForEachMP3Frame(t *testing.T) {
+	frame := silentFrame("")
+	tests := []struct {
+		name string
+		file []byte
+		want int
+	}{
+		{name: "frames", file: mp3File(frame, frame, frame), want: 3},
+		{name: "after a tag", file: mp3File(id3Tag(64, false), frame, frame), want: 2},
+		{name: "info frame", file: mp3File(silentFrame("Info"), frame, frame), want: 2},
+		{name: "xing frame", file: mp3File(id3Tag(64, false), silentFrame("Xing"), frame), want: 1},
+		{name: "info frame not first", file: mp3File(frame, silentFrame("Info")), want: 2},
+		{name: "empty", file: nil, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := 0
+			err := ForEachMP3Frame(bytes.NewReader(tt.file), func(frame *mp3.Frame) error {
+				frames++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ForEachMP3Frame() error = %v", err)
+			}
+			if frames != tt.want {
+				t.Errorf("ForEachMP3Frame() = %d frames, want %d", frames, tt.want)
+			}
+		})
+	}
+}
+
+func TestMP3Decoder(t *testing.T) {
+	frame := silentFrame("")
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "frames", file: mp3File(frame, frame, frame, frame)},
+		{name: "after two tags", file: mp3File(id3Tag(64, false), id3Tag(16, true), frame, frame, frame, frame)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecoder(bytes.NewReader(tt.file), FormatMP3)
+			if err != nil {
+				t.Fatalf("NewDecoder() error = %v", err)
+			}
+			// go-mp3 always yields stereo
+			if d.Channels() != 2 || d.SampleRate() != 44100 {
+				t.Errorf("format = %d channels at %d Hz, want 2 at 44100 Hz", d.Channels(), d.SampleRate())
+			}
+			samples := decodeAll(t, d)
+			if want := 4 * 1152 * 2; len(samples) != want {
+				t.Errorf("decoded %d samples, want %d", len(samples), want)
+			}
+			for _, sample := range samples {
+				if sample != 0 {
+					t.Errorf("decoded %v, want silence", sample)
+					break
+				}
+			}
+		})
+	}
+	if _, err := NewDecoder(bytes.NewReader([]byte("not an mp3 file at all")), FormatMP3); err == nil {
+		t.Error("NewDecoder() error = nil, want an error")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		head    []byte
+		want    Format
+		wantErr bool
+	}{
+		{name: "wav", head: wavFile(fmtChunk(wavFormatPCM, 1, 8000, 16, 0)), want: FormatWAV},
+		{name: "mp3 with a tag", head: id3Tag(0, false), want: FormatMP3},
+		{name: "mp3 frame", head: silentFrame("")[:12], want: FormatMP3},
+		{name: "riff but not wave", head: []byte("RIFF\x04\x00\x00\x00AVI "), wantErr: true},
+		{name: "flac", head: []byte("fLaC\x00\x00\x00\x22\x10\x00\x10\x00"), want: FormatFLAC},
+		{name: "ogg", head: []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00"), wantErr: true},
+		{name: "empty", head: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.head)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("DetectFormat() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/tcolgate/mp3"
+)
+
+// MP3Segment is a run of whole frames of an mp3 stream
+type MP3Segment struct {
+	Offset   int64 // of the first frame, from the start of the stream
+	Size     int64
+	Start    float64 // seconds
+	Duration float64
+}
+
+// SegmentMP3 splits the audio frames of r into segments of at least target
+// seconds, only the last one may be shorter. Tags and the Xing or Info frame
+// belong to no segment.
+func SegmentMP3(r io.Reader, target float64) ([]MP3Segment, error) {
+	counter := &countingReader{r: r}
+	header := make([]byte, 10)
+	for {
+		n, err := io.ReadFull(counter, header)
+		if err == nil && bytes.Equal(header[0:3], []byte("ID3")) {
+			if _, err := io.CopyN(io.Discard, counter, id3v2Size(header)-10); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		// the bytes read past the tags are handed back to the frame decoder
+		counter = &countingReader{r: io.MultiReader(bytes.NewReader(header[:n]), counter), n: counter.n - int64(n)}
+		break
+	}
+
+	decoder := mp3.NewDecoder(counter)
+	var frame mp3.Frame
+	skipped := 0
+	segments := make([]MP3Segment, 0)
+	var current *MP3Segment
+	samples := 0
+	for first := true; ; first = false {
+		if err := decoder.Decode(&frame, &skipped); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if first && isInfoFrame(&frame) {
+			continue
+		}
+		size := int64(frame.Size())
+		rate := float64(frame.Header().SampleRate())
+		if current == nil || current.Duration >= target {
+			segments = append(segments, MP3Segment{Offset: counter.n - size, Start: float64(samples) / rate})
+			current = &segments[len(segments)-1]
+		}
+		current.Size = counter.n - current.Offset
+		current.Duration += float64(frame.Samples()) / rate
+		samples += frame.Samples()
+	}
+	return segments, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,58 @@
+package audio
+
+import "math"
+
+// DefaultSilenceThreshold is the level in dBFS below which audio counts as silence
+const DefaultSilenceThreshold = -60.0
+
+// SilenceDetector finds the first and the last sample frame in which a channel
+// reaches the threshold, the audio before and after them is silence
+type SilenceDetector struct {
+	rate      int
+	channels  int
+	threshold float32
+	frames    int64
+	first     int64
+	last      int64
+}
+
+// NewSilenceDetector detects silence below thresholdDB, in dBFS
+func NewSilenceDetector(rate, channels int, thresholdDB float64) *SilenceDetector {
+	return &SilenceDetector{
+		rate:      rate,
+		channels:  max(channels, 1),
+		threshold: float32(math.Pow(10, thresholdDB/20)),
+		first:     -1,
+		last:      -1,
+	}
+}
+
+func (s *SilenceDetector) Process(samples []float32) {
+	for i, x := range samples {
+		if x >= s.threshold || -x >= s.threshold {
+			frame := s.frames + int64(i/s.channels)
+			if s.first < 0 {
+				s.first = frame
+			}
+			s.last = frame
+		}
+	}
+	s.frames += int64(len(samples) / s.channels)
+}
+
+// Bounds returns where the audio above the threshold starts and ends in seconds,
+// ok is false when all of it is silence
+func (s *SilenceDetector) Bounds() (start, end float64, ok bool) {
+	if s.first < 0 || s.rate <= 0 {
+		return 0, 0, false
+	}
+	return float64(s.first) / float64(s.rate), float64(s.last+1) / float64(s.rate), true
+}
+
+// Duration returns the length in seconds of the samples processed so far
+func (s *SilenceDetector) Duration() float64 {
+	if s.rate <= 0 {
+		return 0
+	}
+	return float64(s.frames) / float64(s.rate)
+}
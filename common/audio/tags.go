@@ -0,0 +1,108 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// id3v1Size is the size of the ID3v1 tag at the end of an mp3 file
+const id3v1Size = 128
+
+// Tags are the catalog fields written into the ID3v2.4 tag of an mp3 file
+type Tags struct {
+	Title  string
+	Artist string
+	Album  string
+	Genre  string
+	Year   int
+	// Cover is a JPEG front cover, left out when empty
+	Cover []byte
+}
+
+// ID3v2 encodes the tags as an ID3v2.4 tag with UTF-8 text frames
+func (t Tags) ID3v2() []byte {
+	var frames bytes.Buffer
+	text := func(id, value string) {
+		if len(value) > 0 {
+			writeID3Frame(&frames, id, append([]byte{3}, value...))
+		}
+	}
+	text("TIT2", t.Title)
+	text("TPE1", t.Artist)
+	text("TALB", t.Album)
+	text("TCON", t.Genre)
+	if t.Year > 0 {
+		text("TDRC", strconv.Itoa(t.Year))
+	}
+	if len(t.Cover) > 0 {
+		// latin-1 MIME type, front cover, empty description
+		picture := append([]byte("\x00image/jpeg\x00\x03\x00"), t.Cover...)
+		writeID3Frame(&frames, "APIC", picture)
+	}
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = append(tag, syncsafe(frames.Len())...)
+	return append(tag, frames.Bytes()...)
+}
+
+func writeID3Frame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	w.Write(syncsafe(len(data)))
+	w.Write([]byte{0, 0})
+	w.Write(data)
+}
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// TagMP3 returns the mp3 file src of size bytes with its ID3v2 tags replaced by
+// tags and its ID3v1 tag left out. The frames are read from src as they are.
+func TagMP3(src io.ReaderAt, size int64, tags Tags) (*io.SectionReader, error) {
+	start := int64(0)
+	header := make([]byte, 10)
+	for {
+		if _, err := src.ReadAt(header, start); err != nil || !bytes.Equal(header[0:3], []byte("ID3")) {
+			break
+		}
+		start += id3v2Size(header)
+	}
+	end := size
+	trailer := make([]byte, 3)
+	if end-id3v1Size >= start {
+		if _, err := src.ReadAt(trailer, end-id3v1Size); err == nil && string(trailer) == "TAG" {
+			end -= id3v1Size
+		}
+	}
+	if start > end {
+		return nil, errors.New("mp3 file ends within its tags")
+	}
+	tag := tags.ID3v2()
+	parts := concatReaderAt{io.NewSectionReader(bytes.NewReader(tag), 0, int64(len(tag))), io.NewSectionReader(src, start, end-start)}
+	return io.NewSectionReader(parts, 0, int64(len(tag))+end-start), nil
+}
+
+// concatReaderAt reads its sections one after another
+type concatReaderAt []*io.SectionReader
+
+func (c concatReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for _, part := range c {
+		if off >= part.Size() {
+			off -= part.Size()
+			continue
+		}
+		n, err := part.ReadAt(p[read:], off)
+		read += n
+		if err != nil && err != io.EOF {
+			return read, err
+		}
+		if read == len(p) {
+			return read, nil
+		}
+		off = 0
+	}
+	return read, io.EOF
+}
@@ -0,0 +1,109 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	tempoRate  = 11025
+	tempoFrame = 1024
+	tempoHop   = 128
+	minBPM     = 50.0
+	maxBPM     = 220.0
+	// the tempo prior is a log normal around 120 BPM, so octave errors favour common tempos
+	tempoPriorCenter = 120.0
+	tempoPriorWidth  = 1.0 // in octaves
+)
+
+// TempoDetector estimates the tempo from the autocorrelation of the onset strength,
+// the positive spectral flux of the log compressed spectrum
+type TempoDetector struct {
+	resampler *monoResampler
+	window    []float64
+	pending   []float32
+	buf       []complex128
+	previous  []float64
+	onsets    []float64
+}
+
+func NewTempoDetector(rate, channels int) *TempoDetector {
+	return &TempoDetector{
+		resampler: newMonoResampler(rate, channels, tempoRate),
+		window:    hann(tempoFrame),
+		buf:       make([]complex128, tempoFrame),
+	}
+}
+
+func (t *TempoDetector) Process(samples []float32) {
+	t.pending = append(t.pending, t.resampler.process(samples)...)
+	for len(t.pending) >= tempoFrame {
+		for i := range t.buf {
+			t.buf[i] = complex(float64(t.pending[i])*t.window[i], 0)
+		}
+		fft(t.buf)
+		spectrum := make([]float64, tempoFrame/2)
+		flux := 0.0
+		for bin := range spectrum {
+			spectrum[bin] = math.Log1p(1000 * cmplx.Abs(t.buf[bin]))
+			if t.previous != nil {
+				flux += max(spectrum[bin]-t.previous[bin], 0)
+			}
+		}
+		t.previous = spectrum
+		t.onsets = append(t.onsets, flux)
+		t.pending = t.pending[:copy(t.pending, t.pending[tempoHop:])]
+	}
+}
+
+// BPM returns the estimated tempo, 0 when the audio is too short or has no onsets
+func (t *TempoDetector) BPM() float64 {
+	fps := float64(tempoRate) / tempoHop
+	minLag := int(math.Floor(60 * fps / maxBPM))
+	maxLag := int(math.Ceil(60 * fps / minBPM))
+	if len(t.onsets) < maxLag*4 {
+		return 0
+	}
+
+	// take out the local mean of the onset strength so only its peaks correlate
+	onsets := make([]float64, len(t.onsets))
+	const meanWidth = 16
+	sum := 0.0
+	for i, v := range t.onsets {
+		sum += v
+		if i >= meanWidth {
+			sum -= t.onsets[i-meanWidth]
+		}
+		onsets[i] = max(v-sum/float64(min(i+1, meanWidth)), 0)
+	}
+
+	correlation := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		sum := 0.0
+		for i := lag; i < len(onsets); i++ {
+			sum += onsets[i] * onsets[i-lag]
+		}
+		correlation[lag] = sum / float64(len(onsets)-lag)
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := 60 * fps / float64(lag)
+		octaves := math.Log2(bpm / tempoPriorCenter)
+		score := correlation[lag] * math.Exp(-0.5*octaves*octaves/(tempoPriorWidth*tempoPriorWidth))
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0
+	}
+
+	// a parabola through the peak and its neighbours places it between lags
+	lag := float64(best)
+	a, b, c := correlation[best-1], correlation[best], correlation[best+1]
+	if denominator := a - 2*b + c; denominator < 0 {
+		lag += 0.5 * (a - c) / denominator
+	}
+	return math.Round(600*fps/lag) / 10
+}
@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+var errInvalidWAV = errors.New("invalid wav file")
+
+// WAVFormat is the fmt chunk of a wav file
+type WAVFormat struct {
+	AudioFormat   uint16
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+}
+
+// Duration returns the length in seconds of size bytes of samples
+func (f WAVFormat) Duration(size int64) float64 {
+	frameSize := f.Channels * f.BitsPerSample / 8
+	if frameSize <= 0 || f.SampleRate <= 0 {
+		return 0
+	}
+	return float64(size/int64(frameSize)) / float64(f.SampleRate)
+}
+
+// ReadWAVHeader reads the chunks of r up to the data chunk and returns its
+// format and a reader of the sample bytes, whose N is the size of the data
+func ReadWAVHeader(r io.Reader) (WAVFormat, *io.LimitedReader, error) {
+	var format WAVFormat
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return format, nil, errInvalidWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return format, nil, errInvalidWAV
+	}
+	haveFormat := false
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return format, nil, errInvalidWAV
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		switch string(header[0:4]) {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return format, nil, errInvalidWAV
+			}
+			chunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return format, nil, errInvalidWAV
+			}
+			format = WAVFormat{
+				AudioFormat:   binary.LittleEndian.Uint16(chunk[0:2]),
+				Channels:      int(binary.LittleEndian.Uint16(chunk[2:4])),
+				SampleRate:    int(binary.LittleEndian.Uint32(chunk[4:8])),
+				BitsPerSample: int(binary.LittleEndian.Uint16(chunk[14:16])),
+			}
+			// the extensible format carries the real one in the first bytes of its sub format
+			if format.AudioFormat == wavFormatExtensible && size >= 26 {
+				format.AudioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return format, nil, errInvalidWAV
+			}
+			return format, &io.LimitedReader{R: r, N: size}, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return format, nil, errInvalidWAV
+			}
+		}
+	}
+}
+
+type wavDecoder struct {
+	format WAVFormat
+	data   io.Reader
+	width  int
+	buf    []byte
+}
+
+func newWAVDecoder(r io.Reader) (Decoder, error) {
+	format, data, err := ReadWAVHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if format.Channels <= 0 || format.SampleRate <= 0 {
+		return nil, errInvalidWAV
+	}
+	switch {
+	case format.AudioFormat == wavFormatPCM && format.BitsPerSample >= 8 && format.BitsPerSample <= 32 && format.BitsPerSample%8 == 0:
+	case format.AudioFormat == wavFormatFloat && (format.BitsPerSample == 32 || format.BitsPerSample == 64):
+	default:
+		return nil, errors.New("unsupported wav sample format")
+	}
+	return &wavDecoder{format: format, data: data, width: format.BitsPerSample / 8}, nil
+}
+
+func (d *wavDecoder) SampleRate() int {
+	return d.format.SampleRate
+}
+
+func (d *wavDecoder) Channels() int {
+	return d.format.Channels
+}
+
+func (d *wavDecoder) Read(samples []float32) (int, error) {
+	if cap(d.buf) < len(samples)*d.width {
+		d.buf = make([]byte, len(samples)*d.width)
+	}
+	buf := d.buf[:len(samples)*d.width]
+	n, err := io.ReadFull(d.data, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	count := n / d.width
+	for i := 0; i < count; i++ {
+		samples[i] = d.sample(buf[i*d.width : (i+1)*d.width])
+	}
+	if count == 0 && err == nil {
+		err = io.EOF
+	}
+	return count, err
+}
+
+func (d *wavDecoder) sample(b []byte) float32 {
+	if d.format.AudioFormat == wavFormatFloat {
+		if d.width == 4 {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}
+		return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+	switch d.width {
+	case 1:
+		// 8 bit samples are unsigned
+		return (float32(b[0]) - 128) / 128
+	case 2:
+		return float32(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 3:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float32(v) / 8388608
+	default:
+		return float32(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+}
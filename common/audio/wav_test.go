@@ -0,0 +1,203 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// wavChunk is a chunk of a wav file built by wavFile
+type wavChunk struct {
+	id   string
+	data []byte
+}
+
+// wavFile builds a RIFF WAVE file from chunks, padding odd ones
+func wavFile(chunks ...wavChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, chunk := range chunks {
+		body.WriteString(chunk.id)
+		binary.Write(&body, binary.LittleEndian, uint32(len(chunk.data)))
+		body.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+// fmtChunk is the fmt chunk of a plain or, with a sub format, an extensible wav file
+func fmtChunk(audioFormat uint16, channels, rate, bitsPerSample int, subFormat uint16) wavChunk {
+	frameSize := channels * bitsPerSample / 8
+	data := littleEndian(audioFormat, uint16(channels), uint32(rate), uint32(rate*frameSize), uint16(frameSize), uint16(bitsPerSample))
+	if audioFormat == wavFormatExtensible {
+		data = append(data, littleEndian(uint16(22), uint16(bitsPerSample), uint32(3), subFormat, [14]byte{})...)
+	}
+	return wavChunk{id: "fmt ", data: data}
+}
+
+func littleEndian(values ...any) []byte {
+	var b bytes.Buffer
+	for _, value := range values {
+		binary.Write(&b, binary.LittleEndian, value)
+	}
+	return b.Bytes()
+}
+
+func decodeAll(t *testing.T, d Decoder) []float32 {
+	t.Helper()
+	samples := make([]float32, 0)
+	buf := make([]float32, 3)
+	for {
+		n, err := d.Read(buf)
+		samples = append(samples, buf[:n]...)
+		if err == io.EOF {
+			return samples
+		} else if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+}
+
+func TestWAVDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     []byte
+		channels int
+		rate     int
+		want     []float32
+	}{
+		{
+			name:     "8 bit unsigned",
+			file:     wavFile(fmtChunk(wavFormatPCM, 1, 8000, 8, 0), wavChunk{"data", []byte{128, 255, 0, 192}}),
+			channels: 1, rate: 8000,
+			want: []float32{0, 127.0 / 128, -1, 0.5},
+		},
+		{
+			name:     "16 bit stereo",
+			file:     wavFile(fmtChunk(wavFormatPCM, 2, 44100, 16, 0), wavChunk{"data", littleEndian(int16(0), int16(16384), int16(-32768), int16(32767))}),
+			channels: 2, rate: 44100,
+			want: []float32{0, 0.5, -1, 32767.0 / 32768},
+		},
+		{
+			name:     "24 bit",
+			file:     wavFile(fmtChunk(wavFormatPCM, 1, 48000, 24, 0), wavChunk{"data", []byte{0x00, 0x00, 0x40, 0x00, 0x00, 0x80, 0xFF, 0xFF, 0xFF}}),
+			channels: 1, rate: 48000,
+			want: []float32{0.5, -1, -1.0 / 8388608},
+		},
+		{
+			name:     "32 bit",
+			file:     wavFile(fmtChunk(wavFormatPCM, 1, 48000, 32, 0), wavChunk{"data", littleEndian(int32(math.MinInt32), int32(1<<30))}),
+			channels: 1, rate: 48000,
+			want: []float32{-1, 0.5},
+		},
+		{
+			name:     "32 bit float",
+			file:     wavFile(fmtChunk(wavFormatFloat, 1, 48000, 32, 0), wavChunk{"data", littleEndian(float32(0.25), float32(-0.75))}),
+			channels: 1, rate: 48000,
+			want: []float32{0.25, -0.75},
+		},
+		{
+			name:     "64 bit float",
+			file:     wavFile(fmtChunk(wavFormatFloat, 1, 96000, 64, 0), wavChunk{"data", littleEndian(float64(0.125), float64(-1))}),
+			channels: 1, rate: 96000,
+			want: []float32{0.125, -1},
+		},
+		{
+			name:     "extensible",
+			file:     wavFile(fmtChunk(wavFormatExtensible, 2, 48000, 16, wavFormatPCM), wavChunk{"data", littleEndian(int16(16384), int16(-16384))}),
+			channels: 2, rate: 48000,
+			want: []float32{0.5, -0.5},
+		},
+		{
+			name: "chunks around the data",
+			file: wavFile(wavChunk{"LIST", []byte("INFOISFT\x03\x00\x00\x00Go\x00")}, fmtChunk(wavFormatPCM, 1, 22050, 16, 0),
+				wavChunk{"fact", []byte{1, 0, 0, 0}}, wavChunk{"data", littleEndian(int16(8192))}, wavChunk{"id3 ", []byte("ID3")}),
+			channels: 1, rate: 22050,
+			want: []float32{0.25},
+		},
+		{
+			name:     "partial last sample",
+			file:     wavFile(fmtChunk(wavFormatPCM, 1, 8000, 16, 0), wavChunk{"data", []byte{0x00, 0x40, 0x00}}),
+			channels: 1, rate: 8000,
+			want: []float32{0.5},
+		},
+		{
+			name:     "no samples",
+			file:     wavFile(fmtChunk(wavFormatPCM, 2, 8000, 16, 0), wavChunk{"data", nil}),
+			channels: 2, rate: 8000,
+			want: []float32{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecoder(bytes.NewReader(tt.file), FormatWAV)
+			if err != nil {
+				t.Fatalf("NewDecoder() error = %v", err)
+			}
+			if d.Channels() != tt.channels || d.SampleRate() != tt.rate {
+				t.Errorf("format = %d channels at %d Hz, want %d at %d Hz", d.Channels(), d.SampleRate(), tt.channels, tt.rate)
+			}
+			got := decodeAll(t, d)
+			if len(got) != len(tt.want) {
+				t.Fatalf("samples = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-tt.want[i])) > 1e-7 {
+					t.Errorf("samples = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestWAVDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "empty", file: nil},
+		{name: "not riff", file: []byte("RIFX\x00\x00\x00\x00WAVEfmt ")},
+		{name: "not wave", file: wavFile(wavChunk{"data", nil})[:8]},
+		{name: "data before fmt", file: wavFile(wavChunk{"data", []byte{0, 0}}, fmtChunk(wavFormatPCM, 1, 8000, 16, 0))},
+		{name: "no data", file: wavFile(fmtChunk(wavFormatPCM, 1, 8000, 16, 0))},
+		{name: "short fmt", file: wavFile(wavChunk{"fmt ", []byte{1, 0, 1, 0}}, wavChunk{"data", nil})},
+		{name: "12 bit", file: wavFile(fmtChunk(wavFormatPCM, 1, 8000, 12, 0), wavChunk{"data", nil})},
+		{name: "16 bit float", file: wavFile(fmtChunk(wavFormatFloat, 1, 8000, 16, 0), wavChunk{"data", nil})},
+		{name: "a-law", file: wavFile(fmtChunk(6, 1, 8000, 8, 0), wavChunk{"data", nil})},
+		{name: "no channels", file: wavFile(fmtChunk(wavFormatPCM, 0, 8000, 16, 0), wavChunk{"data", nil})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder(bytes.NewReader(tt.file), FormatWAV); err == nil {
+				t.Error("NewDecoder() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestWAVDuration(t *testing.T) {
+	tests := []struct {
+		format WAVFormat
+		size   int64
+		want   float64
+	}{
+		{format: WAVFormat{Channels: 2, SampleRate: 44100, BitsPerSample: 16}, size: 44100 * 4, want: 1},
+		{format: WAVFormat{Channels: 1, SampleRate: 8000, BitsPerSample: 24}, size: 8000*3 + 2, want: 1},
+		{format: WAVFormat{Channels: 0, SampleRate: 8000, BitsPerSample: 16}, size: 100, want: 0},
+		{format: WAVFormat{Channels: 1, SampleRate: 0, BitsPerSample: 16}, size: 100, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.format.Duration(tt.size); got != tt.want {
+			t.Errorf("%+v.Duration(%d) = %v, want %v", tt.format, tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	waveformVersion = 1
+	waveformFlags8  = 1 // the .dat flag for 8 bit data
+)
+
+var errInvalidWaveform = errors.New("invalid waveform data")
+
+// Waveform holds the minimum and maximum sample of every pixel of a mono mix
+// of the audio, laid out like the audiowaveform JSON and .dat formats
+type Waveform struct {
+	Version         int     `json:"version"`
+	Channels        int     `json:"channels"`
+	SampleRate      int     `json:"sample_rate"`
+	SamplesPerPixel int     `json:"samples_per_pixel"`
+	Bits            int     `json:"bits"`
+	Length          int     `json:"length"`
+	Data            []int16 `json:"data"` // min and max of each pixel, in turn
+}
+
+// ComputeWaveforms decodes d once and returns one 16 bit waveform per resolution
+// in samplesPerPixel, the finest should come first
+func ComputeWaveforms(d Decoder, samplesPerPixel ...int) ([]*Waveform, error) {
+	waveforms := make([]*Waveform, len(samplesPerPixel))
+	counts := make([]int, len(samplesPerPixel))
+	for i, spp := range samplesPerPixel {
+		if spp <= 0 {
+			return nil, errors.New("samples per pixel must be positive")
+		}
+		waveforms[i] = &Waveform{Version: waveformVersion, Channels: 1, SampleRate: d.SampleRate(), SamplesPerPixel: spp, Bits: 16}
+	}
+
+	err := ForEachMono(d, 0, func(block []float32) error {
+		for _, sample := range block {
+			v := int16(math.Max(-32768, math.Min(32767, math.Round(float64(sample)*32767))))
+			for i, w := range waveforms {
+				if counts[i] == 0 {
+					w.Data = append(w.Data, v, v)
+				} else if last := len(w.Data) - 2; v < w.Data[last] {
+					w.Data[last] = v
+				} else if v > w.Data[last+1] {
+					w.Data[last+1] = v
+				}
+				if counts[i]++; counts[i] == w.SamplesPerPixel {
+					counts[i] = 0
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range waveforms {
+		w.Length = len(w.Data) / 2
+	}
+	return waveforms, nil
+}
+
+// Resize merges pixels of w so that it has at most length of them. Pixels
+// stay a whole number of samples, so the result may be a bit shorter.
+func (w *Waveform) Resize(length int) *Waveform {
+	if length <= 0 || length >= w.Length {
+		return w
+	}
+	factor := (w.Length + length - 1) / length
+	resized := &Waveform{
+		Version:         w.Version,
+		Channels:        w.Channels,
+		SampleRate:      w.SampleRate,
+		SamplesPerPixel: w.SamplesPerPixel * factor,
+		Bits:            w.Bits,
+		Length:          (w.Length + factor - 1) / factor,
+	}
+	resized.Data = make([]int16, 0, resized.Length*2)
+	for start := 0; start < w.Length; start += factor {
+		low, high := w.Data[start*2], w.Data[start*2+1]
+		for i := start + 1; i < start+factor && i < w.Length; i++ {
+			low = min(low, w.Data[i*2])
+			high = max(high, w.Data[i*2+1])
+		}
+		resized.Data = append(resized.Data, low, high)
+	}
+	return resized
+}
+
+// WriteTo writes w in the binary audiowaveform .dat format, version 1
+func (w *Waveform) WriteTo(out io.Writer) (int64, error) {
+	var flags uint32
+	if w.Bits == 8 {
+		flags = waveformFlags8
+	}
+	header := []any{int32(waveformVersion), flags, int32(w.SampleRate), int32(w.SamplesPerPixel), uint32(w.Length)}
+	for _, field := range header {
+		if err := binary.Write(out, binary.LittleEndian, field); err != nil {
+			return 0, err
+		}
+	}
+	var err error
+	if w.Bits == 8 {
+		data := make([]int8, len(w.Data))
+		for i, v := range w.Data {
+			data[i] = int8(v)
+		}
+		err = binary.Write(out, binary.LittleEndian, data)
+	} else {
+		err = binary.Write(out, binary.LittleEndian, w.Data)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(20 + len(w.Data)*w.Bits/8), nil
+}
+
+// ReadWaveform reads a waveform in the .dat format written by WriteTo
+func ReadWaveform(r io.Reader) (*Waveform, error) {
+	var header struct {
+		Version         int32
+		Flags           uint32
+		SampleRate      int32
+		SamplesPerPixel int32
+		Length          uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, errInvalidWaveform
+	}
+	if header.Version != waveformVersion || header.Length > math.MaxInt32/2 {
+		return nil, errInvalidWaveform
+	}
+	w := &Waveform{
+		Version:         waveformVersion,
+		Channels:        1,
+		SampleRate:      int(header.SampleRate),
+		SamplesPerPixel: int(header.SamplesPerPixel),
+		Bits:            16,
+		Length:          int(header.Length),
+		Data:            make([]int16, header.Length*2),
+	}
+	if header.Flags&waveformFlags8 != 0 {
+		data := make([]int8, header.Length*2)
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, errInvalidWaveform
+		}
+		w.Bits = 8
+		for i, v := range data {
+			w.Data[i] = int16(v)
+		}
+		return w, nil
+	}
+	if err := binary.Read(r, binary.LittleEndian, w.Data); err != nil {
+		return nil, errInvalidWaveform
+	}
+	return w, nil
+}
@@ -0,0 +1,179 @@
+package audio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestComputeWaveforms(t *testing.T) {
+	tests := []struct {
+		name            string
+		audio           *sliceDecoder
+		samplesPerPixel []int
+		want            [][]int16
+	}{
+		{
+			name:            "mono",
+			audio:           &sliceDecoder{rate: 8000, channels: 1, samples: []float32{0, 0.5, -0.5, 1, -1, 0.25, 0.75}},
+			samplesPerPixel: []int{2, 3},
+			want: [][]int16{
+				{0, 16384, -16384, 32767, -32767, 8192, 24575, 24575},
+				{-16384, 16384, -32767, 32767, 24575, 24575},
+			},
+		},
+		{
+			name:            "stereo mixed down",
+			audio:           &sliceDecoder{rate: 8000, channels: 2, samples: []float32{1, 0, -1, -1, 0.5, -0.5, 0.25, 0.25}},
+			samplesPerPixel: []int{1, 4},
+			want: [][]int16{
+				{16384, 16384, -32767, -32767, 0, 0, 8192, 8192},
+				{-32767, 16384},
+			},
+		},
+		{
+			name:            "clipped",
+			audio:           &sliceDecoder{rate: 8000, channels: 1, samples: []float32{1.5, -2}},
+			samplesPerPixel: []int{2},
+			want:            [][]int16{{-32768, 32767}},
+		},
+		{
+			name:            "no samples",
+			audio:           &sliceDecoder{rate: 8000, channels: 1},
+			samplesPerPixel: []int{256},
+			want:            [][]int16{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waveforms, err := ComputeWaveforms(tt.audio, tt.samplesPerPixel...)
+			if err != nil {
+				t.Fatalf("ComputeWaveforms() error = %v", err)
+			}
+			if len(waveforms) != len(tt.want) {
+				t.Fatalf("ComputeWaveforms() = %d waveforms, want %d", len(waveforms), len(tt.want))
+			}
+			for i, w := range waveforms {
+				if !reflect.DeepEqual(w.Data, tt.want[i]) {
+					t.Errorf("Data at %d samples per pixel = %v, want %v", tt.samplesPerPixel[i], w.Data, tt.want[i])
+				}
+				if w.Length != len(tt.want[i])/2 || w.SamplesPerPixel != tt.samplesPerPixel[i] || w.SampleRate != 8000 || w.Channels != 1 || w.Bits != 16 {
+					t.Errorf("waveform = %+v, want %d pixels of %d samples", w, len(tt.want[i])/2, tt.samplesPerPixel[i])
+				}
+			}
+		})
+	}
+}
+
+func TestComputeWaveformsErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		audio           *sliceDecoder
+		samplesPerPixel []int
+	}{
+		{name: "no samples per pixel", audio: &sliceDecoder{rate: 8000, channels: 1}, samplesPerPixel: []int{256, 0}},
+		{name: "negative samples per pixel", audio: &sliceDecoder{rate: 8000, channels: 1}, samplesPerPixel: []int{-1}},
+		{name: "no channels", audio: &sliceDecoder{rate: 8000}, samplesPerPixel: []int{256}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ComputeWaveforms(tt.audio, tt.samplesPerPixel...); err == nil {
+				t.Error("ComputeWaveforms() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestWaveformResize(t *testing.T) {
+	w := &Waveform{Version: 1, Channels: 1, SampleRate: 8000, SamplesPerPixel: 10, Bits: 16, Length: 5,
+		Data: []int16{-1, 1, -5, 2, -3, 7, 0, 0, -2, 4}}
+	tests := []struct {
+		length          int
+		samplesPerPixel int
+		want            []int16
+	}{
+		{length: 0, samplesPerPixel: 10, want: w.Data},
+		{length: 5, samplesPerPixel: 10, want: w.Data},
+		{length: 8, samplesPerPixel: 10, want: w.Data},
+		{length: 3, samplesPerPixel: 20, want: []int16{-5, 2, -3, 7, -2, 4}},
+		{length: 2, samplesPerPixel: 30, want: []int16{-5, 7, -2, 4}},
+		{length: 1, samplesPerPixel: 50, want: []int16{-5, 7}},
+	}
+	for _, tt := range tests {
+		resized := w.Resize(tt.length)
+		if !reflect.DeepEqual(resized.Data, tt.want) || resized.Length != len(tt.want)/2 || resized.SamplesPerPixel != tt.samplesPerPixel {
+			t.Errorf("Resize(%d) = %d pixels of %d samples %v, want %d of %d %v", tt.length,
+				resized.Length, resized.SamplesPerPixel, resized.Data, len(tt.want)/2, tt.samplesPerPixel, tt.want)
+		}
+	}
+}
+
+func TestWaveformDat(t *testing.T) {
+	tests := []struct {
+		name     string
+		waveform *Waveform
+		size     int64
+	}{
+		{
+			name:     "16 bit",
+			waveform: &Waveform{Version: 1, Channels: 1, SampleRate: 44100, SamplesPerPixel: 256, Bits: 16, Length: 2, Data: []int16{-32768, 32767, -5, 9}},
+			size:     28,
+		},
+		{
+			name:     "8 bit",
+			waveform: &Waveform{Version: 1, Channels: 1, SampleRate: 48000, SamplesPerPixel: 512, Bits: 8, Length: 2, Data: []int16{-128, 127, 0, 3}},
+			size:     24,
+		},
+		{
+			name:     "empty",
+			waveform: &Waveform{Version: 1, Channels: 1, SampleRate: 8000, SamplesPerPixel: 256, Bits: 16, Data: []int16{}},
+			size:     20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := tt.waveform.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if n != tt.size || int64(buf.Len()) != tt.size {
+				t.Errorf("WriteTo() = %d, wrote %d bytes, want %d", n, buf.Len(), tt.size)
+			}
+			got, err := ReadWaveform(&buf)
+			if err != nil {
+				t.Fatalf("ReadWaveform() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.waveform) {
+				t.Errorf("ReadWaveform() = %+v, want %+v", got, tt.waveform)
+			}
+		})
+	}
+}
+
+func TestReadWaveformErrors(t *testing.T) {
+	var valid bytes.Buffer
+	w := &Waveform{Version: 1, Channels: 1, SampleRate: 8000, SamplesPerPixel: 256, Bits: 16, Length: 2, Data: []int16{1, 2, 3, 4}}
+	if _, err := w.WriteTo(&valid); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	otherVersion := append([]byte{2}, valid.Bytes()[1:]...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "short header", data: valid.Bytes()[:12]},
+		{name: "short data", data: valid.Bytes()[:valid.Len()-1]},
+		{name: "version 2", data: otherVersion},
+		{name: "too long", data: append(append([]byte{}, valid.Bytes()[:16]...), 0xFF, 0xFF, 0xFF, 0xFF)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadWaveform(bytes.NewReader(tt.data)); err != errInvalidWaveform {
+				t.Errorf("ReadWaveform() error = %v, want %v", err, errInvalidWaveform)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WriteWAV writes the samples of d as a 16 bit PCM wav file. When w can seek the
+// chunk sizes are filled in at the end, otherwise they are left at the maximum
+// as usual for streamed wav.
+func WriteWAV(w io.Writer, d Decoder) error {
+	channels, rate := d.Channels(), d.SampleRate()
+	format := WAVFormat{AudioFormat: wavFormatPCM, Channels: channels, SampleRate: rate, BitsPerSample: 16}
+	if err := WriteWAVHeader(w, format, math.MaxUint32); err != nil {
+		return err
+	}
+
+	buf := make([]float32, 4096*channels)
+	out := make([]int16, len(buf))
+	size := int64(0)
+	for {
+		n, err := d.Read(buf)
+		for i := 0; i < n; i++ {
+			out[i] = int16(math.Max(-32768, math.Min(32767, math.Round(float64(buf[i])*32767))))
+		}
+		if n > 0 {
+			if err := binary.Write(w, binary.LittleEndian, out[:n]); err != nil {
+				return err
+			}
+			size += int64(n) * 2
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	seeker, ok := w.(io.WriteSeeker)
+	if !ok || size+36 > math.MaxUint32 {
+		return nil
+	}
+	for _, patch := range []struct {
+		offset int64
+		value  uint32
+	}{{4, uint32(size + 36)}, {40, uint32(size)}} {
+		if _, err := seeker.Seek(patch.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, patch.value); err != nil {
+			return err
+		}
+	}
+	_, err := seeker.Seek(0, io.SeekEnd)
+	return err
+}
+
+// WriteWAVHeader writes the chunks of a wav file of format up to the data
+// chunk, whose size bytes of samples are written next
+func WriteWAVHeader(w io.Writer, format WAVFormat, size uint32) error {
+	riffSize := uint32(math.MaxUint32)
+	if size <= math.MaxUint32-36 {
+		riffSize = size + 36
+	}
+	frameSize := format.Channels * format.BitsPerSample / 8
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, riffSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), format.AudioFormat, uint16(format.Channels),
+		uint32(format.SampleRate), uint32(format.SampleRate * frameSize), uint16(frameSize), uint16(format.BitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, size,
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const diskCacheTempPrefix = ".fill-"
+
+var errInvalidKey = errors.New("invalid disk cache key")
+
+// DiskCache keeps files in a directory up to a size budget, the least recently
+// used ones are evicted first. Keys are slash separated relative paths.
+type DiskCache struct {
+	dir    string
+	budget int64
+
+	mu    sync.Mutex
+	size  int64
+	items map[string]*list.Element
+	lru   *list.List // of *diskEntry, most recently used in front
+	fills map[string]*sync.Mutex
+}
+
+type diskEntry struct {
+	key  string
+	size int64
+}
+
+// NewDiskCache indexes the files already in dir, ordered by their modification
+// time, which is updated on every use
+func NewDiskCache(dir string, budget int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:    dir,
+		budget: budget,
+		items:  map[string]*list.Element{},
+		lru:    list.New(),
+		fills:  map[string]*sync.Mutex{},
+	}
+
+	type found struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	files := make([]found, 0)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), diskCacheTempPrefix) {
+			// left over by a fill which never finished
+			return os.Remove(path)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, found{key: filepath.ToSlash(key), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, file := range files {
+		c.items[file.key] = c.lru.PushFront(&diskEntry{key: file.key, size: file.size})
+		c.size += file.size
+	}
+	c.mu.Lock()
+	c.evict(nil)
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *DiskCache) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if len(key) == 0 || filepath.IsAbs(clean) || clean == "." || strings.HasPrefix(clean, "..") {
+		return "", errInvalidKey
+	}
+	return filepath.Join(c.dir, clean), nil
+}
+
+// Open returns the cached file of key, or nil when it is not cached
+func (c *DiskCache) Open(key string) (*os.File, error) {
+	path, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// removed behind the back of the cache
+		c.remove(element)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c.lru.MoveToFront(element)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return f, nil
+}
+
+// OpenOrFill returns the cached file of key, calling fill to create it when it
+// is not cached. Concurrent calls for the same key fill it only once.
+func (c *DiskCache) OpenOrFill(key string, fill func(f *os.File) error) (*os.File, error) {
+	path, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	lock, ok := c.fills[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.fills[key] = lock
+	}
+	c.mu.Unlock()
+	lock.Lock()
+	defer func() {
+		lock.Unlock()
+		c.mu.Lock()
+		if c.fills[key] == lock {
+			delete(c.fills, key)
+		}
+		c.mu.Unlock()
+	}()
+
+	if f, err := c.Open(key); f != nil || err != nil {
+		return f, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), diskCacheTempPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	if err := fill(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+	element := c.lru.PushFront(&diskEntry{key: key, size: info.Size()})
+	c.items[key] = element
+	c.size += info.Size()
+	c.evict(element)
+	return f, nil
+}
+
+// RemovePrefix removes the cached files whose key starts with prefix
+func (c *DiskCache) RemovePrefix(prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, element := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			if err := c.remove(element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evict removes the least recently used files until the cache fits its budget,
+// keep is never removed so a file larger than the budget can still be served
+func (c *DiskCache) evict(keep *list.Element) {
+	for c.budget > 0 && c.size > c.budget {
+		element := c.lru.Back()
+		if element == nil || element == keep {
+			return
+		}
+		c.remove(element)
+	}
+}
+
+func (c *DiskCache) remove(element *list.Element) error {
+	entry := element.Value.(*diskEntry)
+	c.lru.Remove(element)
+	delete(c.items, entry.key)
+	c.size -= entry.size
+	path, err := c.path(entry.key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,11 @@ import (
 	"time"
 )
 
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
 type IMemCache interface {
 	Set(key string, value interface{}) error
 	SetTTL(key string, value interface{}, t time.Duration) error
@@ -17,7 +22,10 @@ type IRedisCache interface {
 	Set(ctx context.Context, key string, value interface{}) error
 	SetNoTTL(ctx context.Context, key string, value any) error
 	SetTTL(ctx context.Context, key string, value interface{}, t time.Duration) error
+	// SetNX sets key only when it does not exist and tells whether it did so
+	SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error)
 	Get(ctx context.Context, key string) (string, error)
+	GetDel(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, key string) error
 	Dels(ctx context.Context, keys []string) error
 	HSet(ctx context.Context, key string, field string, value interface{}) error
@@ -26,6 +34,7 @@ type IRedisCache interface {
 	HDel(ctx context.Context, key string, field ...string) error
 	Keys(ctx context.Context, pattern string) ([]string, error)
 	Incr(ctx context.Context, key string) error
+	IncrBy(ctx context.Context, key string, value int64) error
 	Decr(ctx context.Context, key string) error
 	SetRaw(ctx context.Context, key string, value string) error
 	HSetRaw(ctx context.Context, key string, field string, value string) error
@@ -41,6 +50,10 @@ type IRedisCache interface {
 	ZRem(ctx context.Context, key string, value ...any) error
 	ZCount(ctx context.Context, key string, min, max float64) (int64, error)
 	ZScore(ctx context.Context, key string, member string) (float64, error)
+	ZIncrBy(ctx context.Context, key string, increment float64, member string) error
+	ZUnionStore(ctx context.Context, dest string, keys []string) error
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]ScoredMember, error)
+	Expire(ctx context.Context, key string, ttl time.Duration) error
 	SADDRaw(ctx context.Context, key string, value ...string) error
 	SREM(ctx context.Context, key string, value ...string) error
 }
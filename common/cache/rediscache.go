@@ -55,6 +55,14 @@ func (c *RedisCache) SetTTL(ctx context.Context, key string, value any, ttl time
 	return err
 }
 
+func (c *RedisCache) SetNX(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	valueStr, err := valueToString(value)
+	if err != nil {
+		return false, err
+	}
+	return c.client.SetNX(ctx, key, valueStr, ttl).Result()
+}
+
 func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	value, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -66,6 +74,15 @@ func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	}
 }
 
+// GetDel returns the value of key and deletes it in one step
+func (c *RedisCache) GetDel(ctx context.Context, key string) (string, error) {
+	value, err := c.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
 func (c *RedisCache) Close() {
 }
 
@@ -123,6 +140,11 @@ func (c *RedisCache) Incr(ctx context.Context, key string) error {
 	return err
 }
 
+func (c *RedisCache) IncrBy(ctx context.Context, key string, value int64) error {
+	_, err := c.client.IncrBy(ctx, key, value).Result()
+	return err
+}
+
 func (c *RedisCache) SetRaw(ctx context.Context, key string, value string) error {
 	_, err := c.client.Set(ctx, key, value, redis.KeepTTL).Result()
 	return err
@@ -245,3 +267,35 @@ func (c *RedisCache) ZScore(ctx context.Context, key string, member string) (flo
 	}
 	return score, err
 }
+
+func (c *RedisCache) ZIncrBy(ctx context.Context, key string, increment float64, member string) error {
+	_, err := c.client.ZIncrBy(ctx, key, increment, member).Result()
+	return err
+}
+
+// ZUnionStore stores the sum of the scores of the sorted sets keys in dest
+func (c *RedisCache) ZUnionStore(ctx context.Context, dest string, keys []string) error {
+	_, err := c.client.ZUnionStore(ctx, dest, &redis.ZStore{Keys: keys}).Result()
+	return err
+}
+
+// ZRevRangeWithScores returns the members ranked start to stop by descending score
+func (c *RedisCache) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]ScoredMember, error) {
+	value, err := c.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	members := make([]ScoredMember, 0, len(value))
+	for _, z := range value {
+		member, _ := z.Member.(string)
+		members = append(members, ScoredMember{Member: member, Score: z.Score})
+	}
+	return members, nil
+}
+
+func (c *RedisCache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := c.client.Expire(ctx, key, ttl).Result()
+	return err
+}
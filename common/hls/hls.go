@@ -0,0 +1,110 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ContentType is the media type of playlists
+const ContentType = "application/vnd.apple.mpegurl"
+
+// MP3Codecs is the CODECS attribute of mp3 audio
+const MP3Codecs = "mp4a.40.34"
+
+// Variant is a rendition listed in a master playlist
+type Variant struct {
+	URI              string
+	Bandwidth        int // peak bit/s
+	AverageBandwidth int
+	Codecs           string
+}
+
+// MasterPlaylist lists the renditions a client picks from
+type MasterPlaylist struct {
+	Variants []Variant
+}
+
+// Segment is a media segment listed in a media playlist
+type Segment struct {
+	URI      string
+	Duration float64 // seconds
+}
+
+// MediaPlaylist lists the segments of a whole track, as video on demand
+type MediaPlaylist struct {
+	Segments []Segment
+}
+
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	fmt.Fprint(out, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, variant := range p.Variants {
+		fmt.Fprintf(out, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,CODECS=%q\n%s\n",
+			variant.Bandwidth, variant.AverageBandwidth, variant.Codecs, variant.URI)
+	}
+	return out.n, out.flush()
+}
+
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	target := 1.0
+	for _, segment := range p.Segments {
+		target = math.Max(target, math.Ceil(segment.Duration))
+	}
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	fmt.Fprintf(out, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", int(target))
+	for _, segment := range p.Segments {
+		fmt.Fprintf(out, "#EXTINF:%.5f,\n%s\n", segment.Duration, segment.URI)
+	}
+	fmt.Fprint(out, "#EXT-X-ENDLIST\n")
+	return out.n, out.flush()
+}
+
+// TimestampTag is the ID3 tag packed audio segments start with, it carries the
+// presentation time of the first sample in the 33 bit MPEG-2 90 kHz clock
+func TimestampTag(start float64) []byte {
+	const owner = "com.apple.streaming.transportStreamTimestamp"
+	ticks := uint64(math.Round(start*90000)) & (1<<33 - 1)
+
+	data := append([]byte(owner), 0)
+	for shift := 56; shift >= 0; shift -= 8 {
+		data = append(data, byte(ticks>>shift))
+	}
+	frame := append([]byte("PRIV"), syncsafe(len(data))...)
+	frame = append(frame, 0, 0)
+	frame = append(frame, data...)
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = append(tag, syncsafe(len(frame))...)
+	return append(tag, frame...)
+}
+
+// syncsafe writes n in 4 bytes of 7 bits, as ID3v2.4 sizes are
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
+
+// countingWriter keeps the first write error and the bytes written
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.w.Flush()
+}
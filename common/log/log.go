@@ -1,97 +1,149 @@
 package log
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"runtime"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func Info(msg ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
+type requestIDKey struct{}
+
+var accessLogger = newAccessLogger()
+
+func newAccessLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&log.JSONFormatter{
+		TimestampFormat: "2006-01-02T15:04:05.999Z",
+	})
+	logger.SetLevel(log.InfoLevel)
+	return logger
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request id
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id stored in ctx, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// SetAccessOutput sets the writer used by the access logger
+func SetAccessOutput(out io.Writer) {
+	accessLogger.SetOutput(out)
+}
+
+// Access writes one JSON access log line
+func Access(fields map[string]interface{}) {
+	accessLogger.WithFields(log.Fields(fields)).Info("access")
+}
+
+// newEntry must be called directly from the exported logging function so the
+// meta field points at the caller of that function
+func newEntry(ctx context.Context) *log.Entry {
+	_, path, numLine, _ := runtime.Caller(2)
 	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
+	fields := log.Fields{
 		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Info(msg)
+	}
+	if requestID := RequestIDFromContext(ctx); len(requestID) > 0 {
+		fields["request_id"] = requestID
+	}
+	return log.WithFields(fields)
+}
+
+type Entry struct {
+	ctx context.Context
+}
+
+// WithContext returns an entry which adds the request id of ctx to every log line
+func WithContext(ctx context.Context) *Entry {
+	return &Entry{ctx: ctx}
+}
+
+func (e *Entry) Info(msg ...interface{}) {
+	newEntry(e.ctx).Info(msg...)
+}
+
+func (e *Entry) Warning(msg ...interface{}) {
+	newEntry(e.ctx).Warning(msg...)
+}
+
+func (e *Entry) Error(err ...interface{}) {
+	newEntry(e.ctx).Error(err...)
+}
+
+func (e *Entry) Debug(value ...interface{}) {
+	newEntry(e.ctx).Debug(value...)
+}
+
+func (e *Entry) Infof(format string, msg ...interface{}) {
+	newEntry(e.ctx).Infof(format, msg...)
+}
+
+func (e *Entry) Warningf(format string, msg ...interface{}) {
+	newEntry(e.ctx).Warningf(format, msg...)
+}
+
+func (e *Entry) Errorf(format string, err ...interface{}) {
+	newEntry(e.ctx).Errorf(format, err...)
+}
+
+func (e *Entry) Debugf(format string, value ...interface{}) {
+	newEntry(e.ctx).Debugf(format, value...)
+}
+
+func Info(msg ...interface{}) {
+	newEntry(context.Background()).Info(msg...)
 }
 
 func Warning(msg ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Warning(msg)
+	newEntry(context.Background()).Warning(msg...)
 }
 
 func Error(err ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Error(err)
+	newEntry(context.Background()).Error(err...)
 }
 
 func Debug(value ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Debug(value)
+	newEntry(context.Background()).Debug(value...)
 }
 
 func Fatal(value ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Fatal(value)
+	newEntry(context.Background()).Fatal(value...)
 }
 
 func Println(value ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Println(value)
+	newEntry(context.Background()).Println(value...)
 }
 
 func Infof(format string, msg ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Infof(format, msg...)
+	newEntry(context.Background()).Infof(format, msg...)
 }
 
 func Warningf(format string, msg ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Warningf(format, msg...)
+	newEntry(context.Background()).Warningf(format, msg...)
 }
 
 func Errorf(format string, err ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Errorf(format, err...)
+	newEntry(context.Background()).Errorf(format, err...)
 }
 
 func Debugf(format string, value ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Debugf(format, value...)
+	newEntry(context.Background()).Debugf(format, value...)
 }
 
 func Fatalf(format string, value ...interface{}) {
-	_, path, numLine, _ := runtime.Caller(1)
-	srcFile := filepath.Base(path)
-	log.WithFields(log.Fields{
-		"meta": fmt.Sprintf("%s:%d", srcFile, numLine),
-	}).Fatalf(format, value...)
+	newEntry(context.Background()).Fatalf(format, value...)
 }
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+type RotateConfig struct {
+	Filename   string
+	MaxSize    int64         // rotate when the file would grow beyond this many bytes, 0 disables
+	Interval   time.Duration // rotate when the current interval (e.g. 24h) has passed, 0 disables
+	MaxBackups int           // number of rotated files to keep, 0 keeps all
+	MaxAge     time.Duration // remove rotated files older than this, 0 keeps all
+	Compress   bool          // gzip rotated files
+}
+
+// RotatingFile is an io.Writer which appends to a log file and rotates it
+// by size and by time, keeping a bounded number of (compressed) backups
+type RotatingFile struct {
+	mu       sync.Mutex
+	cfg      RotateConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	millMu   sync.Mutex
+}
+
+func NewRotatingFile(cfg RotateConfig) (*RotatingFile, error) {
+	if len(cfg.Filename) == 0 {
+		return nil, errors.New("log file name is missing")
+	}
+	f := &RotatingFile{cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.cfg.Filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.cfg.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		// an existing file belongs to the interval in which it was last written
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(writeLen int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && f.size+writeLen > f.cfg.MaxSize {
+		return true
+	}
+	if f.cfg.Interval > 0 && !time.Now().Truncate(f.cfg.Interval).Equal(f.openedAt.Truncate(f.cfg.Interval)) {
+		return true
+	}
+	return false
+}
+
+// Rotate moves the current file aside and starts a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	backup := f.backupName(time.Now())
+	if err := os.Rename(f.cfg.Filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go f.mill(backup)
+	return nil
+}
+
+// Reopen closes and reopens the log file by name, so that a file moved away
+// by an external logrotate is replaced by a new one
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	return f.open()
+}
+
+// ReopenOnSignal reopens the log file every time one of sig is received
+func (f *RotatingFile) ReopenOnSignal(sig ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	go func() {
+		for range ch {
+			if err := f.Reopen(); err != nil {
+				Errorf("reopen log file %s failed: %v", f.cfg.Filename, err)
+			}
+		}
+	}()
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir := filepath.Dir(f.cfg.Filename)
+	ext := filepath.Ext(f.cfg.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.cfg.Filename), ext)
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, t.Format(backupTimeFormat), ext))
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			if _, err := os.Stat(name + ".gz"); os.IsNotExist(err) {
+				return name
+			}
+		}
+		name = filepath.Join(dir, fmt.Sprintf("%s-%s.%d%s", prefix, t.Format(backupTimeFormat), i, ext))
+	}
+}
+
+// mill compresses the new backup and removes the backups outside the retention
+func (f *RotatingFile) mill(backup string) {
+	f.millMu.Lock()
+	defer f.millMu.Unlock()
+	if f.cfg.Compress {
+		if err := compressFile(backup); err != nil {
+			Errorf("compress log file %s failed: %v", backup, err)
+		}
+	}
+	if err := f.removeOldBackups(); err != nil {
+		Errorf("remove old log files failed: %v", err)
+	}
+}
+
+type logBackup struct {
+	path string
+	time time.Time
+}
+
+func (f *RotatingFile) removeOldBackups() error {
+	if f.cfg.MaxBackups <= 0 && f.cfg.MaxAge <= 0 {
+		return nil
+	}
+	dir := filepath.Dir(f.cfg.Filename)
+	ext := filepath.Ext(f.cfg.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(f.cfg.Filename), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := make([]logBackup, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		stamp = strings.TrimPrefix(stamp, prefix)
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp[:len(backupTimeFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logBackup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+
+	for i, backup := range backups {
+		expired := f.cfg.MaxAge > 0 && time.Since(backup.time) > f.cfg.MaxAge
+		if (f.cfg.MaxBackups > 0 && i >= f.cfg.MaxBackups) || expired {
+			if err := os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
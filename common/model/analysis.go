@@ -0,0 +1,39 @@
+package model
+
+// ReplayGainReference is the loudness ReplayGain 2.0 normalizes to, in LUFS
+const ReplayGainReference = -18.0
+
+// Analysis states of the current audio of a track, a track without one is queued for analysis
+const (
+	AnalysisDone = "done"
+	// AnalysisUnsupported marks audio which could not be decoded
+	AnalysisUnsupported = "unsupported"
+)
+
+// Loudness is the EBU R128 analysis of a track with its ReplayGain 2.0 gains.
+// Gains are in dB, peaks linear with 1 as full scale.
+type Loudness struct {
+	Integrated float64 `json:"integrated_lufs" bson:"integrated"`
+	Range      float64 `json:"range_lu" bson:"range"`
+	TruePeak   float64 `json:"true_peak_dbtp" bson:"true_peak"`
+	TrackGain  float64 `json:"track_gain_db" bson:"track_gain"`
+	TrackPeak  float64 `json:"track_peak" bson:"track_peak"`
+	// the album gain covers the tracks with the same album name, tracks without one have none
+	AlbumGain *float64 `json:"album_gain_db,omitempty" bson:"album_gain,omitempty"`
+	AlbumPeak *float64 `json:"album_peak,omitempty" bson:"album_peak,omitempty"`
+	// Histogram holds the block loudness distribution the album gain is computed from
+	Histogram []uint32 `json:"-" bson:"histogram"`
+}
+
+// PlaybackHints tell players where the audio of a track starts and ends, for gapless
+// and crossfaded playback. Without analysis they span the whole track.
+type PlaybackHints struct {
+	TrackID    string  `json:"track_id"`
+	Duration   float64 `json:"duration"`
+	AudioStart float64 `json:"audio_start"`
+	AudioEnd   float64 `json:"audio_end"`
+	// Analyzed is false until the background analysis has measured the audio
+	Analyzed  bool     `json:"analyzed"`
+	TrackGain *float64 `json:"track_gain_db,omitempty"`
+	AlbumGain *float64 `json:"album_gain_db,omitempty"`
+}
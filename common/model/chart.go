@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	ChartTrack  = "track"
+	ChartArtist = "artist"
+	ChartGenre  = "genre"
+)
+
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+)
+
+type ChartFilter struct {
+	Type   string `json:"type"`
+	Window string `json:"window"`
+	Limit  int    `json:"limit"`
+}
+
+// Chart ranks tracks, artists or genres by their counted plays since From
+type Chart struct {
+	Type    string       `json:"type"`
+	Window  string       `json:"window"`
+	From    time.Time    `json:"from"`
+	Entries []ChartEntry `json:"entries"`
+}
+
+type ChartEntry struct {
+	Rank  int    `json:"rank"`
+	Key   string `json:"key"` // track id, artist or genre
+	Plays int64  `json:"plays"`
+	Track *Track `json:"track,omitempty"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// cover art sources
+const (
+	CoverEmbedded = "embedded" // extracted from the audio file
+	CoverUploaded = "upload"
+)
+
+// CoverArt is the artwork of a track or playlist, stored resized to the standard sizes
+type CoverArt struct {
+	Hash   string `json:"hash" bson:"hash"` // of the image, changes with it
+	Source string `json:"source" bson:"source"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// PlaylistDocument is a playlist read from or written to a playlist file
+type PlaylistDocument struct {
+	Name   string          `json:"name"`
+	Tracks []PlaylistEntry `json:"tracks"`
+}
+
+type PlaylistEntry struct {
+	TrackID  string  `json:"track_id,omitempty"`
+	Location string  `json:"location"`
+	Title    string  `json:"title"`
+	Artist   string  `json:"artist,omitempty"`
+	Album    string  `json:"album,omitempty"`
+	Duration float64 `json:"duration"` // seconds, 0 when unknown
+}
+
+type PlaylistImportMatch struct {
+	Entry     PlaylistEntry `json:"entry"`
+	TrackID   string        `json:"track_id"`
+	MatchedBy string        `json:"matched_by"` // 'id', 'path', 'title' or 'fuzzy'
+	Score     float64       `json:"score"`
+}
+
+type PlaylistImportReport struct {
+	Playlist  *Playlist             `json:"playlist"`
+	Matched   []PlaylistImportMatch `json:"matched"`
+	Unmatched []PlaylistEntry       `json:"unmatched"`
+}
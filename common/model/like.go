@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+const (
+	LikeTrack    = "track"
+	LikePlaylist = "playlist"
+)
+
+// Like is a track or playlist saved by a user, a user likes a target at most once
+type Like struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Kind      string    `json:"kind" bson:"kind"` // 'track' or 'playlist'
+	TargetID  string    `json:"target_id" bson:"target_id"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type LikeStatus struct {
+	Liked bool  `json:"liked"`
+	Likes int64 `json:"likes"`
+}
+
+// Library holds the tracks and playlists liked by a user, most recently liked first
+type Library struct {
+	Tracks    []Track    `json:"tracks"`
+	Playlists []Playlist `json:"playlists"`
+}
@@ -1,18 +1,73 @@
 package model
 
 import (
+	"sample/common/apperror"
+	"time"
+
 	"gopkg.in/validator.v2"
 )
 
 type Track struct {
-	ID          string  `json:"id" bson:"_id,omitempty"`
-	Title       string  `json:"title" bson:"title"`
-	Artist      string  `json:"artist" bson:"artist"`
-	Album       string  `json:"album" bson:"album"`
-	Genre       string  `json:"genre" bson:"genre"`
-	ReleaseYear int     `json:"release_year" bson:"release_year"`
-	Duration    float64 `json:"duration" bson:"duration"`
-	MP3File     string  `json:"mp3_file" bson:"mp3_file"`
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	Title       string    `json:"title" bson:"title"`
+	Artist      string    `json:"artist" bson:"artist"`
+	Album       string    `json:"album" bson:"album"`
+	Genre       string    `json:"genre" bson:"genre"`
+	ReleaseYear int       `json:"release_year" bson:"release_year"`
+	Duration    float64   `json:"duration" bson:"duration"`
+	MP3File     string    `json:"mp3_file" bson:"mp3_file"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	Likes       int64     `json:"likes" bson:"likes"`
+	Version     int64     `json:"version" bson:"version"`
+
+	Fingerprint *AudioFingerprint `json:"fingerprint,omitempty" bson:"fingerprint,omitempty"`
+	// AlternateOf is the track whose audio this one duplicates, see DuplicateLink
+	AlternateOf string `json:"alternate_of,omitempty" bson:"alternate_of,omitempty"`
+	// Analysis is the state of the background analysis, which fills in the fields below after upload
+	Analysis string `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	// Loudness, BPM and Key are filled in by the background analysis after upload
+	Loudness *Loudness `json:"loudness,omitempty" bson:"loudness,omitempty"`
+	BPM      float64   `json:"bpm,omitempty" bson:"bpm,omitempty"`
+	Key      string    `json:"key,omitempty" bson:"key,omitempty"` // e.g. "A minor"
+	// AudioStart and AudioEnd bound the audio above the silence threshold, in seconds
+	AudioStart float64   `json:"audio_start,omitempty" bson:"audio_start,omitempty"`
+	AudioEnd   float64   `json:"audio_end,omitempty" bson:"audio_end,omitempty"`
+	Cover      *CoverArt `json:"cover,omitempty" bson:"cover,omitempty"`
+}
+
+// AudioFingerprint identifies the audio of a track independent of its tags.
+// The acoustic fingerprint is only computed for formats decodable to PCM.
+type AudioFingerprint struct {
+	ContentHash string   `json:"content_hash" bson:"content_hash"`
+	Acoustic    []uint32 `json:"-" bson:"acoustic,omitempty"`
+}
+
+// DuplicatePolicy decides what happens to an upload whose audio is already in the catalog
+type DuplicatePolicy string
+
+const (
+	DuplicateReject DuplicatePolicy = "reject"
+	DuplicateLink   DuplicatePolicy = "link"
+)
+
+// TagWriting decides when the catalog fields are written into the ID3 tags of mp3 files
+type TagWriting string
+
+const (
+	TagWritingOff TagWriting = "off"
+	// TagWritingStore rewrites the tags of the stored file whenever the fields change
+	TagWritingStore TagWriting = "store"
+	// TagWritingDownload writes the tags into each download, the stored file keeps the uploaded ones
+	TagWritingDownload TagWriting = "download"
+)
+
+// DuplicateCluster is a group of tracks with the same audio. Match is
+// "content" when all of them have the same content hash, "acoustic" when
+// some only sound the same.
+type DuplicateCluster struct {
+	Match       string  `json:"match"`
+	ContentHash string  `json:"content_hash,omitempty"`
+	Tracks      []Track `json:"tracks"`
 }
 
 type TrackRequest struct {
@@ -26,36 +81,89 @@ type TrackRequest struct {
 
 func (track *TrackRequest) Validate() error {
 	if errs := validator.Validate(track); errs != nil {
-		return errs
+		return apperror.Validation(errs, track)
 	}
 	return nil
 }
 
 type Playlist struct {
-	ID           string     `json:"id" bson:"_id,omitempty"`
-	Name         string     `json:"name" bson:"name"`
-	TrackIds     []TrackIds `json:"track_ids" bson:"track_ids"`
-	PlaybackMode string     `json:"playback_mode" bson:"playback_mode"` // 'priority' or 'random'
+	ID           string         `json:"id" bson:"_id,omitempty"`
+	Name         string         `json:"name" bson:"name"`
+	TrackIds     []TrackIds     `json:"track_ids" bson:"track_ids"`
+	PlaybackMode string         `json:"playback_mode" bson:"playback_mode"`     // 'priority' or 'random'
+	Smart        *SmartPlaylist `json:"smart,omitempty" bson:"smart,omitempty"` // track_ids are computed from the rules when set
+	Cover        *CoverArt      `json:"cover,omitempty" bson:"cover,omitempty"` // a mosaic of its tracks is served when nil
+	Likes        int64          `json:"likes" bson:"likes"`
+	Version      int64          `json:"version" bson:"version"`
 }
 
 type PlaylistRequest struct {
-	Name         string     `json:"name" bson:"name" validate:"nonzero"`
-	TrackIds     []TrackIds `json:"track_ids" bson:"track_ids"`
-	PlaybackMode string     `json:"playback_mode" bson:"playback_mode"`
+	Name         string         `json:"name" bson:"name" validate:"nonzero"`
+	TrackIds     []TrackIds     `json:"track_ids" bson:"track_ids"`
+	PlaybackMode string         `json:"playback_mode" bson:"playback_mode"`
+	Smart        *SmartPlaylist `json:"smart,omitempty" bson:"smart,omitempty"`
 }
 
 func (playlist *PlaylistRequest) Validate() error {
 	if errs := validator.Validate(playlist); errs != nil {
-		return errs
+		return apperror.Validation(errs, playlist)
+	}
+	if playlist.Smart != nil {
+		if len(playlist.TrackIds) > 0 {
+			return apperror.FieldValidation(apperror.FieldError{Field: "track_ids", Code: "exclusive", Message: "can not be set on a smart playlist"})
+		}
+		return playlist.Smart.Validate()
 	}
 	return nil
 }
 
+type PlaylistTracksRequest struct {
+	TrackIds []TrackIds `json:"track_ids" validate:"min=1"`
+	Position *int       `json:"position"` // index to insert at, the tracks are appended when missing
+}
+
+func (request *PlaylistTracksRequest) Validate() error {
+	if errs := validator.Validate(request); errs != nil {
+		return apperror.Validation(errs, request)
+	}
+	return nil
+}
+
+type PlaylistMoveRequest struct {
+	From  int `json:"from" validate:"min=0"`
+	Count int `json:"count" validate:"min=1"`
+	To    int `json:"to" validate:"min=0"` // index of the first moved entry in the new ordering
+}
+
+func (request *PlaylistMoveRequest) Validate() error {
+	if errs := validator.Validate(request); errs != nil {
+		return apperror.Validation(errs, request)
+	}
+	return nil
+}
+
+type PlaylistPriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
 type TrackIds struct {
 	TrackID  string `json:"track_id" bson:"track_id"`
 	Priority int    `json:"priority" bson:"priority"`
 }
 
+type PatchType string
+
+const (
+	MergePatch PatchType = "merge-patch" // RFC 7396 JSON Merge Patch
+	JSONPatch  PatchType = "json-patch"  // RFC 6902 JSON Patch
+)
+
+// Patch is a partial update of a track or a playlist
+type Patch struct {
+	Type     PatchType
+	Document []byte
+}
+
 type TrackFilter struct {
 	Title  string `json:"title"`
 	Artist string `json:"artist"`
@@ -63,6 +171,13 @@ type TrackFilter struct {
 	Genre  string `json:"genre"`
 	Limit  int    `json:"limit"`
 	Offset int    `json:"offset"`
+
+	BPMMin float64 `json:"bpm_min"`
+	BPMMax float64 `json:"bpm_max"`
+	Key    string  `json:"key"`
+
+	Rules *SmartRules `json:"-"` // rules of a smart playlist
+	Sort  string      `json:"-"` // track field, prefixed with '-' for descending
 }
 
 type PlaylistFilter struct {
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"sample/common/apperror"
+	"time"
+
+	"gopkg.in/validator.v2"
+)
+
+// Play is one listening event, plays are never changed once recorded
+type Play struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	TrackID    string    `json:"track_id" bson:"track_id"`
+	PlaylistID string    `json:"playlist_id,omitempty" bson:"playlist_id,omitempty"`
+	PlayedAt   time.Time `json:"played_at" bson:"played_at"` // when the play started
+	Duration   float64   `json:"duration" bson:"duration"`   // seconds listened
+	Counted    bool      `json:"counted" bson:"counted"`     // whether the play adds to the play count
+}
+
+type PlayRequest struct {
+	Duration   float64    `json:"duration" validate:"min=0"`
+	PlaylistID string     `json:"playlist_id"`
+	PlayedAt   *time.Time `json:"played_at"` // defaults to the time the event is received
+}
+
+func (request *PlayRequest) Validate() error {
+	if errs := validator.Validate(request); errs != nil {
+		return apperror.Validation(errs, request)
+	}
+	return nil
+}
+
+type PlayFilter struct {
+	UserID  string `json:"user_id"`
+	TrackID string `json:"track_id"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+type TrackPlayCount struct {
+	TrackID string `json:"track_id"`
+	Count   int64  `json:"count"`
+}
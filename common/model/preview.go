@@ -0,0 +1,8 @@
+package model
+
+// PreviewRequest selects the excerpt of a track to preview, in seconds
+type PreviewRequest struct {
+	Start  *float64 `json:"start,omitempty"` // the configured share of the duration when nil
+	Length float64  `json:"length"`
+	Fade   bool     `json:"fade"`
+}
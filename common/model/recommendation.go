@@ -0,0 +1,16 @@
+package model
+
+// Recommendation is a track with its similarity to the seed, between 0 and 1
+type Recommendation struct {
+	Track   Track    `json:"track"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"` // e.g. 'same artist', 'played by the same listeners'
+}
+
+// RadioQueue is the next part of an endless radio queue, the session is passed
+// back to continue the queue without repeating tracks
+type RadioQueue struct {
+	Session string           `json:"session"`
+	Seed    string           `json:"seed"`
+	Tracks  []Recommendation `json:"tracks"`
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+	"sample/common/apperror"
+	"time"
+)
+
+const (
+	MatchAll = "all" // every rule and group has to match
+	MatchAny = "any" // one rule or group has to match
+)
+
+const (
+	RuleIn          = "in"       // field is one of values
+	RuleContains    = "contains" // field contains text, case insensitive
+	RuleBetween     = "between"  // min <= field <= max
+	RuleLessThan    = "lt"       // field < number
+	RuleGreaterThan = "gt"       // field > number
+	RuleAfter       = "after"    // field is later than date
+	RuleBefore      = "before"   // field is earlier than date
+)
+
+const (
+	// MaxSmartLimit bounds the tracks of a smart playlist, it applies to playlists without a limit
+	MaxSmartLimit = 1000
+	maxSmartDepth = 4
+)
+
+// smartFieldOperators lists the operators allowed on each track field
+var smartFieldOperators = map[string][]string{
+	"title":        {RuleIn, RuleContains},
+	"artist":       {RuleIn, RuleContains},
+	"album":        {RuleIn, RuleContains},
+	"genre":        {RuleIn, RuleContains},
+	"release_year": {RuleBetween, RuleLessThan, RuleGreaterThan},
+	"duration":     {RuleBetween, RuleLessThan, RuleGreaterThan},
+	"created_at":   {RuleAfter, RuleBefore},
+}
+
+// SmartRule is a condition on a track field, the operator decides which value is used:
+// in takes values, contains takes text, between takes min and max, lt and gt take
+// number, after and before take date
+type SmartRule struct {
+	Field    string     `json:"field" bson:"field"`
+	Operator string     `json:"operator" bson:"operator"`
+	Values   []string   `json:"values,omitempty" bson:"values,omitempty"`
+	Text     string     `json:"text,omitempty" bson:"text,omitempty"`
+	Number   *float64   `json:"number,omitempty" bson:"number,omitempty"`
+	Min      *float64   `json:"min,omitempty" bson:"min,omitempty"`
+	Max      *float64   `json:"max,omitempty" bson:"max,omitempty"`
+	Date     *time.Time `json:"date,omitempty" bson:"date,omitempty"`
+}
+
+// SmartRules combines rules and nested groups with AND ('all') or OR ('any')
+type SmartRules struct {
+	Match  string       `json:"match" bson:"match"`
+	Rules  []SmartRule  `json:"rules" bson:"rules"`
+	Groups []SmartRules `json:"groups,omitempty" bson:"groups,omitempty"`
+}
+
+// SmartPlaylist defines the tracks of a playlist by rules, they are evaluated whenever the playlist is read
+type SmartPlaylist struct {
+	Rules SmartRules `json:"rules" bson:"rules"`
+	Sort  string     `json:"sort,omitempty" bson:"sort,omitempty"` // track field, prefixed with '-' for descending
+	Limit int        `json:"limit,omitempty" bson:"limit,omitempty"`
+}
+
+func (smart *SmartPlaylist) Validate() error {
+	fields := smart.Rules.validate("smart.rules", 1)
+	sortField := smart.Sort
+	if len(sortField) > 0 && sortField[0] == '-' {
+		sortField = sortField[1:]
+	}
+	if _, ok := smartFieldOperators[sortField]; len(smart.Sort) > 0 && !ok {
+		fields = append(fields, apperror.FieldError{Field: "smart.sort", Code: "invalid", Message: "is not a track field"})
+	}
+	if smart.Limit < 0 || smart.Limit > MaxSmartLimit {
+		fields = append(fields, apperror.FieldError{Field: "smart.limit", Code: "range", Message: fmt.Sprintf("must be between 0 and %d", MaxSmartLimit)})
+	}
+	if len(fields) > 0 {
+		return apperror.FieldValidation(fields...)
+	}
+	return nil
+}
+
+func (rules *SmartRules) validate(path string, depth int) []apperror.FieldError {
+	fields := []apperror.FieldError{}
+	if rules.Match != MatchAll && rules.Match != MatchAny {
+		fields = append(fields, apperror.FieldError{Field: path + ".match", Code: "invalid", Message: "must be all or any"})
+	}
+	if len(rules.Rules) == 0 && len(rules.Groups) == 0 {
+		fields = append(fields, apperror.FieldError{Field: path + ".rules", Code: "required", Message: "is required"})
+	}
+	for i := range rules.Rules {
+		fields = append(fields, rules.Rules[i].validate(fmt.Sprintf("%s.rules[%d]", path, i))...)
+	}
+	if len(rules.Groups) > 0 && depth >= maxSmartDepth {
+		fields = append(fields, apperror.FieldError{Field: path + ".groups", Code: "max", Message: fmt.Sprintf("can not be nested deeper than %d", maxSmartDepth)})
+		return fields
+	}
+	for i := range rules.Groups {
+		fields = append(fields, rules.Groups[i].validate(fmt.Sprintf("%s.groups[%d]", path, i), depth+1)...)
+	}
+	return fields
+}
+
+func (rule *SmartRule) validate(path string) []apperror.FieldError {
+	operators, ok := smartFieldOperators[rule.Field]
+	if !ok {
+		return []apperror.FieldError{{Field: path + ".field", Code: "invalid", Message: "is not a track field"}}
+	}
+	supported := false
+	for _, operator := range operators {
+		supported = supported || operator == rule.Operator
+	}
+	if !supported {
+		return []apperror.FieldError{{Field: path + ".operator", Code: "invalid", Message: "is not supported on " + rule.Field}}
+	}
+
+	missing := func(value string) []apperror.FieldError {
+		return []apperror.FieldError{{Field: path + "." + value, Code: "required", Message: "is required"}}
+	}
+	switch rule.Operator {
+	case RuleIn:
+		if len(rule.Values) == 0 {
+			return missing("values")
+		}
+	case RuleContains:
+		if len(rule.Text) == 0 {
+			return missing("text")
+		}
+	case RuleBetween:
+		if rule.Min == nil {
+			return missing("min")
+		} else if rule.Max == nil {
+			return missing("max")
+		} else if *rule.Min > *rule.Max {
+			return []apperror.FieldError{{Field: path + ".max", Code: "min", Message: "is less than min"}}
+		}
+	case RuleLessThan, RuleGreaterThan:
+		if rule.Number == nil {
+			return missing("number")
+		}
+	case RuleAfter, RuleBefore:
+		if rule.Date == nil {
+			return missing("date")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package model
+
+// PlaylistExpand selects what is added to a playlist read
+type PlaylistExpand struct {
+	Tracks bool
+	Stats  bool
+}
+
+// PlaylistDetail is a playlist with its tracks and statistics expanded
+type PlaylistDetail struct {
+	Playlist
+	Tracks []Track        `json:"tracks,omitempty"` // in playlist order, tracks which no longer exist are left out
+	Stats  *PlaylistStats `json:"stats,omitempty"`
+}
+
+type PlaylistStats struct {
+	TrackCount    int           `json:"track_count"`
+	TotalDuration float64       `json:"total_duration"` // seconds
+	Genres        []GenreStats  `json:"genres"`         // by track count, descending
+	TopArtists    []ArtistStats `json:"top_artists"`    // by track count, descending
+}
+
+type GenreStats struct {
+	Genre      string  `json:"genre"`
+	TrackCount int     `json:"track_count"`
+	Duration   float64 `json:"duration"`
+	Share      float64 `json:"share"` // fraction of the tracks of the playlist
+}
+
+type ArtistStats struct {
+	Artist     string  `json:"artist"`
+	TrackCount int     `json:"track_count"`
+	Duration   float64 `json:"duration"`
+}
@@ -0,0 +1,24 @@
+package playlistformat
+
+import (
+	"encoding/json"
+	"io"
+	"sample/common/model"
+)
+
+func encodeJSON(w io.Writer, doc model.PlaylistDocument) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func decodeJSON(r io.Reader) (model.PlaylistDocument, error) {
+	doc := model.PlaylistDocument{}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return doc, err
+	}
+	if doc.Tracks == nil {
+		doc.Tracks = []model.PlaylistEntry{}
+	}
+	return doc, nil
+}
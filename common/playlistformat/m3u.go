@@ -0,0 +1,66 @@
+package playlistformat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sample/common/model"
+	"strconv"
+	"strings"
+)
+
+func encodeM3U8(w io.Writer, doc model.PlaylistDocument) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if len(doc.Name) > 0 {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", oneLine(doc.Name))
+	}
+	for _, entry := range doc.Tracks {
+		duration := -1
+		if entry.Duration > 0 {
+			duration = int(math.Round(entry.Duration))
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", duration, oneLine(displayTitle(entry)))
+		if len(entry.Album) > 0 {
+			fmt.Fprintf(bw, "#EXTALB:%s\n", oneLine(entry.Album))
+		}
+		fmt.Fprintln(bw, entry.Location)
+	}
+	return bw.Flush()
+}
+
+func decodeM3U8(r io.Reader) (model.PlaylistDocument, error) {
+	doc := model.PlaylistDocument{Tracks: []model.PlaylistEntry{}}
+	entry := model.PlaylistEntry{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case len(line) == 0, line == "#EXTM3U":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			doc.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			durationStr, title, _ := strings.Cut(info, ",")
+			// attributes like tvg-id="x" may follow the duration
+			durationStr, _, _ = strings.Cut(strings.TrimSpace(durationStr), " ")
+			if duration, err := strconv.ParseFloat(durationStr, 64); err == nil && duration > 0 {
+				entry.Duration = duration
+			}
+			entry.Artist, entry.Title = splitDisplayTitle(title)
+		case strings.HasPrefix(line, "#EXTALB:"):
+			entry.Album = strings.TrimSpace(strings.TrimPrefix(line, "#EXTALB:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			entry.Location = line
+			doc.Tracks = append(doc.Tracks, entry)
+			entry = model.PlaylistEntry{}
+		}
+	}
+	return doc, scanner.Err()
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
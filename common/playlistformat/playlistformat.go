@@ -0,0 +1,89 @@
+package playlistformat
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sample/common/model"
+	"strings"
+)
+
+const (
+	M3U8 = "m3u8"
+	PLS  = "pls"
+	XSPF = "xspf"
+	JSON = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown playlist format")
+
+var contentTypes = map[string]string{
+	M3U8: "audio/x-mpegurl",
+	PLS:  "audio/x-scpls",
+	XSPF: "application/xspf+xml",
+	JSON: "application/json",
+}
+
+// ContentType returns the media type of format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FromFilename guesses the format from the extension of a playlist file
+func FromFilename(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".m3u8", ".m3u":
+		return M3U8
+	case ".pls":
+		return PLS
+	case ".xspf":
+		return XSPF
+	case ".json":
+		return JSON
+	}
+	return ""
+}
+
+func Encode(w io.Writer, format string, doc model.PlaylistDocument) error {
+	switch format {
+	case M3U8:
+		return encodeM3U8(w, doc)
+	case PLS:
+		return encodePLS(w, doc)
+	case XSPF:
+		return encodeXSPF(w, doc)
+	case JSON:
+		return encodeJSON(w, doc)
+	}
+	return ErrUnknownFormat
+}
+
+func Decode(r io.Reader, format string) (model.PlaylistDocument, error) {
+	switch format {
+	case M3U8:
+		return decodeM3U8(r)
+	case PLS:
+		return decodePLS(r)
+	case XSPF:
+		return decodeXSPF(r)
+	case JSON:
+		return decodeJSON(r)
+	}
+	return model.PlaylistDocument{}, ErrUnknownFormat
+}
+
+// displayTitle is the "Artist - Title" form used by M3U and PLS
+func displayTitle(entry model.PlaylistEntry) string {
+	if len(entry.Artist) > 0 {
+		return entry.Artist + " - " + entry.Title
+	}
+	return entry.Title
+}
+
+// splitDisplayTitle is the inverse of displayTitle
+func splitDisplayTitle(title string) (string, string) {
+	if artist, name, ok := strings.Cut(title, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(name)
+	}
+	return "", strings.TrimSpace(title)
+}
@@ -0,0 +1,204 @@
+package playlistformat
+
+import (
+	"bytes"
+	"reflect"
+	"sample/common/model"
+	"strings"
+	"testing"
+)
+
+func TestDecodeM3U8(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  model.PlaylistDocument
+	}{
+		{
+			name:  "empty",
+			input: "#EXTM3U\n",
+			want:  model.PlaylistDocument{Tracks: []model.PlaylistEntry{}},
+		},
+		{
+			name:  "plain paths",
+			input: "a.mp3\r\n\r\nmusic/b.mp3\r\n",
+			want: model.PlaylistDocument{Tracks: []model.PlaylistEntry{
+				{Location: "a.mp3"},
+				{Location: "music/b.mp3"},
+			}},
+		},
+		{
+			name: "extended",
+			input: "\ufeff#EXTM3U\n#PLAYLIST:Road Trip\n#EXTINF:215,Queen - Bohemian Rhapsody\n#EXTALB:A Night at the Opera\n" +
+				"queen/bohemian.mp3\n#EXTINF:-1,Untitled\nuntitled.mp3\n",
+			want: model.PlaylistDocument{Name: "Road Trip", Tracks: []model.PlaylistEntry{
+				{Location: "queen/bohemian.mp3", Title: "Bohemian Rhapsody", Artist: "Queen", Album: "A Night at the Opera", Duration: 215},
+				{Location: "untitled.mp3", Title: "Untitled"},
+			}},
+		},
+		{
+			name:  "attributes after the duration",
+			input: "#EXTM3U\n#EXTINF:180 tvg-id=\"x\" group-title=\"y\",Daft Punk - Around the World\nhttp://example.com/a.mp3\n",
+			want: model.PlaylistDocument{Tracks: []model.PlaylistEntry{
+				{Location: "http://example.com/a.mp3", Title: "Around the World", Artist: "Daft Punk", Duration: 180},
+			}},
+		},
+		{
+			name:  "unknown directives are skipped",
+			input: "#EXTM3U\n#EXTGRP:Rock\n#EXTINF:60,Song\n#EXTBYT:1234\nsong.mp3\n",
+			want: model.PlaylistDocument{Tracks: []model.PlaylistEntry{
+				{Location: "song.mp3", Title: "Song", Duration: 60},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(tt.input), M3U8)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeXSPF(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    model.PlaylistDocument
+		wantErr bool
+	}{
+		{
+			name:  "empty track list",
+			input: `<?xml version="1.0"?><playlist version="1" xmlns="http://xspf.org/ns/0/"><title>Empty</title><trackList/></playlist>`,
+			want:  model.PlaylistDocument{Name: "Empty", Tracks: []model.PlaylistEntry{}},
+		},
+		{
+			name: "tracks",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Mix</title>
+  <trackList>
+    <track>
+      <location>file:///music/a.mp3</location>
+      <identifier>urn:music-api:track:1234</identifier>
+      <title>Around the World</title>
+      <creator>Daft Punk</creator>
+      <album>Homework</album>
+      <duration>429500</duration>
+    </track>
+    <track>
+      <identifier>urn:isrc:GBDUW0000059</identifier>
+      <title>Only a Title</title>
+    </track>
+  </trackList>
+</playlist>`,
+			want: model.PlaylistDocument{Name: "Mix", Tracks: []model.PlaylistEntry{
+				{TrackID: "1234", Location: "file:///music/a.mp3", Title: "Around the World", Artist: "Daft Punk", Album: "Homework", Duration: 429.5},
+				{Title: "Only a Title"},
+			}},
+		},
+		{
+			name:    "other namespace",
+			input:   `<playlist version="1"><trackList/></playlist>`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			input:   `<playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(tt.input), XSPF)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePLS(t *testing.T) {
+	input := "[playlist]\nX-Name=Mix\nFile2=b.mp3\nTitle2=B\nFile1=a.mp3\nTitle1=Artist - A\nLength1=120\nLength2=-1\n" +
+		"Title3=No File\nNumberOfEntries=3\nVersion=2\n"
+	want := model.PlaylistDocument{Name: "Mix", Tracks: []model.PlaylistEntry{
+		{Location: "a.mp3", Title: "A", Artist: "Artist", Duration: 120},
+		{Location: "b.mp3", Title: "B"},
+	}}
+	got, err := Decode(strings.NewReader(input), PLS)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	doc := model.PlaylistDocument{Name: "Mix", Tracks: []model.PlaylistEntry{
+		{Location: "queen/bohemian.mp3", Title: "Bohemian Rhapsody", Artist: "Queen", Album: "A Night at the Opera", Duration: 355},
+		{Location: "untitled.mp3", Title: "Untitled"},
+	}}
+	tests := []struct {
+		format string
+		want   model.PlaylistDocument
+	}{
+		{format: M3U8, want: doc},
+		{format: XSPF, want: doc},
+		{format: JSON, want: doc},
+		// pls carries no albums
+		{format: PLS, want: model.PlaylistDocument{Name: "Mix", Tracks: []model.PlaylistEntry{
+			{Location: "queen/bohemian.mp3", Title: "Bohemian Rhapsody", Artist: "Queen", Duration: 355},
+			{Location: "untitled.mp3", Title: "Untitled"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.format, doc); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := Decode(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"mix.m3u8":   M3U8,
+		"MIX.M3U":    M3U8,
+		"radio.pls":  PLS,
+		"list.xspf":  XSPF,
+		"dump.json":  JSON,
+		"notes.txt":  "",
+		"no_ext":     "",
+		"dir.m3u/ab": "",
+	}
+	for filename, want := range tests {
+		if got := FromFilename(filename); got != want {
+			t.Errorf("FromFilename(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := Decode(strings.NewReader(""), "wpl"); err != ErrUnknownFormat {
+		t.Errorf("Decode() error = %v, want %v", err, ErrUnknownFormat)
+	}
+	if err := Encode(&bytes.Buffer{}, "wpl", model.PlaylistDocument{}); err != ErrUnknownFormat {
+		t.Errorf("Encode() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
@@ -0,0 +1,87 @@
+package playlistformat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sample/common/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func encodePLS(w io.Writer, doc model.PlaylistDocument) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	if len(doc.Name) > 0 {
+		fmt.Fprintf(bw, "X-Name=%s\n", oneLine(doc.Name))
+	}
+	for i, entry := range doc.Tracks {
+		duration := -1
+		if entry.Duration > 0 {
+			duration = int(math.Round(entry.Duration))
+		}
+		fmt.Fprintf(bw, "File%d=%s\n", i+1, entry.Location)
+		fmt.Fprintf(bw, "Title%d=%s\n", i+1, oneLine(displayTitle(entry)))
+		fmt.Fprintf(bw, "Length%d=%d\n", i+1, duration)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(doc.Tracks))
+	fmt.Fprintln(bw, "Version=2")
+	return bw.Flush()
+}
+
+func decodePLS(r io.Reader) (model.PlaylistDocument, error) {
+	doc := model.PlaylistDocument{Tracks: []model.PlaylistEntry{}}
+	entries := map[int]*model.PlaylistEntry{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key == "x-name" {
+			doc.Name = value
+			continue
+		}
+
+		// FileN, TitleN and LengthN describe entry N
+		field := strings.TrimRight(key, "0123456789")
+		index, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		entry, ok := entries[index]
+		if !ok {
+			entry = &model.PlaylistEntry{}
+			entries[index] = entry
+		}
+		switch field {
+		case "file":
+			entry.Location = value
+		case "title":
+			entry.Artist, entry.Title = splitDisplayTitle(value)
+		case "length":
+			if duration, err := strconv.ParseFloat(value, 64); err == nil && duration > 0 {
+				entry.Duration = duration
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return doc, err
+	}
+
+	indexes := make([]int, 0, len(entries))
+	for index := range entries {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		if len(entries[index].Location) > 0 {
+			doc.Tracks = append(doc.Tracks, *entries[index])
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,71 @@
+package playlistformat
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"sample/common/model"
+)
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location,omitempty"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"` // milliseconds
+}
+
+const trackURNPrefix = "urn:music-api:track:"
+
+func encodeXSPF(w io.Writer, doc model.PlaylistDocument) error {
+	playlist := xspfPlaylist{Version: "1", Title: doc.Name}
+	for _, entry := range doc.Tracks {
+		track := xspfTrack{
+			Location: entry.Location,
+			Title:    entry.Title,
+			Creator:  entry.Artist,
+			Album:    entry.Album,
+			Duration: int64(math.Round(entry.Duration * 1000)),
+		}
+		if len(entry.TrackID) > 0 {
+			track.Identifier = trackURNPrefix + entry.TrackID
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(playlist)
+}
+
+func decodeXSPF(r io.Reader) (model.PlaylistDocument, error) {
+	playlist := xspfPlaylist{}
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return model.PlaylistDocument{}, err
+	}
+	doc := model.PlaylistDocument{Name: playlist.Title, Tracks: []model.PlaylistEntry{}}
+	for _, track := range playlist.Tracks {
+		entry := model.PlaylistEntry{
+			Location: track.Location,
+			Title:    track.Title,
+			Artist:   track.Creator,
+			Album:    track.Album,
+			Duration: float64(track.Duration) / 1000,
+		}
+		if len(track.Identifier) > len(trackURNPrefix) && track.Identifier[:len(trackURNPrefix)] == trackURNPrefix {
+			entry.TrackID = track.Identifier[len(trackURNPrefix):]
+		}
+		doc.Tracks = append(doc.Tracks, entry)
+	}
+	return doc, nil
+}
@@ -0,0 +1,64 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"sample/common/apperror"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type   string                `json:"type"`
+	Title  string                `json:"title"`
+	Status int                   `json:"status"`
+	Detail string                `json:"detail,omitempty"`
+	Code   string                `json:"code"`
+	Errors []apperror.FieldError `json:"errors,omitempty"`
+}
+
+var kindStatus = map[apperror.Kind]int{
+	apperror.KindInternal:     http.StatusInternalServerError,
+	apperror.KindBadRequest:   http.StatusBadRequest,
+	apperror.KindValidation:   http.StatusBadRequest,
+	apperror.KindNotFound:     http.StatusNotFound,
+	apperror.KindConflict:     http.StatusConflict,
+	apperror.KindUnauthorized: http.StatusUnauthorized,
+
+	apperror.KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperror.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	apperror.KindPreconditionRequired: http.StatusPreconditionRequired,
+	apperror.KindTooLarge:             http.StatusRequestEntityTooLarge,
+}
+
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// NewProblemFromError maps err to a problem. Only domain errors expose their
+// message, anything else becomes a generic internal error.
+func NewProblemFromError(err error) *Problem {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Kind == apperror.KindInternal {
+		return NewProblem(http.StatusInternalServerError, apperror.CodeInternal, "internal error")
+	}
+	status, ok := kindStatus[appErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	problem := NewProblem(status, appErr.Code, appErr.Message)
+	problem.Errors = appErr.Fields
+	return problem
+}
+
+func Error(err error) (int, interface{}) {
+	problem := NewProblemFromError(err)
+	return problem.Status, problem
+}
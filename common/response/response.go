@@ -44,75 +44,3 @@ func NewCreatedResponse(data map[string]interface{}) (int, interface{}) {
 	}
 	return http.StatusCreated, result
 }
-
-func NewErrorResponse(code int, msg interface{}) (int, interface{}) {
-	return code, map[string]interface{}{
-		"error":   http.StatusText(code),
-		"code":    code,
-		"content": msg,
-	}
-}
-
-func ServiceUnavailable() (int, interface{}) {
-	return http.StatusServiceUnavailable, map[string]interface{}{
-		"error":   http.StatusText(http.StatusServiceUnavailable),
-		"code":    http.StatusBadRequest,
-		"content": http.StatusText(http.StatusServiceUnavailable),
-	}
-}
-
-func ServiceUnavailableMsg(msg interface{}) (int, interface{}) {
-	return http.StatusServiceUnavailable, map[string]interface{}{
-		"error":   http.StatusText(http.StatusServiceUnavailable),
-		"code":    http.StatusBadRequest,
-		"content": msg,
-	}
-}
-
-func BadRequest() (int, interface{}) {
-	return http.StatusBadRequest, map[string]interface{}{
-		"error":   http.StatusText(http.StatusBadRequest),
-		"code":    http.StatusBadRequest,
-		"content": http.StatusText(http.StatusBadRequest),
-	}
-}
-
-func BadRequestMsg(msg interface{}) (int, interface{}) {
-	return http.StatusBadRequest, map[string]interface{}{
-		"error":   http.StatusText(http.StatusBadRequest),
-		"code":    http.StatusBadRequest,
-		"content": msg,
-	}
-}
-
-func NotFound() (int, interface{}) {
-	return http.StatusNotFound, map[string]interface{}{
-		"error":   http.StatusText(http.StatusNotFound),
-		"code":    http.StatusNotFound,
-		"content": http.StatusText(http.StatusNotFound),
-	}
-}
-
-func NotFoundMsg(msg interface{}) (int, interface{}) {
-	return http.StatusNotFound, map[string]interface{}{
-		"error":   http.StatusText(http.StatusNotFound),
-		"code":    http.StatusNotFound,
-		"content": msg,
-	}
-}
-
-func Forbidden() (int, interface{}) {
-	return http.StatusForbidden, map[string]interface{}{
-		"error":   "Do not have permission for the request.",
-		"code":    http.StatusForbidden,
-		"content": http.StatusText(http.StatusForbidden),
-	}
-}
-
-func Unauthorized() (int, interface{}) {
-	return http.StatusUnauthorized, map[string]interface{}{
-		"error":   http.StatusText(http.StatusUnauthorized),
-		"code":    http.StatusUnauthorized,
-		"content": http.StatusText(http.StatusUnauthorized),
-	}
-}
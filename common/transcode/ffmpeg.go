@@ -0,0 +1,68 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FFmpeg transcodes with an external ffmpeg binary, reading the source from
+// stdin and writing the rendition to stdout
+type FFmpeg struct {
+	Path string
+}
+
+func (f FFmpeg) Transcode(ctx context.Context, source Source, target Rendition, dst io.Writer) error {
+	return f.run(ctx, source, nil, target, dst)
+}
+
+// Clip seeks after decoding, which is slower than before but exact
+func (f FFmpeg) Clip(ctx context.Context, source Source, clip Clip, target Rendition, dst io.Writer) error {
+	args := []string{"-ss", formatSeconds(clip.Start), "-t", formatSeconds(clip.Length)}
+	if clip.Fade > 0 {
+		// the filter runs after the seek, its times count from the start of the clip
+		args = append(args, "-af", fmt.Sprintf("afade=t=in:st=0:d=%s,afade=t=out:st=%s:d=%s",
+			formatSeconds(clip.Fade), formatSeconds(clip.Length-clip.Fade), formatSeconds(clip.Fade)))
+	}
+	return f.run(ctx, source, args, target, dst)
+}
+
+// run pipes source through ffmpeg, with the output options before the encoder ones
+func (f FFmpeg) run(ctx context.Context, source Source, options []string, target Rendition, dst io.Writer) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-f", string(source.Format), "-i", "pipe:0", "-vn", "-map_metadata", "-1"}
+	args = append(args, options...)
+	switch target.Format {
+	case MP3:
+		args = append(args, "-c:a", "libmp3lame", "-b:a", fmt.Sprintf("%dk", target.Bitrate), "-f", "mp3")
+	case Opus:
+		args = append(args, "-c:a", "libopus", "-b:a", fmt.Sprintf("%dk", target.Bitrate), "-f", "ogg")
+	case WAV:
+		args = append(args, "-c:a", "pcm_s16le", "-f", "wav")
+	default:
+		return ErrUnsupported
+	}
+	args = append(args, "pipe:1")
+
+	r, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Path, args...)
+	cmd.Stdin = r
+	cmd.Stdout = dst
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(max(seconds, 0), 'f', 3, 64)
+}
@@ -0,0 +1,109 @@
+package transcode
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sample/common/audio"
+
+	"github.com/tcolgate/mp3"
+)
+
+// Native transcodes in pure Go: decodable audio to wav, and mp3 to mp3 by
+// copying the frames when the source bitrate does not exceed the target one.
+// It must not write to dst before it knows it supports the rendition.
+type Native struct{}
+
+func (Native) Transcode(ctx context.Context, source Source, target Rendition, dst io.Writer) error {
+	switch {
+	case target.Format == WAV && audio.Decodable(source.Format):
+		r, err := source.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		decoder, err := audio.NewDecoder(bufio.NewReader(r), source.Format)
+		if err != nil {
+			return err
+		}
+		return audio.WriteWAV(dst, &contextDecoder{ctx: ctx, Decoder: decoder})
+	case target.Format == MP3 && source.Format == audio.FormatMP3:
+		bitrate, err := mp3Bitrate(source)
+		if err != nil {
+			return err
+		} else if bitrate > target.Bitrate {
+			return ErrUnsupported
+		}
+		r, err := source.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return audio.ForEachMP3Frame(r, func(frame *mp3.Frame) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, frame.Reader())
+			return err
+		})
+	}
+	return ErrUnsupported
+}
+
+// NativeRendition reports whether Native makes the rendition without ffmpeg: wav of
+// decodable audio and mp3 of mp3 audio at the highest bitrate, which no mp3 exceeds
+func NativeRendition(target Rendition) bool {
+	return target.Format == WAV || (target.Format == MP3 && target.Bitrate == Bitrates[len(Bitrates)-1])
+}
+
+// Clip decodes the clip of decodable audio to wav
+func (Native) Clip(ctx context.Context, source Source, clip Clip, target Rendition, dst io.Writer) error {
+	if target.Format != WAV || !audio.Decodable(source.Format) {
+		return ErrUnsupported
+	}
+	r, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	decoder, err := audio.NewDecoder(bufio.NewReader(r), source.Format)
+	if err != nil {
+		return err
+	}
+	excerpt := audio.Excerpt(decoder, clip.Start, clip.Length, clip.Fade)
+	return audio.WriteWAV(dst, &contextDecoder{ctx: ctx, Decoder: excerpt})
+}
+
+// mp3Bitrate returns the average bitrate of the frames of source in kbit/s
+func mp3Bitrate(source Source) (int, error) {
+	r, err := source.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	bits, seconds := 0.0, 0.0
+	err = audio.ForEachMP3Frame(r, func(frame *mp3.Frame) error {
+		bits += float64(frame.Size() * 8)
+		seconds += frame.Duration().Seconds()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	} else if seconds == 0 {
+		return 0, nil
+	}
+	return int(bits/seconds/1000 + 0.5), nil
+}
+
+// contextDecoder stops decoding once ctx is done
+type contextDecoder struct {
+	audio.Decoder
+	ctx context.Context
+}
+
+func (d *contextDecoder) Read(samples []float32) (int, error) {
+	if err := d.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return d.Decoder.Read(samples)
+}
@@ -0,0 +1,150 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sample/common/audio"
+	"strconv"
+	"strings"
+)
+
+// rendition formats
+const (
+	MP3  = "mp3"
+	WAV  = "wav"
+	Opus = "opus"
+)
+
+// Bitrates are the bitrates in kbit/s renditions can have, wav is lossless and has none
+var Bitrates = []int{64, 128, 320}
+
+// ErrUnsupported is returned when no transcoder can produce a rendition
+var ErrUnsupported = errors.New("rendition is not supported by the transcoder")
+
+// Rendition is a format and bitrate a track can be streamed in
+type Rendition struct {
+	Format  string
+	Bitrate int // kbit/s, 0 for wav
+}
+
+// ParseRendition validates the format and bitrate of a rendition, the bitrate of wav is ignored
+func ParseRendition(format string, bitrate int) (Rendition, error) {
+	switch format {
+	case WAV:
+		return Rendition{Format: WAV}, nil
+	case MP3, Opus:
+		for _, allowed := range Bitrates {
+			if bitrate == allowed {
+				return Rendition{Format: format, Bitrate: bitrate}, nil
+			}
+		}
+		return Rendition{}, fmt.Errorf("bitrate must be one of %v", Bitrates)
+	}
+	return Rendition{}, fmt.Errorf("unknown format %q", format)
+}
+
+// ParseRenditions parses renditions written like "mp3:128" or "wav", as in the configuration
+func ParseRenditions(values []string) ([]Rendition, error) {
+	renditions := make([]Rendition, 0, len(values))
+	for _, value := range values {
+		format, bitrate, _ := strings.Cut(value, ":")
+		rate, _ := strconv.Atoi(bitrate)
+		rendition, err := ParseRendition(format, rate)
+		if err != nil {
+			return nil, fmt.Errorf("rendition %q: %w", value, err)
+		}
+		renditions = append(renditions, rendition)
+	}
+	return renditions, nil
+}
+
+// ParseRenditionName parses a rendition named as by String, like "mp3_128" or "wav"
+func ParseRenditionName(name string) (Rendition, error) {
+	format, bitrate, _ := strings.Cut(name, "_")
+	rate, _ := strconv.Atoi(bitrate)
+	rendition, err := ParseRendition(format, rate)
+	if err != nil {
+		return Rendition{}, err
+	} else if rendition.String() != name {
+		return Rendition{}, fmt.Errorf("unknown rendition %q", name)
+	}
+	return rendition, nil
+}
+
+func (r Rendition) String() string {
+	if r.Format == WAV {
+		return WAV
+	}
+	return fmt.Sprintf("%s_%d", r.Format, r.Bitrate)
+}
+
+// ContentType is the media type of the rendition
+func (r Rendition) ContentType() string {
+	switch r.Format {
+	case MP3:
+		return "audio/mpeg"
+	case Opus:
+		return "audio/ogg; codecs=opus"
+	default:
+		return "audio/wav"
+	}
+}
+
+// Extension is the file extension of the rendition, opus is stored in ogg
+func (r Rendition) Extension() string {
+	return r.Format
+}
+
+// Source is the audio to transcode, Open may be called more than once
+type Source struct {
+	Format audio.Format
+	Open   func() (io.ReadCloser, error)
+}
+
+// Transcoder converts audio to renditions
+type Transcoder interface {
+	// Transcode writes source as target to dst, ErrUnsupported when it can not
+	Transcode(ctx context.Context, source Source, target Rendition, dst io.Writer) error
+}
+
+// Clip is an excerpt of a source, in seconds, which fades in and out over Fade
+type Clip struct {
+	Start  float64
+	Length float64
+	Fade   float64
+}
+
+// Clipper is a transcoder which can also encode excerpts
+type Clipper interface {
+	// Clip writes the clip of source as target to dst, ErrUnsupported when it can not
+	Clip(ctx context.Context, source Source, clip Clip, target Rendition, dst io.Writer) error
+}
+
+// Chain tries each transcoder in turn until one supports the rendition
+type Chain []Transcoder
+
+func (c Chain) Transcode(ctx context.Context, source Source, target Rendition, dst io.Writer) error {
+	for _, transcoder := range c {
+		err := transcoder.Transcode(ctx, source, target, dst)
+		if !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+	return ErrUnsupported
+}
+
+func (c Chain) Clip(ctx context.Context, source Source, clip Clip, target Rendition, dst io.Writer) error {
+	for _, transcoder := range c {
+		clipper, ok := transcoder.(Clipper)
+		if !ok {
+			continue
+		}
+		err := clipper.Clip(ctx, source, clip, target, dst)
+		if !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+	return ErrUnsupported
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		"Bohemian Rhapsody":        "bohemian rhapsody",
+		"  Don't  Stop   Me Now! ": "don t stop me now",
+		"AC/DC":                    "ac dc",
+		"Sigur Rós – Hoppípolla":   "sigur rós hoppípolla",
+		"99 Luftballons":           "99 luftballons",
+		"--- ...":                  "",
+	}
+	for input, want := range tests {
+		if got := NormalizeText(input); got != want {
+			t.Errorf("NormalizeText(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "", b: "", want: 1},
+		{a: "abc", b: "", want: 0},
+		{a: "yesterday", b: "yesterday", want: 1},
+		{a: "kitten", b: "sitting", want: 1 - 3.0/7},
+		{a: "bohemian rhapsody", b: "bohemian rapsody", want: 1 - 1.0/17},
+		{a: "rós", b: "ros", want: 1 - 1.0/3},
+		{a: "abc", b: "xyz", want: 0},
+	}
+	for _, tt := range tests {
+		got := Similarity(tt.a, tt.b)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if reverse := Similarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want it symmetric to %v", tt.b, tt.a, reverse, got)
+		}
+	}
+}
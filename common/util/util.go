@@ -73,3 +73,12 @@ func ParseAnyToAny(value any, dest any) error {
 func GetAudioDir() string {
 	return "upload_file/audio"
 }
+
+func GetCoverDir() string {
+	return "upload_file/covers"
+}
+
+// GetUploadDir holds uploads while they are received, on the file system of the audio dir
+func GetUploadDir() string {
+	return "upload_file/uploads"
+}
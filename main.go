@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sample/api"
 	"sample/common/cache"
+	applog "sample/common/log"
+	"sample/common/model"
+	"sample/common/transcode"
 	"sample/docs"
 	"sample/internal/mongodb"
 	"sample/internal/redis"
 	"sample/repository"
 	"sample/repository/db"
 	"sample/service"
+	"syscall"
+	"time"
 
 	"github.com/caarlos0/env"
 	log "github.com/sirupsen/logrus"
@@ -26,6 +33,27 @@ type Config struct {
 	LogFile  string
 	LogLevel string
 	Mongodb  string
+
+	LogMaxSize        int
+	LogRotateInterval time.Duration
+	LogMaxBackups     int
+	LogMaxAge         int
+	LogCompress       bool
+
+	PlayFlushInterval time.Duration
+	DuplicateUploads  string
+	TagWriting        string
+	DetectKey         bool
+	SilenceThreshold  float64
+	TrimSilence       bool
+	MaxUploadMB       int
+
+	RenditionDir     string
+	RenditionCacheMB int
+	Renditions       []string
+	FFmpegPath       string
+	HLSSegment       time.Duration
+	PreviewStart     float64
 }
 
 var config Config
@@ -40,6 +68,8 @@ func init() {
 		log.Println(err.Error())
 		panic(err)
 	}
+	viper.SetDefault(`main.preview_start`, 0.3)
+	viper.SetDefault(`main.silence_threshold_db`, -60)
 	cfg := Config{
 		Port:     viper.GetString(`main.port`),
 		Redis:    viper.GetString(`main.redis`),
@@ -47,6 +77,27 @@ func init() {
 		LogType:  viper.GetString(`main.log_type`),
 		LogLevel: viper.GetString(`main.log_level`),
 		Mongodb:  viper.GetString(`main.mongodb`),
+
+		LogMaxSize:        viper.GetInt(`main.log_max_size_mb`),
+		LogRotateInterval: viper.GetDuration(`main.log_rotate_interval`),
+		LogMaxBackups:     viper.GetInt(`main.log_max_backups`),
+		LogMaxAge:         viper.GetInt(`main.log_max_age_days`),
+		LogCompress:       viper.GetBool(`main.log_compress`),
+
+		PlayFlushInterval: viper.GetDuration(`main.play_flush_interval`),
+		DuplicateUploads:  viper.GetString(`main.duplicate_uploads`),
+		TagWriting:        viper.GetString(`main.tag_writing`),
+		DetectKey:         viper.GetBool(`main.detect_key`),
+		SilenceThreshold:  viper.GetFloat64(`main.silence_threshold_db`),
+		TrimSilence:       viper.GetBool(`main.trim_silence`),
+		MaxUploadMB:       viper.GetInt(`main.max_upload_mb`),
+
+		RenditionDir:     viper.GetString(`main.rendition_dir`),
+		RenditionCacheMB: viper.GetInt(`main.rendition_cache_mb`),
+		Renditions:       viper.GetStringSlice(`main.renditions`),
+		FFmpegPath:       viper.GetString(`main.ffmpeg_path`),
+		HLSSegment:       viper.GetDuration(`main.hls_segment_duration`),
+		PreviewStart:     viper.GetFloat64(`main.preview_start`),
 	}
 	if cfg.Redis == "enabled" {
 		var err error
@@ -75,9 +126,25 @@ func init() {
 // @host localhost:8000
 // @BasePath /v1
 func main() {
-	_ = os.Mkdir(filepath.Dir(config.LogFile), 0755)
-	file, _ := os.OpenFile(config.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	defer file.Close()
+	var file io.Writer
+	if config.LogType == "FILE" {
+		logFile, err := applog.NewRotatingFile(applog.RotateConfig{
+			Filename:   config.LogFile,
+			MaxSize:    int64(config.LogMaxSize) * 1024 * 1024,
+			Interval:   config.LogRotateInterval,
+			MaxBackups: config.LogMaxBackups,
+			MaxAge:     time.Duration(config.LogMaxAge) * 24 * time.Hour,
+			Compress:   config.LogCompress,
+		})
+		if err != nil {
+			log.Error(err)
+		} else {
+			// reopen on SIGHUP so an external logrotate can move the file away
+			logFile.ReopenOnSignal(syscall.SIGHUP)
+			defer logFile.Close()
+			file = logFile
+		}
+	}
 	setAppLogger(config, file)
 
 	cache.MCache = cache.NewMemCache()
@@ -96,24 +163,111 @@ func main() {
 
 		repository.TrackRepo = db.NewTrack(client)
 		repository.PlaylistRepo = db.NewPlaylist(client)
+		repository.PlayRepo = db.NewPlays(client)
+		repository.LikeRepo = db.NewLikes(client)
 
 		defer mongodb.CloseDB()
 	}
 
+	// SIGINT and SIGTERM stop the server and the background workers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	server := api.NewServer()
-	musicTrackService := service.NewTrack()
+	musicTrackService := service.NewTrack(service.TrackConfig{
+		DuplicateUploads: model.DuplicatePolicy(config.DuplicateUploads),
+		TagWriting:       model.TagWriting(config.TagWriting),
+		TrimSilence:      config.TrimSilence,
+		SilenceThreshold: config.SilenceThreshold,
+		MaxUploadBytes:   int64(config.MaxUploadMB) * 1024 * 1024,
+	})
 	api.APIMusicTrackHandler(server.Engine, musicTrackService)
 
 	playlistService := service.NewPlaylist()
 	api.APIPlaylistHandler(server.Engine, playlistService)
 
+	playService := service.NewPlay()
+	api.APIPlayHandler(server.Engine, playService)
+	api.APIChartHandler(server.Engine, service.NewChart())
+	api.APILikeHandler(server.Engine, service.NewLike())
+	api.APIRecommendationHandler(server.Engine, service.NewRecommendation())
+
+	streamService, err := service.NewStream(streamConfig(config))
+	if err != nil {
+		panic(err)
+	}
+	api.APIStreamHandler(server.Engine, streamService)
+	if config.Mongodb == "enabled" {
+		// links store the same audio more than once, rejects rely on a unique index
+		if err := service.PrepareDuplicateUploads(ctx, model.DuplicatePolicy(config.DuplicateUploads)); err != nil {
+			log.Errorf("set up the content hash index failed, duplicates are checked before writes only: %v", err)
+		}
+		go service.RunAudioAnalyzer(ctx, service.AnalysisConfig{
+			DetectKey:        config.DetectKey,
+			SilenceThreshold: config.SilenceThreshold,
+		})
+		go service.RunRenditionWorker(ctx, streamService)
+	}
+	if config.Redis == "enabled" {
+		// play counts are collected in redis and written to the database in batches
+		flushInterval := config.PlayFlushInterval
+		if flushInterval <= 0 {
+			flushInterval = time.Minute
+		}
+		flushed := make(chan struct{})
+		go func() {
+			service.RunPlayCountFlusher(ctx, playService, flushInterval)
+			close(flushed)
+		}()
+		// wait for the final flush before redis and the database are closed
+		defer func() {
+			stop()
+			<-flushed
+		}()
+	}
+
 	docs.SwaggerInfo.BasePath = "/v1"
 	api.APISwaggerHandler(server.Engine)
 
-	server.Start(config.Port)
+	server.Start(ctx, config.Port)
 }
 
-func setAppLogger(cfg Config, file *os.File) {
+// streamConfig sets up the transcoders, pure Go first and ffmpeg when a path is configured
+func streamConfig(cfg Config) service.StreamConfig {
+	renditions, err := transcode.ParseRenditions(cfg.Renditions)
+	if err != nil {
+		panic(err)
+	}
+	transcoders := transcode.Chain{transcode.Native{}}
+	if len(cfg.FFmpegPath) > 0 {
+		transcoders = append(transcoders, transcode.FFmpeg{Path: cfg.FFmpegPath})
+	} else {
+		// renditions made ahead of time would be missing for most tracks
+		for _, rendition := range renditions {
+			if !transcode.NativeRendition(rendition) {
+				panic(fmt.Errorf("rendition %s needs ffmpeg_path", rendition))
+			}
+		}
+	}
+	dir := cfg.RenditionDir
+	if len(dir) == 0 {
+		dir = "upload_file/renditions"
+	}
+	cacheMB := cfg.RenditionCacheMB
+	if cacheMB <= 0 {
+		cacheMB = 2048
+	}
+	return service.StreamConfig{
+		Dir:             dir,
+		CacheBytes:      int64(cacheMB) * 1024 * 1024,
+		Transcoder:      transcoders,
+		Renditions:      renditions,
+		SegmentDuration: cfg.HLSSegment,
+		PreviewStart:    cfg.PreviewStart,
+	}
+}
+
+func setAppLogger(cfg Config, file io.Writer) {
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp:   true,
 		TimestampFormat: "2006-01-02T15:04:05.999Z",
@@ -140,7 +294,14 @@ func setAppLogger(cfg Config, file *os.File) {
 		} else {
 			log.SetOutput(os.Stdout)
 		}
+	case "JSON":
+		log.SetFormatter(&log.JSONFormatter{
+			TimestampFormat: "2006-01-02T15:04:05.999Z",
+		})
+		log.SetOutput(os.Stdout)
 	default:
 		log.SetOutput(os.Stdout)
 	}
+	// access log lines are always JSON and go wherever the app log goes
+	applog.SetAccessOutput(log.StandardLogger().Out)
 }
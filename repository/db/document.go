@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"sample/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// setFields returns the fields of doc for a $set, without the counters
+// which are only ever changed by $inc
+func setFields(doc any, counters ...string) (bson.M, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, counter := range counters {
+		delete(fields, counter)
+	}
+	return fields, nil
+}
+
+// incrCounter adds delta to a counter of the document without changing its version
+func incrCounter(ctx context.Context, collection *mongo.Collection, uuid string, counter string, delta int64) error {
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": uuid}, bson.M{"$inc": bson.M{counter: delta}})
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"sample/common/model"
+	"sample/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var likeCollection *mongo.Collection
+
+type Likes struct {
+}
+
+func NewLikes(client *mongo.Client) repository.ILikes {
+	likeCollection = client.Database("music").Collection("likes")
+	return &Likes{}
+}
+
+// likeID is the same for every like of a user on a target, so the unique _id
+// makes a second like of any replica fail instead of counting twice
+func likeID(userId string, kind string, targetId string) string {
+	return userId + ":" + kind + ":" + targetId
+}
+
+func (repo *Likes) Like(ctx context.Context, like model.Like) (bool, error) {
+	like.ID = likeID(like.UserID, like.Kind, like.TargetID)
+	_, err := likeCollection.InsertOne(ctx, like)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (repo *Likes) Unlike(ctx context.Context, userId string, kind string, targetId string) (bool, error) {
+	result, err := likeCollection.DeleteOne(ctx, bson.M{"_id": likeID(userId, kind, targetId)})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (repo *Likes) GetLikes(ctx context.Context, userId string, kind string) (*[]model.Like, error) {
+	likes := new([]model.Like)
+	query := bson.M{"user_id": userId, "kind": kind}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := likeCollection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, likes)
+	if err != nil {
+		return nil, err
+	}
+	return likes, nil
+}
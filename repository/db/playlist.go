@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"sample/common/model"
 	"sample/repository"
 
@@ -50,7 +51,9 @@ func (repo *Playlist) GetPlaylists(ctx context.Context, filter model.PlaylistFil
 
 func (repo *Playlist) PostPlaylist(ctx context.Context, playlist model.Playlist) error {
 	_, err := playlistCollection.InsertOne(ctx, playlist)
-	if err != nil {
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrConflict
+	} else if err != nil {
 		return err
 	}
 	return nil
@@ -59,24 +62,73 @@ func (repo *Playlist) PostPlaylist(ctx context.Context, playlist model.Playlist)
 func (repo *Playlist) GetPlaylistById(ctx context.Context, playlistUuid string) (*model.Playlist, error) {
 	playlist := new(model.Playlist)
 	err := playlistCollection.FindOne(ctx, bson.M{"_id": playlistUuid}).Decode(playlist)
-	if err != nil {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repository.ErrNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	return playlist, nil
 }
 
-func (repo *Playlist) DeletePlaylistById(ctx context.Context, playlistUuid string) error {
-	_, err := playlistCollection.DeleteOne(ctx, bson.M{"_id": playlistUuid})
+func (repo *Playlist) GetPlaylistsByIds(ctx context.Context, playlistUuids []string) (*[]model.Playlist, error) {
+	playlists := new([]model.Playlist)
+	if len(playlistUuids) == 0 {
+		return playlists, nil
+	}
+	cursor, err := playlistCollection.Find(ctx, bson.M{"_id": bson.M{"$in": playlistUuids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, playlists)
+	if err != nil {
+		return nil, err
+	}
+	return playlists, nil
+}
+
+func (repo *Playlist) DeletePlaylistById(ctx context.Context, playlistUuid string, version int64) error {
+	result, err := playlistCollection.DeleteOne(ctx, versionFilter(playlistUuid, version))
+	if err != nil {
+		return err
+	} else if result.DeletedCount == 0 {
+		return versionMismatch(ctx, playlistCollection, playlistUuid)
+	}
+	return nil
+}
+
+func (repo *Playlist) PutPlaylistById(ctx context.Context, playlistUuid string, version int64, playlistUpdate model.Playlist) error {
+	playlistUpdate.Version = version + 1
+	fields, err := setFields(playlistUpdate, "likes")
 	if err != nil {
 		return err
 	}
+	update := bson.M{"$set": fields}
+	if playlistUpdate.Smart == nil {
+		update["$unset"] = bson.M{"smart": ""}
+	}
+	result, err := playlistCollection.UpdateOne(ctx, versionFilter(playlistUuid, version), update)
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return versionMismatch(ctx, playlistCollection, playlistUuid)
+	}
 	return nil
 }
 
-func (repo *Playlist) PutPlaylistById(ctx context.Context, playlistUuid string, playlistUpdate model.Playlist) error {
-	_, err := playlistCollection.UpdateOne(ctx, bson.M{"_id": playlistUuid}, bson.M{"$set": playlistUpdate})
+// PatchPlaylistById sets only the given fields, keyed by their bson names
+func (repo *Playlist) PatchPlaylistById(ctx context.Context, playlistUuid string, version int64, fields map[string]any) error {
+	update := bson.M{"$set": fields, "$inc": bson.M{"version": 1}}
+	result, err := playlistCollection.UpdateOne(ctx, versionFilter(playlistUuid, version), update)
 	if err != nil {
 		return err
+	} else if result.MatchedCount == 0 {
+		return versionMismatch(ctx, playlistCollection, playlistUuid)
 	}
 	return nil
 }
+
+func (repo *Playlist) IncrLikes(ctx context.Context, playlistUuid string, delta int64) error {
+	return incrCounter(ctx, playlistCollection, playlistUuid, "likes", delta)
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sample/common/model"
+	"sample/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// incVersion is the pipeline form of {$inc: {version: 1}}
+var incVersion = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}}
+
+func (repo *Playlist) InsertPlaylistTracks(ctx context.Context, playlistUuid string, version int64, trackIds []model.TrackIds, position *int) (*model.Playlist, error) {
+	filter := versionFilter(playlistUuid, version)
+	push := bson.M{"$each": trackIds}
+	if position != nil {
+		push["$position"] = *position
+		// $position past the end appends, so the entry before it has to exist
+		if *position > 0 {
+			filter[fmt.Sprintf("track_ids.%d", *position-1)] = bson.M{"$exists": true}
+		}
+	}
+	update := bson.M{
+		"$push": bson.M{"track_ids": push},
+		"$inc":  bson.M{"version": 1},
+	}
+	return updatePlaylistItems(ctx, playlistUuid, version, filter, update)
+}
+
+func (repo *Playlist) RemovePlaylistTrack(ctx context.Context, playlistUuid string, version int64, trackId string) (*model.Playlist, error) {
+	filter := versionFilter(playlistUuid, version)
+	filter["track_ids.track_id"] = trackId
+	update := bson.M{
+		"$pull": bson.M{"track_ids": bson.M{"track_id": trackId}},
+		"$inc":  bson.M{"version": 1},
+	}
+	return updatePlaylistItems(ctx, playlistUuid, version, filter, update)
+}
+
+func (repo *Playlist) RemovePlaylistTrackAt(ctx context.Context, playlistUuid string, version int64, index int) (*model.Playlist, error) {
+	filter := versionFilter(playlistUuid, version)
+	filter[fmt.Sprintf("track_ids.%d", index)] = bson.M{"$exists": true}
+	return updatePlaylistItems(ctx, playlistUuid, version, filter, reorderPipeline(removeOrder(index)))
+}
+
+func (repo *Playlist) MovePlaylistTracks(ctx context.Context, playlistUuid string, version int64, from, count, to int) (*model.Playlist, error) {
+	filter := versionFilter(playlistUuid, version)
+	// both the moved range and its target range have to be inside the playlist
+	last := from + count - 1
+	if to+count-1 > last {
+		last = to + count - 1
+	}
+	filter[fmt.Sprintf("track_ids.%d", last)] = bson.M{"$exists": true}
+	return updatePlaylistItems(ctx, playlistUuid, version, filter, reorderPipeline(moveOrder(from, count, to)))
+}
+
+func (repo *Playlist) SetPlaylistTrackPriority(ctx context.Context, playlistUuid string, version int64, index int, priority int) (*model.Playlist, error) {
+	filter := versionFilter(playlistUuid, version)
+	filter[fmt.Sprintf("track_ids.%d", index)] = bson.M{"$exists": true}
+	update := bson.M{
+		"$set": bson.M{fmt.Sprintf("track_ids.%d.priority", index): priority},
+		"$inc": bson.M{"version": 1},
+	}
+	return updatePlaylistItems(ctx, playlistUuid, version, filter, update)
+}
+
+// removeOrder keeps every entry but the one at index, as indexes into the current track_ids
+func removeOrder(index int) bson.M {
+	return bson.M{"$filter": bson.M{
+		"input": bson.M{"$range": bson.A{0, bson.M{"$size": "$track_ids"}}},
+		"as":    "i",
+		"cond":  bson.M{"$ne": bson.A{"$$i", index}},
+	}}
+}
+
+// moveOrder is the order of the entries once count of them are moved from from to
+// to, as indexes into the current track_ids
+func moveOrder(from, count, to int) bson.M {
+	// the entries outside the range keep their order, rest is their index once the range is taken out
+	outside := bson.M{"$or": bson.A{bson.M{"$lt": bson.A{"$$i", from}}, bson.M{"$gte": bson.A{"$$i", from + count}}}}
+	rest := bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$$i", from}}, "$$i", bson.M{"$subtract": bson.A{"$$i", count}}}}
+	entries := func(cond bson.M) bson.M {
+		return bson.M{"$filter": bson.M{
+			"input": bson.M{"$range": bson.A{0, bson.M{"$size": "$track_ids"}}},
+			"as":    "i",
+			"cond":  bson.M{"$and": bson.A{outside, cond}},
+		}}
+	}
+	return bson.M{"$concatArrays": bson.A{
+		entries(bson.M{"$lt": bson.A{rest, to}}),
+		bson.M{"$range": bson.A{from, from + count}},
+		entries(bson.M{"$gte": bson.A{rest, to}}),
+	}}
+}
+
+// reorderPipeline rebuilds track_ids from order, a list of indexes into the current track_ids
+func reorderPipeline(order bson.M) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"track_ids": bson.M{"$map": bson.M{
+				"input": order,
+				"as":    "i",
+				"in":    bson.M{"$arrayElemAt": bson.A{"$track_ids", "$$i"}},
+			}},
+			"version": incVersion,
+		}}},
+	}
+}
+
+// updatePlaylistItems applies update in one atomic operation and returns the new
+// playlist, smart playlists are left alone as their entries are computed
+func updatePlaylistItems(ctx context.Context, playlistUuid string, version int64, filter bson.M, update any) (*model.Playlist, error) {
+	// playlists created without tracks store null, which $push and $pull refuse
+	if _, err := playlistCollection.UpdateOne(ctx, bson.M{"_id": playlistUuid, "track_ids": nil, "smart": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"track_ids": bson.A{}}}); err != nil {
+		return nil, err
+	}
+
+	filter["smart"] = bson.M{"$exists": false}
+	playlist := new(model.Playlist)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := playlistCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(playlist)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, itemMismatch(ctx, playlistUuid, version)
+	} else if err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// itemMismatch explains why an item operation matched nothing
+func itemMismatch(ctx context.Context, playlistUuid string, version int64) error {
+	var stored struct {
+		Version int64 `bson:"version"`
+		Smart   any   `bson:"smart"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"version": 1, "smart": 1})
+	err := playlistCollection.FindOne(ctx, bson.M{"_id": playlistUuid}, opts).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return repository.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case stored.Smart != nil:
+		return repository.ErrItemsReadOnly
+	case stored.Version != version:
+		return repository.ErrVersionConflict
+	}
+	return repository.ErrItemNotFound
+}
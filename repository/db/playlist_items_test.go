@@ -0,0 +1,230 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// evalExpr evaluates the aggregation operators of the reorder pipelines against
+// a document, so they can be checked without a database
+func evalExpr(t *testing.T, expr any, doc bson.M, vars map[string]any) any {
+	t.Helper()
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$$") {
+			return vars[e[2:]]
+		} else if strings.HasPrefix(e, "$") {
+			return doc[e[1:]]
+		}
+		return e
+	case int:
+		return e
+	case int64:
+		return int(e)
+	case bson.A:
+		values := make([]any, len(e))
+		for i := range e {
+			values[i] = evalExpr(t, e[i], doc, vars)
+		}
+		return values
+	case bson.M:
+		if len(e) != 1 {
+			t.Fatalf("expression %v has more than one operator", e)
+		}
+		for op, arg := range e {
+			return evalOperator(t, op, arg, doc, vars)
+		}
+	}
+	t.Fatalf("unknown expression %#v", expr)
+	return nil
+}
+
+func evalOperator(t *testing.T, op string, arg any, doc bson.M, vars map[string]any) any {
+	t.Helper()
+	eval := func(expr any) any { return evalExpr(t, expr, doc, vars) }
+	with := func(name string, value any) map[string]any {
+		scope := map[string]any{name: value}
+		for k, v := range vars {
+			if k != name {
+				scope[k] = v
+			}
+		}
+		return scope
+	}
+	args := func() []any { return eval(arg).([]any) }
+	switch op {
+	case "$filter", "$map":
+		spec := arg.(bson.M)
+		name := spec["as"].(string)
+		out := []any{}
+		for _, item := range evalExpr(t, spec["input"], doc, vars).([]any) {
+			if op == "$map" {
+				out = append(out, evalExpr(t, spec["in"], doc, with(name, item)))
+			} else if evalExpr(t, spec["cond"], doc, with(name, item)).(bool) {
+				out = append(out, item)
+			}
+		}
+		return out
+	case "$range":
+		a := args()
+		out := []any{}
+		for i := a[0].(int); i < a[1].(int); i++ {
+			out = append(out, i)
+		}
+		return out
+	case "$size":
+		return len(eval(arg).([]any))
+	case "$concatArrays":
+		out := []any{}
+		for _, part := range args() {
+			out = append(out, part.([]any)...)
+		}
+		return out
+	case "$arrayElemAt":
+		a := args()
+		return a[0].([]any)[a[1].(int)]
+	case "$cond":
+		a := arg.(bson.A)
+		if eval(a[0]).(bool) {
+			return eval(a[1])
+		}
+		return eval(a[2])
+	case "$and", "$or":
+		for _, value := range args() {
+			if value.(bool) == (op == "$or") {
+				return op == "$or"
+			}
+		}
+		return op == "$and"
+	case "$ne":
+		a := args()
+		return a[0] != a[1]
+	case "$lt":
+		a := args()
+		return a[0].(int) < a[1].(int)
+	case "$gte":
+		a := args()
+		return a[0].(int) >= a[1].(int)
+	case "$subtract":
+		a := args()
+		return a[0].(int) - a[1].(int)
+	case "$add":
+		a := args()
+		return a[0].(int) + a[1].(int)
+	case "$ifNull":
+		a := args()
+		if a[0] == nil {
+			return a[1]
+		}
+		return a[0]
+	}
+	t.Fatalf("unknown operator %s", op)
+	return nil
+}
+
+// applyReorder runs a reorder pipeline on a playlist document with the given entries
+func applyReorder(t *testing.T, order bson.M, entries []string, version any) ([]string, any) {
+	t.Helper()
+	doc := bson.M{"track_ids": []any{}, "version": version}
+	for _, entry := range entries {
+		doc["track_ids"] = append(doc["track_ids"].([]any), entry)
+	}
+	pipeline := reorderPipeline(order)
+	if len(pipeline) != 1 || pipeline[0][0].Key != "$set" {
+		t.Fatalf("reorderPipeline() = %v, want a single $set stage", pipeline)
+	}
+	set := pipeline[0][0].Value.(bson.M)
+	ordered := evalExpr(t, set["track_ids"], doc, nil).([]any)
+	got := make([]string, len(ordered))
+	for i := range ordered {
+		got[i] = ordered[i].(string)
+	}
+	return got, evalExpr(t, set["version"], doc, nil)
+}
+
+func letters(n int) []string {
+	entries := make([]string, n)
+	for i := range entries {
+		entries[i] = string(rune('a' + i))
+	}
+	return entries
+}
+
+func TestRemoveOrder(t *testing.T) {
+	tests := []struct {
+		entries []string
+		index   int
+		want    []string
+	}{
+		{entries: []string{"a"}, index: 0, want: []string{}},
+		{entries: []string{"a", "b", "c"}, index: 0, want: []string{"b", "c"}},
+		{entries: []string{"a", "b", "c"}, index: 1, want: []string{"a", "c"}},
+		{entries: []string{"a", "b", "c"}, index: 2, want: []string{"a", "b"}},
+		// the same track twice, only the entry at the index goes
+		{entries: []string{"a", "b", "a"}, index: 2, want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v at %d", tt.entries, tt.index), func(t *testing.T) {
+			got, version := applyReorder(t, removeOrder(tt.index), tt.entries, 3)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remove = %v, want %v", got, tt.want)
+			}
+			if version != 4 {
+				t.Errorf("version = %v, want 4", version)
+			}
+		})
+	}
+}
+
+func TestMoveOrder(t *testing.T) {
+	tests := []struct {
+		from, count, to int
+		want            string
+	}{
+		{from: 0, count: 1, to: 0, want: "abcde"},
+		{from: 0, count: 1, to: 4, want: "bcdea"},
+		{from: 4, count: 1, to: 0, want: "eabcd"},
+		{from: 1, count: 2, to: 3, want: "adebc"},
+		{from: 3, count: 2, to: 1, want: "adebc"},
+		{from: 1, count: 3, to: 2, want: "aebcd"},
+		{from: 0, count: 5, to: 0, want: "abcde"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d+%d to %d", tt.from, tt.count, tt.to), func(t *testing.T) {
+			got, _ := applyReorder(t, moveOrder(tt.from, tt.count, tt.to), letters(5), 1)
+			if strings.Join(got, "") != tt.want {
+				t.Errorf("move = %s, want %s", strings.Join(got, ""), tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveOrderAgainstSlices(t *testing.T) {
+	for size := 1; size <= 6; size++ {
+		entries := letters(size)
+		for from := 0; from < size; from++ {
+			for count := 1; from+count <= size; count++ {
+				for to := 0; to+count <= size; to++ {
+					moved := append([]string{}, entries[from:from+count]...)
+					rest := append(append([]string{}, entries[:from]...), entries[from+count:]...)
+					want := append(append(append([]string{}, rest[:to]...), moved...), rest[to:]...)
+
+					got, _ := applyReorder(t, moveOrder(from, count, to), entries, nil)
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("move %d+%d to %d of %v = %v, want %v", from, count, to, entries, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReorderVersionOfUnversionedPlaylist(t *testing.T) {
+	if _, version := applyReorder(t, removeOrder(0), []string{"a"}, nil); version != 1 {
+		t.Errorf("version = %v, want 1", version)
+	}
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sample/common/model"
+	"sample/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	playCollection      *mongo.Collection
+	playCountCollection *mongo.Collection
+)
+
+type Plays struct {
+}
+
+func NewPlays(client *mongo.Client) repository.IPlays {
+	playCollection = client.Database("music").Collection("plays")
+	playCountCollection = client.Database("music").Collection("play_counts")
+	return &Plays{}
+}
+
+type playCount struct {
+	TrackID string `bson:"_id"`
+	Count   int64  `bson:"count"`
+}
+
+func (repo *Plays) PostPlay(ctx context.Context, play model.Play) error {
+	_, err := playCollection.InsertOne(ctx, play)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func (repo *Plays) GetLastCountedPlay(ctx context.Context, userId string, trackId string) (*model.Play, error) {
+	play := new(model.Play)
+	query := bson.M{"user_id": userId, "track_id": trackId, "counted": true}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "played_at", Value: -1}})
+	err := playCollection.FindOne(ctx, query, findOptions).Decode(play)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repository.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return play, nil
+}
+
+func (repo *Plays) GetPlays(ctx context.Context, filter model.PlayFilter) (*[]model.Play, error) {
+	plays := new([]model.Play)
+	query := bson.D{}
+	findOptions := options.Find().SetSort(bson.D{{Key: "played_at", Value: -1}})
+
+	if len(filter.UserID) > 0 {
+		query = append(query, bson.E{Key: "user_id", Value: filter.UserID})
+	}
+	if len(filter.TrackID) > 0 {
+		query = append(query, bson.E{Key: "track_id", Value: filter.TrackID})
+	}
+
+	if filter.Limit > 0 {
+		findOptions.SetLimit(int64(filter.Limit))
+		findOptions.SetSkip(int64(filter.Offset))
+	}
+
+	cursor, err := playCollection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, plays)
+	if err != nil {
+		return nil, err
+	}
+	return plays, nil
+}
+
+func (repo *Plays) IncrPlayCounts(ctx context.Context, counts map[string]int64) (map[string]int64, error) {
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	trackIds := make([]string, 0, len(counts))
+	writes := make([]mongo.WriteModel, 0, len(counts))
+	for trackId, count := range counts {
+		trackIds = append(trackIds, trackId)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": trackId}).
+			SetUpdate(bson.M{"$inc": bson.M{"count": count}}).
+			SetUpsert(true))
+	}
+	_, err := playCountCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		// the writes of an unordered bulk without a write error were applied
+		failed := make(map[string]int64, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			trackId := trackIds[writeErr.Index]
+			failed[trackId] = counts[trackId]
+		}
+		return failed, err
+	} else if err != nil {
+		// the batch is a single command, which failed without a reply
+		return counts, err
+	}
+	return nil, nil
+}
+
+func (repo *Plays) GetPlayCounts(ctx context.Context, trackIds []string) (map[string]int64, error) {
+	counts := map[string]int64{}
+	if len(trackIds) == 0 {
+		return counts, nil
+	}
+	cursor, err := playCountCollection.Find(ctx, bson.M{"_id": bson.M{"$in": trackIds}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	found := []playCount{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	for _, count := range found {
+		counts[count.TrackID] = count.Count
+	}
+	return counts, nil
+}
+
+func (repo *Plays) GetChart(ctx context.Context, chartType string, from time.Time, limit int) ([]model.ChartEntry, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"counted": true, "played_at": bson.M{"$gte": from}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$track_id", "plays": bson.M{"$sum": 1}}}},
+	}
+	if chartType != model.ChartTrack {
+		// artists and genres are read from the tracks, plays of deleted tracks drop out
+		field := "$track." + chartType
+		pipeline = append(pipeline,
+			bson.D{{Key: "$lookup", Value: bson.M{"from": "tracks", "localField": "_id", "foreignField": "_id", "as": "track"}}},
+			bson.D{{Key: "$unwind", Value: "$track"}},
+			bson.D{{Key: "$match", Value: bson.M{field[1:]: bson.M{"$nin": bson.A{"", nil}}}}},
+			bson.D{{Key: "$group", Value: bson.M{"_id": field, "plays": bson.M{"$sum": "$plays"}}}},
+		)
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "plays", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+
+	cursor, err := playCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ranked := []struct {
+		Key   string `bson:"_id"`
+		Plays int64  `bson:"plays"`
+	}{}
+	if err := cursor.All(ctx, &ranked); err != nil {
+		return nil, err
+	}
+	entries := make([]model.ChartEntry, 0, len(ranked))
+	for _, entry := range ranked {
+		entries = append(entries, model.ChartEntry{Key: entry.Key, Plays: entry.Plays})
+	}
+	return entries, nil
+}
+
+func (repo *Plays) GetListeners(ctx context.Context, from time.Time) (map[string][]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"counted": true, "played_at": bson.M{"$gte": from}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$track_id", "users": bson.M{"$addToSet": "$user_id"}}}},
+	}
+	cursor, err := playCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	found := []struct {
+		TrackID string   `bson:"_id"`
+		Users   []string `bson:"users"`
+	}{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	listeners := make(map[string][]string, len(found))
+	for _, track := range found {
+		listeners[track.TrackID] = track.Users
+	}
+	return listeners, nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"regexp"
+	"sample/common/model"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// smartQuery translates the rules of a smart playlist into a track query
+func smartQuery(rules model.SmartRules) bson.M {
+	conditions := bson.A{}
+	for _, rule := range rules.Rules {
+		conditions = append(conditions, smartCondition(rule))
+	}
+	for _, group := range rules.Groups {
+		conditions = append(conditions, smartQuery(group))
+	}
+	if rules.Match == model.MatchAny {
+		return bson.M{"$or": conditions}
+	}
+	return bson.M{"$and": conditions}
+}
+
+func smartCondition(rule model.SmartRule) bson.M {
+	switch rule.Operator {
+	case model.RuleIn:
+		return bson.M{rule.Field: bson.M{"$in": rule.Values}}
+	case model.RuleContains:
+		return bson.M{rule.Field: primitive.Regex{Pattern: regexp.QuoteMeta(rule.Text), Options: "i"}}
+	case model.RuleBetween:
+		return bson.M{rule.Field: bson.M{"$gte": *rule.Min, "$lte": *rule.Max}}
+	case model.RuleLessThan:
+		return bson.M{rule.Field: bson.M{"$lt": *rule.Number}}
+	case model.RuleGreaterThan:
+		return bson.M{rule.Field: bson.M{"$gt": *rule.Number}}
+	case model.RuleAfter:
+		return bson.M{rule.Field: bson.M{"$gt": *rule.Date}}
+	case model.RuleBefore:
+		return bson.M{rule.Field: bson.M{"$lt": *rule.Date}}
+	}
+	// rules are validated before they are stored, an unknown operator matches nothing
+	return bson.M{"_id": bson.M{"$exists": false}}
+}
+
+// smartSort returns the sort of a smart playlist, ties are broken by id so the order is stable
+func smartSort(sort string) bson.D {
+	if len(sort) == 0 {
+		return bson.D{{Key: "_id", Value: 1}}
+	}
+	if field, ok := strings.CutPrefix(sort, "-"); ok {
+		return bson.D{{Key: field, Value: -1}, {Key: "_id", Value: 1}}
+	}
+	return bson.D{{Key: sort, Value: 1}, {Key: "_id", Value: 1}}
+}
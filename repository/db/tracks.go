@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"sample/common/model"
 	"sample/repository"
 
@@ -12,6 +13,20 @@ import (
 
 var trackCollection *mongo.Collection
 
+const (
+	// uniqueContentHashIndex refuses a second track with the same audio while duplicates are rejected
+	uniqueContentHashIndex = "unique_content_hash"
+	// indexNotFound is the server error code of dropping a missing index
+	indexNotFound = 27
+)
+
+// analysisFields are the track fields set by the background analysis
+var analysisFields = []string{"analysis", "loudness", "bpm", "key", "audio_start", "audio_end"}
+
+// withoutAnalysisData leaves the acoustic fingerprints and loudness histograms out of
+// track lists, only the duplicate checks and album gains need them
+var withoutAnalysisData = bson.M{"fingerprint.acoustic": 0, "loudness.histogram": 0}
+
 type Track struct {
 }
 
@@ -23,7 +38,7 @@ func NewTrack(client *mongo.Client) repository.ITracks {
 func (repo *Track) GetTracks(ctx context.Context, filter model.TrackFilter) (*[]model.Track, error) {
 	tracks := new([]model.Track)
 	query := bson.D{}
-	findOptions := options.Find()
+	findOptions := options.Find().SetProjection(withoutAnalysisData)
 
 	if len(filter.Title) > 0 {
 		query = append(query, bson.E{Key: "title", Value: filter.Title})
@@ -37,6 +52,23 @@ func (repo *Track) GetTracks(ctx context.Context, filter model.TrackFilter) (*[]
 	if len(filter.Genre) > 0 {
 		query = append(query, bson.E{Key: "genre", Value: filter.Genre})
 	}
+	if filter.BPMMin > 0 || filter.BPMMax > 0 {
+		bpm := bson.M{}
+		if filter.BPMMin > 0 {
+			bpm["$gte"] = filter.BPMMin
+		}
+		if filter.BPMMax > 0 {
+			bpm["$lte"] = filter.BPMMax
+		}
+		query = append(query, bson.E{Key: "bpm", Value: bpm})
+	}
+	if len(filter.Key) > 0 {
+		query = append(query, bson.E{Key: "key", Value: filter.Key})
+	}
+	if filter.Rules != nil {
+		query = append(query, bson.E{Key: "$and", Value: bson.A{smartQuery(*filter.Rules)}})
+		findOptions.SetSort(smartSort(filter.Sort))
+	}
 
 	if filter.Limit > 0 {
 		findOptions.SetLimit(int64(filter.Limit))
@@ -59,7 +91,9 @@ func (repo *Track) GetTracks(ctx context.Context, filter model.TrackFilter) (*[]
 
 func (repo *Track) PostTrack(ctx context.Context, track model.Track) error {
 	_, err := trackCollection.InsertOne(ctx, track)
-	if err != nil {
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrConflict
+	} else if err != nil {
 		return err
 	}
 	return nil
@@ -68,24 +102,232 @@ func (repo *Track) PostTrack(ctx context.Context, track model.Track) error {
 func (repo *Track) GetTrackById(ctx context.Context, trackUuid string) (*model.Track, error) {
 	track := new(model.Track)
 	err := trackCollection.FindOne(ctx, bson.M{"_id": trackUuid}).Decode(track)
-	if err != nil {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repository.ErrNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	return track, nil
 }
 
-func (repo *Track) DeleteTrackById(ctx context.Context, trackUuid string) error {
-	_, err := trackCollection.DeleteOne(ctx, bson.M{"_id": trackUuid})
+func (repo *Track) GetTracksByIds(ctx context.Context, trackUuids []string) (*[]model.Track, error) {
+	tracks := new([]model.Track)
+	if len(trackUuids) == 0 {
+		return tracks, nil
+	}
+	cursor, err := trackCollection.Find(ctx, bson.M{"_id": bson.M{"$in": trackUuids}}, options.Find().SetProjection(withoutAnalysisData))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, tracks)
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (repo *Track) GetTracksByContentHash(ctx context.Context, contentHash string) (*[]model.Track, error) {
+	tracks := new([]model.Track)
+	cursor, err := trackCollection.Find(ctx, bson.M{"fingerprint.content_hash": contentHash},
+		options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, tracks)
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (repo *Track) GetFingerprintedTracks(ctx context.Context, minDuration, maxDuration float64) (*[]model.Track, error) {
+	tracks := new([]model.Track)
+	duration := bson.M{}
+	if minDuration > 0 {
+		duration["$gte"] = minDuration
+	}
+	if maxDuration > 0 {
+		duration["$lte"] = maxDuration
+	}
+	query := bson.M{"fingerprint": bson.M{"$exists": true}}
+	if len(duration) > 0 {
+		query["duration"] = duration
+	}
+	cursor, err := trackCollection.Find(ctx, query, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, tracks)
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (repo *Track) GetUnanalyzedTrackIds(ctx context.Context, afterId string, limit int) ([]string, error) {
+	query := bson.M{"analysis": bson.M{"$exists": false}, "_id": bson.M{"$gt": afterId}}
+	findOptions := options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"_id": 1}).SetLimit(int64(limit))
+	cursor, err := trackCollection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var found []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(found))
+	for i := range found {
+		ids[i] = found[i].ID
+	}
+	return ids, nil
+}
+
+func (repo *Track) DeleteTrackById(ctx context.Context, trackUuid string, version int64) error {
+	result, err := trackCollection.DeleteOne(ctx, versionFilter(trackUuid, version))
+	if err != nil {
+		return err
+	} else if result.DeletedCount == 0 {
+		return versionMismatch(ctx, trackCollection, trackUuid)
+	}
+	return nil
+}
+
+func (repo *Track) PutTrackById(ctx context.Context, trackUuid string, version int64, trackUpdate model.Track) error {
+	trackUpdate.Version = version + 1
+	fields, err := setFields(trackUpdate, "likes")
 	if err != nil {
 		return err
 	}
+	unset := bson.M{}
+	if len(trackUpdate.AlternateOf) == 0 {
+		unset["alternate_of"] = ""
+	}
+	if trackUpdate.Cover == nil {
+		unset["cover"] = ""
+	}
+	stored := new(model.Track)
+	err = trackCollection.FindOne(ctx, versionFilter(trackUuid, version),
+		options.FindOne().SetProjection(bson.M{"fingerprint.content_hash": 1})).Decode(stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return versionMismatch(ctx, trackCollection, trackUuid)
+	} else if err != nil {
+		return err
+	}
+	// analysis results are written by SetTrackAnalysis, a put keeps them unless the audio was replaced
+	audioReplaced := contentHash(stored) != contentHash(&trackUpdate)
+	for _, field := range analysisFields {
+		delete(fields, field)
+		if audioReplaced {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": fields}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	// the audio must not have been replaced since it was compared
+	filter := versionFilter(trackUuid, version)
+	filter["fingerprint.content_hash"] = bson.M{"$exists": false}
+	if stored.Fingerprint != nil {
+		filter["fingerprint.content_hash"] = stored.Fingerprint.ContentHash
+	}
+	result, err := trackCollection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrConflict
+	} else if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return versionMismatch(ctx, trackCollection, trackUuid)
+	}
 	return nil
 }
 
-func (repo *Track) PutTrackById(ctx context.Context, trackUuid string, trackUpdate model.Track) error {
-	_, err := trackCollection.UpdateOne(ctx, bson.M{"_id": trackUuid}, bson.M{"$set": trackUpdate})
+// PatchTrackById sets only the given fields, keyed by their bson names
+func (repo *Track) PatchTrackById(ctx context.Context, trackUuid string, version int64, fields map[string]any) error {
+	update := bson.M{"$set": fields, "$inc": bson.M{"version": 1}}
+	result, err := trackCollection.UpdateOne(ctx, versionFilter(trackUuid, version), update)
 	if err != nil {
 		return err
+	} else if result.MatchedCount == 0 {
+		return versionMismatch(ctx, trackCollection, trackUuid)
 	}
 	return nil
 }
+
+func (repo *Track) SetTrackAnalysis(ctx context.Context, trackUuid string, contentHash string, fields map[string]any) error {
+	filter := bson.M{"_id": trackUuid, "fingerprint.content_hash": contentHash}
+	if len(contentHash) == 0 {
+		filter = bson.M{"_id": trackUuid, "fingerprint": bson.M{"$exists": false}}
+	}
+	result, err := trackCollection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	} else if result.MatchedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// contentHash is the content hash of the audio of a track, empty for tracks stored without fingerprint
+func contentHash(track *model.Track) string {
+	if track.Fingerprint == nil {
+		return ""
+	}
+	return track.Fingerprint.ContentHash
+}
+
+func (repo *Track) GetAlbumLoudness(ctx context.Context, album string) (*[]model.Track, error) {
+	tracks := new([]model.Track)
+	cursor, err := trackCollection.Find(ctx, bson.M{"album": album, "loudness": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"fingerprint.acoustic": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, tracks)
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (repo *Track) SetAlbumGain(ctx context.Context, album string, gain, peak *float64) error {
+	update := bson.M{"$unset": bson.M{"loudness.album_gain": "", "loudness.album_peak": ""}}
+	if gain != nil && peak != nil {
+		update = bson.M{"$set": bson.M{"loudness.album_gain": *gain, "loudness.album_peak": *peak}}
+	}
+	_, err := trackCollection.UpdateMany(ctx, bson.M{"album": album, "loudness": bson.M{"$exists": true}}, update)
+	return err
+}
+
+func (repo *Track) UniqueContentHash(ctx context.Context, unique bool) error {
+	if !unique {
+		_, err := trackCollection.Indexes().DropOne(ctx, uniqueContentHashIndex)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == indexNotFound {
+			return nil
+		}
+		return err
+	}
+	_, err := trackCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "fingerprint.content_hash", Value: 1}},
+		Options: options.Index().SetName(uniqueContentHashIndex).SetUnique(true).
+			SetPartialFilterExpression(bson.M{"fingerprint.content_hash": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+func (repo *Track) IncrLikes(ctx context.Context, trackUuid string, delta int64) error {
+	return incrCounter(ctx, trackCollection, trackUuid, "likes", delta)
+}
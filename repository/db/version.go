@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"sample/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// versionFilter matches the document only while it still has the expected version,
+// documents written before versioning have no version field and count as version 0
+func versionFilter(uuid string, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": uuid, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": uuid, "version": version}
+}
+
+// versionMismatch explains why a versioned write matched nothing
+func versionMismatch(ctx context.Context, collection *mongo.Collection, uuid string) error {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": uuid})
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return repository.ErrNotFound
+	}
+	return repository.ErrVersionConflict
+}
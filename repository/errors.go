@@ -0,0 +1,14 @@
+package repository
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrConflict = errors.New("record already exists")
+	// ErrVersionConflict is returned when a record was changed since it was read
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrItemNotFound is returned when an entry inside a record does not exist
+	ErrItemNotFound = errors.New("record item not found")
+	// ErrItemsReadOnly is returned when the entries of a record are computed and can not be changed
+	ErrItemsReadOnly = errors.New("record items are read only")
+)
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"sample/common/model"
+)
+
+type ILikes interface {
+	// Like stores the like and returns false when the user liked the target already
+	Like(ctx context.Context, like model.Like) (bool, error)
+	// Unlike removes the like and returns false when there was none
+	Unlike(ctx context.Context, userId string, kind string, targetId string) (bool, error)
+	// GetLikes returns the likes of the user of one kind, newest first
+	GetLikes(ctx context.Context, userId string, kind string) (*[]model.Like, error)
+}
+
+var LikeRepo ILikes
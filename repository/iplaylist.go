@@ -8,9 +8,25 @@ import (
 type IPlaylist interface {
 	GetPlaylists(ctx context.Context, filter model.PlaylistFilter) (*[]model.Playlist, error)
 	GetPlaylistById(ctx context.Context, playlistUuid string) (*model.Playlist, error)
+	// GetPlaylistsByIds returns the existing playlists of playlistUuids in one query, in no particular order
+	GetPlaylistsByIds(ctx context.Context, playlistUuids []string) (*[]model.Playlist, error)
 	PostPlaylist(ctx context.Context, playlist model.Playlist) error
-	DeletePlaylistById(ctx context.Context, playlistUuid string) error
-	PutPlaylistById(ctx context.Context, playlistUuid string, playlistUpdate model.Playlist) error
+	// the writes below only apply while the record still has the given version,
+	// otherwise they return ErrVersionConflict; updates increment the version
+	DeletePlaylistById(ctx context.Context, playlistUuid string, version int64) error
+	PutPlaylistById(ctx context.Context, playlistUuid string, version int64, playlistUpdate model.Playlist) error
+	PatchPlaylistById(ctx context.Context, playlistUuid string, version int64, fields map[string]any) error
+	// IncrLikes adds delta to the like count, the version is not changed
+	IncrLikes(ctx context.Context, playlistUuid string, delta int64) error
+
+	// item operations change single entries of track_ids atomically and return the
+	// updated playlist; entries are addressed by index and ErrItemNotFound is returned
+	// when the index or track is not in the playlist, ErrItemsReadOnly on smart playlists
+	InsertPlaylistTracks(ctx context.Context, playlistUuid string, version int64, trackIds []model.TrackIds, position *int) (*model.Playlist, error)
+	RemovePlaylistTrack(ctx context.Context, playlistUuid string, version int64, trackId string) (*model.Playlist, error)
+	RemovePlaylistTrackAt(ctx context.Context, playlistUuid string, version int64, index int) (*model.Playlist, error)
+	MovePlaylistTracks(ctx context.Context, playlistUuid string, version int64, from, count, to int) (*model.Playlist, error)
+	SetPlaylistTrackPriority(ctx context.Context, playlistUuid string, version int64, index int, priority int) (*model.Playlist, error)
 }
 
 var PlaylistRepo IPlaylist
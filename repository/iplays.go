@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"sample/common/model"
+	"time"
+)
+
+type IPlays interface {
+	PostPlay(ctx context.Context, play model.Play) error
+	// GetLastCountedPlay returns the latest counted play of the track by the user, or ErrNotFound
+	GetLastCountedPlay(ctx context.Context, userId string, trackId string) (*model.Play, error)
+	// GetPlays returns the plays matching filter, newest first
+	GetPlays(ctx context.Context, filter model.PlayFilter) (*[]model.Play, error)
+	// IncrPlayCounts adds counts, keyed by track id, to the stored play counts. When it
+	// fails it returns the counts which were not added, the others must not be added again.
+	IncrPlayCounts(ctx context.Context, counts map[string]int64) (map[string]int64, error)
+	// GetPlayCounts returns the stored play counts of the tracks, tracks never played are left out
+	GetPlayCounts(ctx context.Context, trackIds []string) (map[string]int64, error)
+	// GetChart ranks the tracks, artists or genres by their counted plays since from, Rank is left unset
+	GetChart(ctx context.Context, chartType string, from time.Time, limit int) ([]model.ChartEntry, error)
+	// GetListeners returns the users with a counted play since from, keyed by track id
+	GetListeners(ctx context.Context, from time.Time) (map[string][]string, error)
+}
+
+var PlayRepo IPlays
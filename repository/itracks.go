@@ -8,9 +8,37 @@ import (
 type ITracks interface {
 	GetTracks(ctx context.Context, filter model.TrackFilter) (*[]model.Track, error)
 	GetTrackById(ctx context.Context, trackUuid string) (*model.Track, error)
+	// GetTracksByIds returns the existing tracks of trackUuids in one query, in no particular order
+	GetTracksByIds(ctx context.Context, trackUuids []string) (*[]model.Track, error)
+	// GetTracksByContentHash returns the tracks whose audio has the given content hash
+	GetTracksByContentHash(ctx context.Context, contentHash string) (*[]model.Track, error)
+	// GetFingerprintedTracks returns the tracks with a fingerprint and a duration
+	// between minDuration and maxDuration, 0 leaves a bound open
+	GetFingerprintedTracks(ctx context.Context, minDuration, maxDuration float64) (*[]model.Track, error)
+	// PostTrack and PutTrackById return ErrConflict when the content hash is taken
+	// while it is unique, see UniqueContentHash
 	PostTrack(ctx context.Context, track model.Track) error
-	DeleteTrackById(ctx context.Context, trackUuid string) error
-	PutTrackById(ctx context.Context, trackUuid string, trackUpdate model.Track) error
+	// GetUnanalyzedTrackIds returns up to limit ids, in order, of the tracks after
+	// afterId which have no analysis state yet
+	GetUnanalyzedTrackIds(ctx context.Context, afterId string, limit int) ([]string, error)
+	// the writes below only apply while the record still has the given version,
+	// otherwise they return ErrVersionConflict; updates increment the version
+	DeleteTrackById(ctx context.Context, trackUuid string, version int64) error
+	PutTrackById(ctx context.Context, trackUuid string, version int64, trackUpdate model.Track) error
+	PatchTrackById(ctx context.Context, trackUuid string, version int64, fields map[string]any) error
+	// SetTrackAnalysis sets analysis results while the audio still has the analyzed
+	// content hash, otherwise it returns ErrNotFound; the version is not changed
+	SetTrackAnalysis(ctx context.Context, trackUuid string, contentHash string, fields map[string]any) error
+	// GetAlbumLoudness returns the analyzed tracks of an album with their loudness histograms
+	GetAlbumLoudness(ctx context.Context, album string) (*[]model.Track, error)
+	// SetAlbumGain sets the album gain and peak on the analyzed tracks of an album,
+	// nil gain removes them
+	SetAlbumGain(ctx context.Context, album string, gain, peak *float64) error
+	// UniqueContentHash makes sure no two fingerprinted tracks have the same content
+	// hash, or when unique is false lifts that again
+	UniqueContentHash(ctx context.Context, unique bool) error
+	// IncrLikes adds delta to the like count, the version is not changed
+	IncrLikes(ctx context.Context, trackUuid string, delta int64) error
 }
 
 var TrackRepo ITracks
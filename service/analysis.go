@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"sample/common/audio"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+)
+
+const (
+	jobAnalyzeTrack = "track"
+	jobAlbumGain    = "album"
+
+	// unanalyzedPageSize is how many tracks without analysis are looked up at once on startup
+	unanalyzedPageSize = 500
+)
+
+// analysis holds the jobs of the audio analyzer: tracks whose audio needs analysis
+// and albums whose gain needs an update
+var analysis = newJobQueue()
+
+func queueTrackAnalysis(trackUuid string) {
+	analysis.push(job{kind: jobAnalyzeTrack, key: trackUuid})
+}
+
+// queueAlbumGain recomputes the gain of the albums whose membership changed
+func queueAlbumGain(albums ...string) {
+	for _, album := range albums {
+		analysis.push(job{kind: jobAlbumGain, key: album})
+	}
+}
+
+// AnalysisConfig holds the settings of the background audio analysis
+type AnalysisConfig struct {
+	// DetectKey adds musical key detection to loudness and tempo
+	DetectKey bool
+	// SilenceThreshold is the level in dBFS below which leading and trailing audio is silence
+	SilenceThreshold float64
+}
+
+type audioAnalyzer struct {
+	cfg AnalysisConfig
+}
+
+// RunAudioAnalyzer analyzes the audio of uploaded tracks in the background until
+// ctx is done. Tracks stored without analysis, e.g. before a restart, are queued first.
+// Jobs run one at a time, so album gains are never computed concurrently.
+func RunAudioAnalyzer(ctx context.Context, cfg AnalysisConfig) {
+	if cfg.SilenceThreshold >= 0 {
+		cfg.SilenceThreshold = audio.DefaultSilenceThreshold
+	}
+	analyzer := &audioAnalyzer{cfg: cfg}
+	queueUnanalyzedTracks(ctx)
+
+	analysis.run(ctx, func(next job) {
+		var err error
+		switch next.kind {
+		case jobAnalyzeTrack:
+			err = analyzer.analyzeTrack(ctx, next.key)
+		case jobAlbumGain:
+			err = analyzer.updateAlbumGain(ctx, next.key)
+		}
+		if err != nil {
+			log.Errorf("%s analysis of %q failed: %v", next.kind, next.key, err)
+		}
+	})
+}
+
+// queueUnanalyzedTracks queues the tracks without an analysis state, audio which
+// can not be analyzed has one, a page at a time
+func queueUnanalyzedTracks(ctx context.Context) {
+	afterId := ""
+	for {
+		trackIds, err := repository.TrackRepo.GetUnanalyzedTrackIds(ctx, afterId, unanalyzedPageSize)
+		if err != nil {
+			log.Errorf("load tracks for analysis failed: %v", err)
+			return
+		}
+		for _, trackId := range trackIds {
+			queueTrackAnalysis(trackId)
+		}
+		if len(trackIds) < unanalyzedPageSize {
+			return
+		}
+		afterId = trackIds[len(trackIds)-1]
+	}
+}
+
+// analyzeTrack measures the stored audio of a track and stores the results. Audio
+// which can not be decoded is marked, so it is not queued again on every start.
+func (a *audioAnalyzer) analyzeTrack(ctx context.Context, trackUuid string) error {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fields, err := a.measureTrack(track)
+	if err != nil {
+		log.Warningf("audio of track %s can not be analyzed: %v", trackUuid, err)
+		fields = map[string]any{"analysis": model.AnalysisUnsupported}
+	}
+
+	contentHash := ""
+	if track.Fingerprint != nil {
+		contentHash = track.Fingerprint.ContentHash
+	}
+	err = repository.TrackRepo.SetTrackAnalysis(ctx, trackUuid, contentHash, fields)
+	if errors.Is(err, repository.ErrNotFound) {
+		// deleted or given new audio meanwhile, which is analyzed by its own job
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fields["analysis"] == model.AnalysisDone {
+		queueAlbumGain(track.Album)
+	}
+	invalidateTrackCaches(ctx)
+	return nil
+}
+
+// measureTrack measures loudness, tempo, leading and trailing silence and optionally
+// the key of the stored audio of a track in one decoding pass
+func (a *audioAnalyzer) measureTrack(track *model.Track) (map[string]any, error) {
+	source := storedAudio{track: track}
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return nil, err
+	}
+	r, err := source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	decoder, err := audio.NewDecoder(bufio.NewReader(r), format)
+	if err != nil {
+		return nil, err
+	}
+
+	meter := audio.NewLoudnessMeter(decoder.SampleRate(), decoder.Channels())
+	tempo := audio.NewTempoDetector(decoder.SampleRate(), decoder.Channels())
+	silence := audio.NewSilenceDetector(decoder.SampleRate(), decoder.Channels(), a.cfg.SilenceThreshold)
+	analyzers := []audio.Analyzer{meter, tempo, silence}
+	var key *audio.KeyDetector
+	if a.cfg.DetectKey {
+		key = audio.NewKeyDetector(decoder.SampleRate(), decoder.Channels())
+		analyzers = append(analyzers, key)
+	}
+	if err := audio.Analyze(decoder, analyzers...); err != nil {
+		return nil, err
+	}
+	result := meter.Result()
+	loudness := model.Loudness{
+		Integrated: roundDecibels(result.Integrated),
+		Range:      roundDecibels(result.Range),
+		TruePeak:   roundDecibels(result.TruePeak),
+		TrackGain:  roundDecibels(model.ReplayGainReference - result.Integrated),
+		TrackPeak:  result.SamplePeak,
+		Histogram:  result.Histogram,
+	}
+
+	fields := map[string]any{"analysis": model.AnalysisDone, "loudness": loudness, "bpm": tempo.BPM()}
+	if key != nil {
+		fields["key"] = key.Key()
+	}
+	if start, end, ok := silence.Bounds(); ok {
+		fields["audio_start"], fields["audio_end"] = roundSeconds(start), roundSeconds(end)
+	}
+	return fields, nil
+}
+
+// updateAlbumGain computes the album gain over the blocks of all analyzed tracks
+// of the album, tracks without an album lose theirs
+func (a *audioAnalyzer) updateAlbumGain(ctx context.Context, album string) error {
+	if len(album) == 0 {
+		return repository.TrackRepo.SetAlbumGain(ctx, album, nil, nil)
+	}
+	tracks, err := repository.TrackRepo.GetAlbumLoudness(ctx, album)
+	if err != nil {
+		return err
+	} else if len(*tracks) == 0 {
+		return nil
+	}
+	histograms := make([][]uint32, 0, len(*tracks))
+	peak := 0.0
+	for _, track := range *tracks {
+		histograms = append(histograms, track.Loudness.Histogram)
+		peak = max(peak, track.Loudness.TrackPeak)
+	}
+	gain := roundDecibels(model.ReplayGainReference - audio.HistogramLoudness(histograms...))
+	if err := repository.TrackRepo.SetAlbumGain(ctx, album, &gain, &peak); err != nil {
+		return err
+	}
+	invalidateTrackCaches(ctx)
+	return nil
+}
+
+// roundSeconds rounds to the millisecond
+func roundSeconds(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// roundDecibels rounds to the hundredth of a dB, as ReplayGain tags carry them
+func roundDecibels(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sample/common/audio"
+	"sample/common/model"
+	"sample/common/util"
+
+	"github.com/tcolgate/mp3"
+)
+
+// AudioSource is an audio file handed to the track service, e.g. an upload
+type AudioSource interface {
+	Filename() string
+	Open() (io.ReadCloser, error)
+}
+
+// AudioPath returns the path of the stored audio file of the track
+func AudioPath(track *model.Track) string {
+	return filepath.Join(util.GetAudioDir(), track.ID, track.MP3File)
+}
+
+// stageAudio puts the audio of source at path, uploads are moved there and other
+// sources are copied. Readers never see the file partly written.
+func stageAudio(source AudioSource, path string) error {
+	if upload, ok := source.(*UploadedAudio); ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.Rename(upload.path, path)
+	}
+	src, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeAtomically(path, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
+
+// probeAudio returns the duration and the fingerprint of source, uploads were
+// probed while they were received
+func probeAudio(source AudioSource) (float64, *model.AudioFingerprint, error) {
+	if upload, ok := source.(*UploadedAudio); ok {
+		return upload.duration, upload.fingerprint, nil
+	}
+	duration, err := parseAudioSourceDuration(source)
+	if err != nil {
+		return 0, nil, err
+	}
+	fingerprint, err := fingerprintAudio(source)
+	if err != nil {
+		return 0, nil, err
+	}
+	return duration, fingerprint, nil
+}
+
+func parseAudioSourceDuration(source AudioSource) (float64, error) {
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := source.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	return audioDuration(fd, format)
+}
+
+func audioDuration(r io.Reader, format audio.Format) (float64, error) {
+	switch format {
+	case audio.FormatWAV:
+		wavFormat, data, err := audio.ReadWAVHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		return wavFormat.Duration(data.N), nil
+	case audio.FormatFLAC:
+		info, err := audio.ReadFLACHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		return info.Duration(), nil
+	}
+	return HandleParseAudioDuration(r)
+}
+
+func HandleParseAudioDuration(r io.Reader) (float64, error) {
+	var duration float64
+	decode := mp3.NewDecoder(r)
+	var frame mp3.Frame
+	skipped := 0
+	for {
+		if err := decode.Decode(&frame, &skipped); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		duration = duration + frame.Duration().Seconds()
+	}
+
+	return duration, nil
+}
+
+// writeAtomically fills the file at path at once, readers never see it partly written
+func writeAtomically(path string, fill func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if err := fill(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"sample/common/cache"
+	"sample/common/log"
+	"strconv"
+	"sync/atomic"
+)
+
+const trackGenerationKey = "tracks:generation"
+
+// trackGeneration changes on every track write, results derived from tracks are
+// cached under the generation they were computed in, so older ones are never read
+// again and expire. The redis counter does the same for caches shared by instances.
+var trackGeneration atomic.Int64
+
+func invalidateTrackCaches(ctx context.Context) {
+	trackGeneration.Add(1)
+	if cache.RCache != nil {
+		if err := cache.RCache.Incr(ctx, trackGenerationKey); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+}
+
+// sharedTrackGeneration returns the redis track generation, "0" before the first write
+func sharedTrackGeneration(ctx context.Context) (string, error) {
+	generation, err := cache.RCache.Get(ctx, trackGenerationKey)
+	if err != nil {
+		return "", err
+	} else if len(generation) == 0 {
+		return "0", nil
+	}
+	return generation, nil
+}
+
+// currentTrackGeneration returns the track generation to key caches on, the redis one
+// when redis is enabled, as the caches are invalidated by the writes of all instances.
+// It returns false when the generation can not be read and nothing should be cached.
+func currentTrackGeneration(ctx context.Context) (string, bool) {
+	if cache.RCache == nil {
+		return strconv.FormatInt(trackGeneration.Load(), 10), true
+	}
+	generation, err := sharedTrackGeneration(ctx)
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return "", false
+	}
+	return generation, true
+}
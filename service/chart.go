@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"time"
+)
+
+const (
+	defaultChartLimit = 10
+	maxChartLimit     = 100
+
+	hourBucketFormat = "2006010215"
+	dayBucketFormat  = "20060102"
+	// buckets are kept a little longer than the longest window which reads them
+	hourBucketRetention = 25 * time.Hour
+	dayBucketRetention  = 31 * 24 * time.Hour
+	// a merged window is reused for this long before it is computed again
+	chartUnionTTL = time.Minute
+)
+
+var errInvalidChart = apperror.BadRequest(apperror.CodeInvalidQuery, "type must be track, artist or genre and window day, week or month")
+
+type IChartService interface {
+	GetChart(ctx context.Context, filter model.ChartFilter) (*model.Chart, error)
+}
+
+type Chart struct {
+}
+
+func NewChart() IChartService {
+	return &Chart{}
+}
+
+// GetChart ranks by the plays counted in the window. With redis the plays are
+// summed from hourly (day window) or daily (week and month) sorted sets, without
+// it they are aggregated from the plays collection.
+func (s *Chart) GetChart(ctx context.Context, filter model.ChartFilter) (*model.Chart, error) {
+	if filter.Type != model.ChartTrack && filter.Type != model.ChartArtist && filter.Type != model.ChartGenre {
+		return nil, errInvalidChart
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultChartLimit
+	} else if filter.Limit > maxChartLimit {
+		filter.Limit = maxChartLimit
+	}
+	buckets, from, err := chartBuckets(filter.Type, filter.Window, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []model.ChartEntry
+	if cache.RCache != nil {
+		entries, err = redisChart(ctx, filter, buckets, from)
+	} else {
+		entries, err = repository.PlayRepo.GetChart(ctx, filter.Type, from, filter.Limit)
+	}
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	if filter.Type == model.ChartTrack {
+		if err := fillChartTracks(ctx, entries); err != nil {
+			return nil, err
+		}
+	}
+	return &model.Chart{Type: filter.Type, Window: filter.Window, From: from, Entries: entries}, nil
+}
+
+// recordChartPlay adds a counted play to the chart buckets of its hour and day
+func recordChartPlay(ctx context.Context, track *model.Track, playedAt time.Time) {
+	playedAt = playedAt.UTC()
+	members := map[string]string{
+		model.ChartTrack:  track.ID,
+		model.ChartArtist: track.Artist,
+		model.ChartGenre:  track.Genre,
+	}
+	for chartType, member := range members {
+		if len(member) == 0 {
+			continue
+		}
+		hourKey := chartKey(chartType, playedAt.Format(hourBucketFormat))
+		hourTTL := time.Until(playedAt.Truncate(time.Hour).Add(hourBucketRetention))
+		dayKey := chartKey(chartType, playedAt.Format(dayBucketFormat))
+		dayTTL := time.Until(playedAt.Truncate(24 * time.Hour).Add(dayBucketRetention))
+		for key, ttl := range map[string]time.Duration{hourKey: hourTTL, dayKey: dayTTL} {
+			// plays older than the retention would only create keys nobody reads
+			if ttl <= 0 {
+				continue
+			}
+			if err := cache.RCache.ZIncrBy(ctx, key, 1, member); err != nil {
+				log.WithContext(ctx).Error(err)
+				continue
+			}
+			if err := cache.RCache.Expire(ctx, key, ttl); err != nil {
+				log.WithContext(ctx).Error(err)
+			}
+		}
+	}
+}
+
+// chartBuckets returns the bucket names of the window ending at now and the start of the first one
+func chartBuckets(chartType string, window string, now time.Time) ([]string, time.Time, error) {
+	var count int
+	var step time.Duration
+	var format string
+	switch window {
+	case model.WindowDay:
+		count, step, format = 24, time.Hour, hourBucketFormat
+	case model.WindowWeek:
+		count, step, format = 7, 24*time.Hour, dayBucketFormat
+	case model.WindowMonth:
+		count, step, format = 30, 24*time.Hour, dayBucketFormat
+	default:
+		return nil, time.Time{}, errInvalidChart
+	}
+	from := now.Truncate(step).Add(-time.Duration(count-1) * step)
+	buckets := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		buckets = append(buckets, chartKey(chartType, from.Add(time.Duration(i)*step).Format(format)))
+	}
+	return buckets, from, nil
+}
+
+func chartKey(chartType string, bucket string) string {
+	return fmt.Sprintf("charts:%s:%s", chartType, bucket)
+}
+
+func redisChart(ctx context.Context, filter model.ChartFilter, buckets []string, from time.Time) ([]model.ChartEntry, error) {
+	unionKey := fmt.Sprintf("charts:%s:%s:%d", filter.Type, filter.Window, from.Unix())
+	// the merged window of the current bucket is shared for a short while
+	if ready, err := cache.RCache.Get(ctx, unionKey+":ready"); err != nil {
+		return nil, err
+	} else if len(ready) == 0 {
+		if err := cache.RCache.ZUnionStore(ctx, unionKey, buckets); err != nil {
+			return nil, err
+		}
+		if err := cache.RCache.Expire(ctx, unionKey, 2*chartUnionTTL); err != nil {
+			return nil, err
+		}
+		if err := cache.RCache.SetTTL(ctx, unionKey+":ready", true, chartUnionTTL); err != nil {
+			return nil, err
+		}
+	}
+	members, err := cache.RCache.ZRevRangeWithScores(ctx, unionKey, 0, int64(filter.Limit-1))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]model.ChartEntry, 0, len(members))
+	for _, member := range members {
+		entries = append(entries, model.ChartEntry{Key: member.Member, Plays: int64(member.Score)})
+	}
+	return entries, nil
+}
+
+func fillChartTracks(ctx context.Context, entries []model.ChartEntry) error {
+	trackUuids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		trackUuids = append(trackUuids, entry.Key)
+	}
+	tracks, err := repository.TrackRepo.GetTracksByIds(ctx, trackUuids)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	byId := make(map[string]*model.Track, len(*tracks))
+	for i := range *tracks {
+		byId[(*tracks)[i].ID] = &(*tracks)[i]
+	}
+	for i := range entries {
+		entries[i].Track = byId[entries[i].Key]
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"sample/common/apperror"
+	"sample/common/artwork"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/common/util"
+	"sample/repository"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	errCoverNotFound    = apperror.NotFound(apperror.CodeCoverNotFound, "cover art not found")
+	errInvalidImage     = apperror.BadRequest(apperror.CodeInvalidImage, artwork.ErrInvalidImage.Error())
+	errImageTooLarge    = apperror.BadRequest(apperror.CodeInvalidImage, fmt.Sprintf("image must be at most %d MB", artwork.MaxBytes>>20))
+	errInvalidCoverSize = apperror.FieldValidation(apperror.FieldError{Field: "size", Code: "enum", Message: fmt.Sprintf("must be one of %v", artwork.Sizes)})
+)
+
+// CoverFile is an open cover image, the caller closes it
+type CoverFile struct {
+	*os.File
+	Hash   string // of the image it was made from, or of the tiles of a mosaic
+	Format artwork.Format
+}
+
+// coverImage is one of the files a cover is stored in
+type coverImage struct {
+	size   int
+	format artwork.Format
+}
+
+// renderedCover holds a cover encoded at each of artwork.Sizes in each of artwork.Formats
+type renderedCover struct {
+	art    model.CoverArt
+	images map[coverImage][]byte
+}
+
+// coverPath names the stored covers in dir after the hash of their image,
+// so a record never points at the files of another image
+func coverPath(dir, prefix, hash string, size int, format artwork.Format) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%s_%d.%s", prefix, hash, size, format))
+}
+
+func trackCoverDir(trackUuid string) string {
+	return filepath.Join(util.GetAudioDir(), trackUuid)
+}
+
+func playlistCoverDir(playlistUuid string) string {
+	return filepath.Join(util.GetCoverDir(), "playlists", playlistUuid)
+}
+
+func validCoverSize(size int) error {
+	if !slices.Contains(artwork.Sizes, size) {
+		return errInvalidCoverSize
+	}
+	return nil
+}
+
+// renderCover validates an image and resizes it to every cover size
+func renderCover(data []byte, source string) (*renderedCover, error) {
+	img, err := artwork.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	cover := &renderedCover{
+		art:    model.CoverArt{Hash: hex.EncodeToString(sum[:8]), Source: source},
+		images: make(map[coverImage][]byte, len(artwork.Sizes)*len(artwork.Formats)),
+	}
+	for _, size := range artwork.Sizes {
+		square := artwork.Square(img, size)
+		for _, format := range artwork.Formats {
+			var buf bytes.Buffer
+			if err := format.Encode(&buf, square); err != nil {
+				return nil, err
+			}
+			cover.images[coverImage{size, format}] = buf.Bytes()
+		}
+	}
+	return cover, nil
+}
+
+// readCoverUpload reads an uploaded image, refusing files above artwork.MaxBytes
+func readCoverUpload(r io.Reader) (*renderedCover, error) {
+	data, err := io.ReadAll(io.LimitReader(r, artwork.MaxBytes+1))
+	if err != nil {
+		return nil, errInvalidImage.Wrap(err)
+	} else if len(data) > artwork.MaxBytes {
+		return nil, errImageTooLarge
+	}
+	cover, err := renderCover(data, model.CoverUploaded)
+	if err != nil {
+		return nil, errInvalidImage.Wrap(err)
+	}
+	return cover, nil
+}
+
+// extractCover renders the picture embedded in audio, nil when there is none.
+// A broken picture only costs the cover and is logged.
+func extractCover(ctx context.Context, source AudioSource) *renderedCover {
+	r, err := source.Open()
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return nil
+	}
+	defer r.Close()
+	picture, err := artwork.Extract(r)
+	if err != nil || picture == nil {
+		return nil
+	}
+	cover, err := renderCover(picture.Data, model.CoverEmbedded)
+	if err != nil {
+		log.WithContext(ctx).Warningf("embedded cover of %s is not used: %v", source.Filename(), err)
+		return nil
+	}
+	return cover
+}
+
+// writeCover stores every size and format of cover in dir
+func writeCover(dir string, cover *renderedCover) error {
+	for image, data := range cover.images {
+		err := writeAtomically(coverPath(dir, "cover", cover.art.Hash, image.size, image.format), func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globCovers lists the files in dir matching pattern in each of artwork.Formats.
+// The audio file of a track shares its directory, so only image extensions match.
+func globCovers(dir, pattern string) ([]string, error) {
+	var paths []string
+	for _, format := range artwork.Formats {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern+"."+string(format)))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// removeCovers removes the files in dir starting with prefix except the ones of keep,
+// a failure is logged
+func removeCovers(ctx context.Context, dir, prefix, keep string) {
+	paths, err := globCovers(dir, prefix+"_*")
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	for _, path := range paths {
+		if len(keep) > 0 && strings.HasPrefix(filepath.Base(path), prefix+"_"+keep+"_") {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+}
+
+// storeTrackCover replaces the cover files of a track with the ones of its record
+func storeTrackCover(ctx context.Context, track *model.Track, cover *renderedCover) {
+	if cover != nil {
+		if err := writeCover(trackCoverDir(track.ID), cover); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+	keep := ""
+	if track.Cover != nil {
+		keep = track.Cover.Hash
+	}
+	removeCovers(ctx, trackCoverDir(track.ID), "cover", keep)
+}
+
+// openCover opens a stored cover in format, or else in JPEG, which covers stored
+// before WebP have only
+func openCover(dir, prefix, hash string, size int, format artwork.Format) (*CoverFile, error) {
+	f, err := os.Open(coverPath(dir, prefix, hash, size, format))
+	if os.IsNotExist(err) && format != artwork.JPEG {
+		return openCover(dir, prefix, hash, size, artwork.JPEG)
+	} else if os.IsNotExist(err) {
+		return nil, errCoverNotFound.Wrap(err)
+	} else if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	return &CoverFile{File: f, Hash: hash, Format: format}, nil
+}
+
+func (s *Track) GetTrackCover(ctx context.Context, trackUuid string, size int, format artwork.Format) (*CoverFile, error) {
+	if err := validCoverSize(size); err != nil {
+		return nil, err
+	}
+	track, err := s.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, err
+	} else if track.Cover == nil {
+		return nil, errCoverNotFound
+	}
+	return openCover(trackCoverDir(track.ID), "cover", track.Cover.Hash, size, format)
+}
+
+func (s *Track) PutTrackCover(ctx context.Context, trackUuid string, version int64, image io.Reader) (*model.Track, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	} else if track.Version != version {
+		return nil, errVersionMismatch
+	}
+	cover, err := readCoverUpload(image)
+	if err != nil {
+		return nil, err
+	}
+	// the files go first, they are named after the image and unused until the record points at them
+	if err := writeCover(trackCoverDir(track.ID), cover); err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if err := repository.TrackRepo.PatchTrackById(ctx, trackUuid, version, map[string]any{"cover": cover.art}); err != nil {
+		removeCovers(ctx, trackCoverDir(track.ID), "cover", hashOf(track.Cover))
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	track.Cover = &cover.art
+	track.Version = version + 1
+	removeCovers(ctx, trackCoverDir(track.ID), "cover", cover.art.Hash)
+	s.tagStoredAudio(ctx, track)
+	invalidateTrackCaches(ctx)
+	return track, nil
+}
+
+func (s *Playlist) PutPlaylistCover(ctx context.Context, playlistUuid string, version int64, image io.Reader) (*model.Playlist, error) {
+	playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return nil, repositoryError(err, errPlaylistNotFound)
+	} else if playlist.Version != version {
+		return nil, errVersionMismatch
+	}
+	cover, err := readCoverUpload(image)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCover(playlistCoverDir(playlist.ID), cover); err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if err := repository.PlaylistRepo.PatchPlaylistById(ctx, playlistUuid, version, map[string]any{"cover": cover.art}); err != nil {
+		removeCovers(ctx, playlistCoverDir(playlist.ID), "cover", hashOf(playlist.Cover))
+		return nil, repositoryError(err, errPlaylistNotFound)
+	}
+	playlist.Cover = &cover.art
+	playlist.Version = version + 1
+	removeCovers(ctx, playlistCoverDir(playlist.ID), "cover", cover.art.Hash)
+	if err := resolveSmartTracks(ctx, playlist); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// GetPlaylistCover returns the own cover of a playlist, or else a 2x2 mosaic of
+// the first four different covers of its tracks, or the first one when there are fewer
+func (s *Playlist) GetPlaylistCover(ctx context.Context, playlistUuid string, size int, format artwork.Format) (*CoverFile, error) {
+	if err := validCoverSize(size); err != nil {
+		return nil, err
+	}
+	playlist, err := s.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.Cover != nil {
+		return openCover(playlistCoverDir(playlist.ID), "cover", playlist.Cover.Hash, size, format)
+	}
+
+	trackIds := make([]string, 0, len(playlist.TrackIds))
+	for _, trackId := range playlist.TrackIds {
+		trackIds = append(trackIds, trackId.TrackID)
+	}
+	tracks, err := repository.TrackRepo.GetTracksByIds(ctx, trackIds)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	byId := make(map[string]*model.Track, len(*tracks))
+	for i := range *tracks {
+		byId[(*tracks)[i].ID] = &(*tracks)[i]
+	}
+	tiles := make([]*model.Track, 0, 4)
+	seen := map[string]struct{}{}
+	for _, trackId := range trackIds {
+		track, ok := byId[trackId]
+		if !ok || track.Cover == nil {
+			continue
+		}
+		if _, ok := seen[track.Cover.Hash]; ok {
+			continue
+		}
+		seen[track.Cover.Hash] = struct{}{}
+		tiles = append(tiles, track)
+		if len(tiles) == 4 {
+			break
+		}
+	}
+	if len(tiles) == 0 {
+		return nil, errCoverNotFound
+	} else if len(tiles) < 4 {
+		return openCover(trackCoverDir(tiles[0].ID), "cover", tiles[0].Cover.Hash, size, format)
+	}
+
+	hashes := make([]string, 0, len(tiles))
+	for _, track := range tiles {
+		hashes = append(hashes, track.Cover.Hash)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(hashes, ",")))
+	hash := hex.EncodeToString(sum[:8])
+	dir := playlistCoverDir(playlist.ID)
+	if _, err := os.Stat(coverPath(dir, "mosaic", hash, size, format)); os.IsNotExist(err) {
+		if err := writeMosaic(dir, hash, tiles, size); os.IsNotExist(err) {
+			return nil, errCoverNotFound.Wrap(err)
+		} else if err != nil {
+			return nil, apperror.Internal(err)
+		}
+		removeMosaics(ctx, dir, hash, size)
+	}
+	return openCover(dir, "mosaic", hash, size, format)
+}
+
+// writeMosaic tiles the covers of four tracks in each of artwork.Formats, each
+// tile from the stored JPEG of the size closest above it
+func writeMosaic(dir, hash string, tracks []*model.Track, size int) error {
+	tileSize := artwork.Sizes[len(artwork.Sizes)-1]
+	for _, stored := range artwork.Sizes {
+		if stored >= size/2 {
+			tileSize = stored
+			break
+		}
+	}
+	var tiles [4]image.Image
+	for i, track := range tracks {
+		img, err := readCover(coverPath(trackCoverDir(track.ID), "cover", track.Cover.Hash, tileSize, artwork.JPEG))
+		if err != nil {
+			return err
+		}
+		tiles[i] = img
+	}
+	mosaic := artwork.Mosaic(tiles, size)
+	for _, format := range artwork.Formats {
+		err := writeAtomically(coverPath(dir, "mosaic", hash, size, format), func(w io.Writer) error {
+			return format.Encode(w, mosaic)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCover(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(bufio.NewReader(f))
+	return img, err
+}
+
+// removeMosaics drops the mosaics of size made from other tiles, a failure is logged
+func removeMosaics(ctx context.Context, dir, keep string, size int) {
+	paths, err := globCovers(dir, "mosaic_*_"+strconv.Itoa(size))
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), "mosaic_"+keep+"_") {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+}
+
+func hashOf(cover *model.CoverArt) string {
+	if cover == nil {
+		return ""
+	}
+	return cover.Hash
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"sample/common/apperror"
+	"sample/repository"
+)
+
+var (
+	errTrackNotFound     = apperror.NotFound(apperror.CodeTrackNotFound, "track not found")
+	errPlaylistNotFound  = apperror.NotFound(apperror.CodePlaylistNotFound, "playlist not found")
+	errEntryNotFound     = apperror.NotFound(apperror.CodeEntryNotFound, "playlist entry not found")
+	errInvalidAudio      = apperror.BadRequest(apperror.CodeInvalidAudio, "audio file could not be decoded")
+	errAudioFileNotFound = apperror.NotFound(apperror.CodeAudioNotFound, "audio file not found")
+	errVersionMismatch   = apperror.PreconditionFailed(apperror.CodeVersionMismatch, "the resource was modified, reload it and retry")
+)
+
+// repositoryError maps an error of the repository layer to a domain error,
+// notFound is returned when the record does not exist
+func repositoryError(err error, notFound *apperror.Error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFound.Wrap(err)
+	case errors.Is(err, repository.ErrItemNotFound):
+		return errEntryNotFound.Wrap(err)
+	case errors.Is(err, repository.ErrVersionConflict):
+		return errVersionMismatch.Wrap(err)
+	case errors.Is(err, repository.ErrConflict):
+		return apperror.Conflict(apperror.CodeConflict, "record already exists").Wrap(err)
+	default:
+		return apperror.Internal(err)
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sample/common/apperror"
+	"sample/common/audio"
+	"sample/common/model"
+	"sample/repository"
+	"sort"
+)
+
+const (
+	// acousticMatch is the share of equal fingerprint bits from which two tracks sound the same
+	acousticMatch = 0.8
+	// acousticDurationTolerance bounds, in seconds, the duration difference of tracks compared acoustically
+	acousticDurationTolerance = 5.0
+)
+
+// detectAudioFormat reads the first bytes of source to tell its format
+func detectAudioFormat(source AudioSource) (audio.Format, error) {
+	r, err := source.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	head := make([]byte, 12)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	format, err := audio.DetectFormat(head[:n])
+	if err != nil {
+		// mp3 streams may start with junk before the first frame, which the frame decoder skips
+		return audio.FormatMP3, nil
+	}
+	return format, nil
+}
+
+// fingerprintAudio hashes the audio of source and, when its format can be
+// decoded, computes its acoustic fingerprint
+func fingerprintAudio(source AudioSource) (*model.AudioFingerprint, error) {
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return nil, err
+	}
+	r, err := source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	contentHash, err := audio.ContentHash(r, format)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := &model.AudioFingerprint{ContentHash: contentHash}
+	if !audio.Decodable(format) {
+		return fingerprint, nil
+	}
+
+	pcm, err := source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer pcm.Close()
+	decoder, err := audio.NewDecoder(pcm, format)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint.Acoustic, err = audio.AcousticFingerprint(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return fingerprint, nil
+}
+
+// findDuplicate returns a track other than track whose audio is the same, or nil
+func findDuplicate(ctx context.Context, track *model.Track) (*model.Track, error) {
+	if track.Fingerprint == nil {
+		return nil, nil
+	}
+	same, err := repository.TrackRepo.GetTracksByContentHash(ctx, track.Fingerprint.ContentHash)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *same {
+		if (*same)[i].ID != track.ID {
+			return &(*same)[i], nil
+		}
+	}
+	if len(track.Fingerprint.Acoustic) == 0 {
+		return nil, nil
+	}
+
+	candidates, err := repository.TrackRepo.GetFingerprintedTracks(ctx,
+		max(track.Duration-acousticDurationTolerance, 0), track.Duration+acousticDurationTolerance)
+	if err != nil {
+		return nil, err
+	}
+	var duplicate *model.Track
+	best := acousticMatch
+	for i, candidate := range *candidates {
+		if candidate.ID == track.ID || candidate.Fingerprint == nil {
+			continue
+		}
+		if score := audio.CompareFingerprints(track.Fingerprint.Acoustic, candidate.Fingerprint.Acoustic); score >= best {
+			duplicate, best = &(*candidates)[i], score
+		}
+	}
+	return duplicate, nil
+}
+
+// checkDuplicate applies the duplicate policy to a track about to be stored,
+// it either rejects the track or links it to the track it duplicates. Uploads
+// racing each other are not seen here, with rejects the unique content hash
+// refuses the second of them when it is written, see duplicateError.
+func (s *Track) checkDuplicate(ctx context.Context, track *model.Track) error {
+	track.AlternateOf = ""
+	duplicate, err := findDuplicate(ctx, track)
+	if err != nil {
+		return apperror.Internal(err)
+	} else if duplicate == nil {
+		return nil
+	}
+
+	if s.duplicates == model.DuplicateLink {
+		// alternates all point at the first upload, not at each other
+		track.AlternateOf = duplicate.ID
+		if len(duplicate.AlternateOf) > 0 {
+			track.AlternateOf = duplicate.AlternateOf
+		}
+		return nil
+	}
+	return apperror.Conflict(apperror.CodeDuplicateAudio,
+		fmt.Sprintf("the audio is already in the catalog as track %s", duplicate.ID))
+}
+
+// duplicateError maps the error of writing track, a conflict is the content hash
+// of another track
+func duplicateError(err error) error {
+	if errors.Is(err, repository.ErrConflict) {
+		return apperror.Conflict(apperror.CodeDuplicateAudio, "the audio is already in the catalog").Wrap(err)
+	}
+	return repositoryError(err, errTrackNotFound)
+}
+
+// PrepareDuplicateUploads lets the database refuse a second track with the same
+// audio when duplicates are rejected, across every replica of the service
+func PrepareDuplicateUploads(ctx context.Context, policy model.DuplicatePolicy) error {
+	return repository.TrackRepo.UniqueContentHash(ctx, policy != model.DuplicateLink)
+}
+
+func (s *Track) GetDuplicates(ctx context.Context) (*[]model.DuplicateCluster, error) {
+	tracks, err := repository.TrackRepo.GetFingerprintedTracks(ctx, 0, 0)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	list := *tracks
+
+	// union find over the tracks, joined by content hash, alternate links and sound
+	parent := make([]int, len(list))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		if ri, rj := root(i), root(j); ri != rj {
+			parent[max(ri, rj)] = min(ri, rj)
+		}
+	}
+
+	byHash := map[string]int{}
+	byId := map[string]int{}
+	for i, track := range list {
+		byId[track.ID] = i
+		if first, ok := byHash[track.Fingerprint.ContentHash]; ok {
+			union(first, i)
+		} else {
+			byHash[track.Fingerprint.ContentHash] = i
+		}
+	}
+	for i, track := range list {
+		if j, ok := byId[track.AlternateOf]; ok {
+			union(i, j)
+		}
+	}
+
+	// acoustic comparisons only between tracks of about the same duration
+	byDuration := make([]int, len(list))
+	for i := range byDuration {
+		byDuration[i] = i
+	}
+	sort.Slice(byDuration, func(a, b int) bool {
+		return list[byDuration[a]].Duration < list[byDuration[b]].Duration
+	})
+	for a, i := range byDuration {
+		if len(list[i].Fingerprint.Acoustic) == 0 {
+			continue
+		}
+		for _, j := range byDuration[a+1:] {
+			if list[j].Duration-list[i].Duration > acousticDurationTolerance {
+				break
+			}
+			if root(i) == root(j) || len(list[j].Fingerprint.Acoustic) == 0 {
+				continue
+			}
+			if audio.CompareFingerprints(list[i].Fingerprint.Acoustic, list[j].Fingerprint.Acoustic) >= acousticMatch {
+				union(i, j)
+			}
+		}
+	}
+
+	// the tracks are ordered by creation, so clusters are ordered by their first upload
+	clusters := make([]model.DuplicateCluster, 0)
+	clusterOf := map[int]int{}
+	for i := range list {
+		r := root(i)
+		index, ok := clusterOf[r]
+		if !ok {
+			index = len(clusters)
+			clusterOf[r] = index
+			clusters = append(clusters, model.DuplicateCluster{Match: "content", ContentHash: list[i].Fingerprint.ContentHash})
+		}
+		cluster := &clusters[index]
+		if cluster.ContentHash != list[i].Fingerprint.ContentHash {
+			cluster.Match = "acoustic"
+			cluster.ContentHash = ""
+		}
+		cluster.Tracks = append(cluster.Tracks, list[i])
+	}
+	duplicates := make([]model.DuplicateCluster, 0)
+	for _, cluster := range clusters {
+		if len(cluster.Tracks) > 1 {
+			duplicates = append(duplicates, cluster)
+		}
+	}
+	return &duplicates, nil
+}
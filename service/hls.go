@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sample/common/apperror"
+	"sample/common/audio"
+	"sample/common/cache"
+	"sample/common/hls"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/common/transcode"
+	"sample/repository"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSegmentDuration = 6 * time.Second
+	hlsSegmentsTTL         = time.Hour
+)
+
+// defaultHLSRendition is the only variant when no mp3 rendition is configured
+var defaultHLSRendition = transcode.Rendition{Format: transcode.MP3, Bitrate: 128}
+
+var errSegmentNotFound = apperror.NotFound(apperror.CodeSegmentNotFound, "hls segment not found")
+
+// HLSSegment is a packed audio segment, the timestamp tag followed by its frames
+type HLSSegment struct {
+	io.Reader
+	Size int64
+	file *os.File
+}
+
+func (s *HLSSegment) Close() error {
+	return s.file.Close()
+}
+
+// hlsVariants are the mp3 renditions configured ahead of time
+func (s *Stream) hlsVariants() []transcode.Rendition {
+	variants := make([]transcode.Rendition, 0)
+	for _, rendition := range s.cfg.Renditions {
+		if rendition.Format == transcode.MP3 {
+			variants = append(variants, rendition)
+		}
+	}
+	if len(variants) == 0 {
+		variants = append(variants, defaultHLSRendition)
+	}
+	return variants
+}
+
+func (s *Stream) HLSMaster(ctx context.Context, trackUuid string) (*hls.MasterPlaylist, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	playlist := &hls.MasterPlaylist{Variants: make([]hls.Variant, 0)}
+	for _, rendition := range s.hlsVariants() {
+		f, segments, err := s.segments(ctx, track, rendition)
+		if errors.Is(err, transcode.ErrUnsupported) {
+			continue
+		} else if err != nil {
+			return nil, renditionError(err)
+		}
+		f.Close()
+
+		variant := hls.Variant{URI: rendition.String() + "/index.m3u8", Codecs: hls.MP3Codecs}
+		var size int64
+		var duration float64
+		for _, segment := range segments {
+			bits := float64(segment.Size+int64(len(hls.TimestampTag(segment.Start)))) * 8
+			variant.Bandwidth = max(variant.Bandwidth, int(bits/segment.Duration+0.5))
+			size += segment.Size
+			duration += segment.Duration
+		}
+		if duration > 0 {
+			variant.AverageBandwidth = int(float64(size)*8/duration + 0.5)
+		}
+		playlist.Variants = append(playlist.Variants, variant)
+	}
+	if len(playlist.Variants) == 0 {
+		return nil, errRenditionUnavailable
+	}
+	return playlist, nil
+}
+
+func (s *Stream) HLSMedia(ctx context.Context, trackUuid string, rendition transcode.Rendition) (*hls.MediaPlaylist, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	f, segments, err := s.segments(ctx, track, rendition)
+	if err != nil {
+		return nil, renditionError(err)
+	}
+	f.Close()
+
+	playlist := &hls.MediaPlaylist{Segments: make([]hls.Segment, 0, len(segments))}
+	for i, segment := range segments {
+		playlist.Segments = append(playlist.Segments, hls.Segment{URI: strconv.Itoa(i) + ".mp3", Duration: segment.Duration})
+	}
+	return playlist, nil
+}
+
+func (s *Stream) HLSSegment(ctx context.Context, trackUuid string, rendition transcode.Rendition, index int) (*HLSSegment, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	f, segments, err := s.segments(ctx, track, rendition)
+	if err != nil {
+		return nil, renditionError(err)
+	}
+	if index < 0 || index >= len(segments) {
+		f.Close()
+		return nil, errSegmentNotFound
+	}
+	segment := segments[index]
+	tag := hls.TimestampTag(segment.Start)
+	return &HLSSegment{
+		Reader: io.MultiReader(bytes.NewReader(tag), io.NewSectionReader(f, segment.Offset, segment.Size)),
+		Size:   int64(len(tag)) + segment.Size,
+		file:   f,
+	}, nil
+}
+
+// segments opens an mp3 rendition and splits it into HLS segments, which are
+// kept in memory for the size of the rendition file
+func (s *Stream) segments(ctx context.Context, track *model.Track, rendition transcode.Rendition) (*os.File, []audio.MP3Segment, error) {
+	if rendition.Format != transcode.MP3 {
+		// packed audio segments of HLS can not hold the other formats
+		return nil, nil, transcode.ErrUnsupported
+	}
+	f, err := s.open(ctx, track, rendition)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	key := fmt.Sprintf("hls_segments:%s:%d:%d", renditionKey(track, rendition), info.Size(), s.cfg.SegmentDuration)
+	if cache.MCache != nil {
+		if cached, err := cache.MCache.Get(key); err != nil {
+			log.WithContext(ctx).Error(err)
+		} else if segments, ok := cached.([]audio.MP3Segment); ok {
+			return f, segments, nil
+		}
+	}
+
+	segments, err := audio.SegmentMP3(io.NewSectionReader(f, 0, info.Size()), s.cfg.SegmentDuration.Seconds())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if cache.MCache != nil {
+		if err := cache.MCache.SetTTL(key, segments, hlsSegmentsTTL); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+	return f, segments, nil
+}
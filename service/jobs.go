@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// job is a unit of background work on a track or album, see jobQueue
+type job struct {
+	kind string
+	key  string // track id or album name
+}
+
+// jobQueue holds the pending jobs of a background worker in memory, a job
+// already pending is not added again
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    []job
+	pending map[job]bool
+	ready   chan struct{}
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{pending: map[job]bool{}, ready: make(chan struct{}, 1)}
+}
+
+func (q *jobQueue) push(next job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[next] {
+		return
+	}
+	q.pending[next] = true
+	q.jobs = append(q.jobs, next)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *jobQueue) pop() (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return job{}, false
+	}
+	next := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	delete(q.pending, next)
+	return next, true
+}
+
+// run hands the jobs to do one at a time until ctx is done
+func (q *jobQueue) run(ctx context.Context, do func(next job)) {
+	for {
+		next, ok := q.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.ready:
+			}
+			continue
+		}
+		do(next)
+	}
+}
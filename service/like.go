@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sample/common/apperror"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"time"
+)
+
+type ILikeService interface {
+	// Like and Unlike are idempotent, the like count changes only when the like does
+	Like(ctx context.Context, userId string, kind string, targetUuid string) (*model.LikeStatus, error)
+	Unlike(ctx context.Context, userId string, kind string, targetUuid string) (*model.LikeStatus, error)
+	GetLibrary(ctx context.Context, userId string) (*model.Library, error)
+}
+
+type Like struct {
+}
+
+func NewLike() ILikeService {
+	return &Like{}
+}
+
+func (s *Like) Like(ctx context.Context, userId string, kind string, targetUuid string) (*model.LikeStatus, error) {
+	if _, err := likeCount(ctx, kind, targetUuid); err != nil {
+		return nil, err
+	}
+	like := model.Like{
+		UserID:    userId,
+		Kind:      kind,
+		TargetID:  targetUuid,
+		CreatedAt: time.Now().UTC(),
+	}
+	created, err := repository.LikeRepo.Like(ctx, like)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if created {
+		if err := incrLikes(ctx, kind, targetUuid, 1); err != nil {
+			return nil, err
+		}
+	}
+	likes, err := likeCount(ctx, kind, targetUuid)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LikeStatus{Liked: true, Likes: likes}, nil
+}
+
+func (s *Like) Unlike(ctx context.Context, userId string, kind string, targetUuid string) (*model.LikeStatus, error) {
+	removed, err := repository.LikeRepo.Unlike(ctx, userId, kind, targetUuid)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if removed {
+		// the like of a deleted target is removed without a count to update
+		if err := incrLikes(ctx, kind, targetUuid, -1); err != nil && apperror.KindOf(err) != apperror.KindNotFound {
+			return nil, err
+		}
+	}
+	likes, err := likeCount(ctx, kind, targetUuid)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LikeStatus{Liked: false, Likes: likes}, nil
+}
+
+// GetLibrary returns the liked tracks and playlists which still exist, most recently liked first
+func (s *Like) GetLibrary(ctx context.Context, userId string) (*model.Library, error) {
+	library := &model.Library{Tracks: []model.Track{}, Playlists: []model.Playlist{}}
+
+	trackLikes, err := repository.LikeRepo.GetLikes(ctx, userId, model.LikeTrack)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	tracks, err := repository.TrackRepo.GetTracksByIds(ctx, likeTargets(*trackLikes))
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	tracksById := make(map[string]model.Track, len(*tracks))
+	for _, track := range *tracks {
+		tracksById[track.ID] = track
+	}
+	for _, like := range *trackLikes {
+		if track, ok := tracksById[like.TargetID]; ok {
+			library.Tracks = append(library.Tracks, track)
+		}
+	}
+
+	playlistLikes, err := repository.LikeRepo.GetLikes(ctx, userId, model.LikePlaylist)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	playlists, err := repository.PlaylistRepo.GetPlaylistsByIds(ctx, likeTargets(*playlistLikes))
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	playlistsById := make(map[string]model.Playlist, len(*playlists))
+	for _, playlist := range *playlists {
+		playlistsById[playlist.ID] = playlist
+	}
+	for _, like := range *playlistLikes {
+		if playlist, ok := playlistsById[like.TargetID]; ok {
+			if err := resolveSmartTracks(ctx, &playlist); err != nil {
+				return nil, err
+			}
+			library.Playlists = append(library.Playlists, playlist)
+		}
+	}
+	return library, nil
+}
+
+func likeTargets(likes []model.Like) []string {
+	targets := make([]string, 0, len(likes))
+	for _, like := range likes {
+		targets = append(targets, like.TargetID)
+	}
+	return targets
+}
+
+// likeCount returns the like count of the target, or not found when it does not exist
+func likeCount(ctx context.Context, kind string, targetUuid string) (int64, error) {
+	switch kind {
+	case model.LikeTrack:
+		track, err := repository.TrackRepo.GetTrackById(ctx, targetUuid)
+		if err != nil {
+			return 0, repositoryError(err, errTrackNotFound)
+		}
+		return track.Likes, nil
+	case model.LikePlaylist:
+		playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, targetUuid)
+		if err != nil {
+			return 0, repositoryError(err, errPlaylistNotFound)
+		}
+		return playlist.Likes, nil
+	}
+	return 0, apperror.Internal(errors.New("unknown like kind " + kind))
+}
+
+func incrLikes(ctx context.Context, kind string, targetUuid string, delta int64) error {
+	var err error
+	notFound := errTrackNotFound
+	switch kind {
+	case model.LikeTrack:
+		err = repository.TrackRepo.IncrLikes(ctx, targetUuid, delta)
+	case model.LikePlaylist:
+		err = repository.PlaylistRepo.IncrLikes(ctx, targetUuid, delta)
+		notFound = errPlaylistNotFound
+	}
+	if err != nil {
+		log.WithContext(ctx).Errorf("update like count of %s %s failed: %v", kind, targetUuid, err)
+		return repositoryError(err, notFound)
+	}
+	return nil
+}
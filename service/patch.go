@@ -0,0 +1,81 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sample/common/apperror"
+	"sample/common/model"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+var (
+	errInvalidPatch    = apperror.BadRequest(apperror.CodeInvalidPatch, "patch could not be applied")
+	errPatchTestFailed = apperror.Conflict(apperror.CodePatchTestFailed, "patch test operation failed")
+)
+
+// trackPatchDocument holds the fields of a track which can be patched
+type trackPatchDocument struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Genre       string `json:"genre"`
+	ReleaseYear int    `json:"release_year"`
+}
+
+// playlistPatchDocument holds the fields of a playlist which can be patched
+type playlistPatchDocument struct {
+	Name         string               `json:"name"`
+	TrackIds     []model.TrackIds     `json:"track_ids"`
+	PlaybackMode string               `json:"playback_mode"`
+	Smart        *model.SmartPlaylist `json:"smart"`
+}
+
+// applyPatch applies patch to the json of doc and decodes the result into dest,
+// fields which do not exist in dest are rejected
+func applyPatch(doc any, patch model.Patch, dest any) error {
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+
+	var patched []byte
+	switch patch.Type {
+	case model.JSONPatch:
+		operations, err := jsonpatch.DecodePatch(patch.Document)
+		if err != nil {
+			return errInvalidPatch.Wrap(err)
+		}
+		patched, err = operations.Apply(original)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return errPatchTestFailed.Wrap(err)
+		} else if err != nil {
+			return errInvalidPatch.Wrap(err)
+		}
+	case model.MergePatch:
+		patched, err = jsonpatch.MergePatch(original, patch.Document)
+		if err != nil {
+			return errInvalidPatch.Wrap(err)
+		}
+	default:
+		return apperror.UnsupportedMediaType(apperror.CodeUnsupportedMedia, "unsupported patch type")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			validationErr := apperror.FieldValidation(apperror.FieldError{Field: typeErr.Field, Code: "type", Message: "has an invalid type"})
+			return validationErr.Wrap(err)
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			validationErr := apperror.FieldValidation(apperror.FieldError{Field: strings.Trim(field, `"`), Code: "read_only", Message: "can not be patched"})
+			return validationErr.Wrap(err)
+		}
+		return errInvalidPatch.Wrap(err)
+	}
+	return nil
+}
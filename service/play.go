@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// a play counts once the track was listened to for minPlaySeconds or minPlayShare of its duration
+	minPlaySeconds = 30
+	minPlayShare   = 0.5
+
+	pendingPlaysKey     = "plays:pending"
+	playingKeyPrefix    = "plays:playing:"
+	playCountKeyPrefix  = "plays:count:"
+	playCountFlushBatch = 500
+	finalFlushTimeout   = 10 * time.Second
+)
+
+type IPlayService interface {
+	PostPlay(ctx context.Context, userId string, trackUuid string, request model.PlayRequest) (*model.Play, error)
+	GetPlays(ctx context.Context, filter model.PlayFilter) (*[]model.Play, error)
+	GetPlayCount(ctx context.Context, trackUuid string) (*model.TrackPlayCount, error)
+	// FlushPlayCounts moves the play counts collected in redis to the database
+	FlushPlayCounts(ctx context.Context) error
+}
+
+type Play struct {
+	// counting serializes the overlap check and the insert of counted plays without redis
+	counting sync.Mutex
+}
+
+func NewPlay() IPlayService {
+	return &Play{}
+}
+
+// PostPlay records a play. It adds to the play count when it is long enough and does
+// not overlap the last counted play of the same track by the same user.
+func (s *Play) PostPlay(ctx context.Context, userId string, trackUuid string, request model.PlayRequest) (*model.Play, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	if len(request.PlaylistID) > 0 {
+		if _, err := repository.PlaylistRepo.GetPlaylistById(ctx, request.PlaylistID); err != nil {
+			return nil, repositoryError(err, errPlaylistNotFound)
+		}
+	}
+
+	play := &model.Play{
+		ID:         uuid.NewString(),
+		UserID:     userId,
+		TrackID:    trackUuid,
+		PlaylistID: request.PlaylistID,
+		PlayedAt:   time.Now().UTC(),
+		Duration:   request.Duration,
+	}
+	// nobody listens to a track for longer than it lasts
+	if track.Duration > 0 {
+		play.Duration = min(max(play.Duration, 0), track.Duration)
+	}
+	if request.PlayedAt != nil {
+		play.PlayedAt = request.PlayedAt.UTC()
+	}
+	if play.PlayedAt.After(time.Now().Add(time.Minute)) {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "played_at", Code: "future", Message: "can not be in the future"})
+	}
+
+	play.Counted = play.Duration >= minPlaySeconds || (track.Duration > 0 && play.Duration >= minPlayShare*track.Duration)
+	if play.Counted {
+		if cache.RCache == nil {
+			s.counting.Lock()
+			defer s.counting.Unlock()
+		}
+		counted, err := claimPlay(ctx, play)
+		if err != nil {
+			return nil, err
+		}
+		play.Counted = counted
+	}
+
+	if err := repository.PlayRepo.PostPlay(ctx, *play); err != nil {
+		if play.Counted {
+			releasePlay(ctx, play)
+		}
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	if play.Counted {
+		if err := countPlay(ctx, trackUuid); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+		if cache.RCache != nil {
+			recordChartPlay(ctx, track, play.PlayedAt)
+		}
+	}
+	return play, nil
+}
+
+func (s *Play) GetPlays(ctx context.Context, filter model.PlayFilter) (*[]model.Play, error) {
+	plays, err := repository.PlayRepo.GetPlays(ctx, filter)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	return plays, nil
+}
+
+// GetPlayCount returns the stored play count of the track plus the count not yet flushed
+func (s *Play) GetPlayCount(ctx context.Context, trackUuid string) (*model.TrackPlayCount, error) {
+	if _, err := repository.TrackRepo.GetTrackById(ctx, trackUuid); err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	counts, err := repository.PlayRepo.GetPlayCounts(ctx, []string{trackUuid})
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	playCount := &model.TrackPlayCount{TrackID: trackUuid, Count: counts[trackUuid]}
+	if cache.RCache != nil {
+		pending, err := cache.RCache.Get(ctx, playCountKeyPrefix+trackUuid)
+		if err != nil {
+			log.WithContext(ctx).Error(err)
+		} else if count, err := strconv.ParseInt(pending, 10, 64); err == nil {
+			playCount.Count += count
+		}
+	}
+	return playCount, nil
+}
+
+func (s *Play) FlushPlayCounts(ctx context.Context) error {
+	if cache.RCache == nil {
+		return nil
+	}
+	for {
+		// a track popped here and played again before its counter is taken is pending
+		// again, so its next play is flushed in the next round
+		trackIds, err := cache.RCache.SPOPN(ctx, pendingPlaysKey, playCountFlushBatch)
+		if err != nil {
+			return err
+		} else if len(trackIds) == 0 {
+			return nil
+		}
+		counts := map[string]int64{}
+		for _, trackId := range trackIds {
+			value, err := cache.RCache.GetDel(ctx, playCountKeyPrefix+trackId)
+			if err != nil {
+				restorePlayCounts(ctx, trackIds, counts)
+				return err
+			}
+			if count, err := strconv.ParseInt(value, 10, 64); err == nil && count > 0 {
+				counts[trackId] = count
+			}
+		}
+		if failed, err := repository.PlayRepo.IncrPlayCounts(ctx, counts); err != nil {
+			// only the counts which were not added go back, so a retry does not add any twice
+			failedIds := make([]string, 0, len(failed))
+			for trackId := range failed {
+				failedIds = append(failedIds, trackId)
+			}
+			restorePlayCounts(ctx, failedIds, failed)
+			return err
+		}
+	}
+}
+
+// restorePlayCounts puts the counts taken by a failed flush back into redis, on top
+// of the plays counted meanwhile, and marks their tracks pending again
+func restorePlayCounts(ctx context.Context, trackIds []string, counts map[string]int64) {
+	for trackId, count := range counts {
+		if err := cache.RCache.IncrBy(ctx, playCountKeyPrefix+trackId, count); err != nil {
+			log.WithContext(ctx).Errorf("restore play count of track %s (%d) failed: %v", trackId, count, err)
+		}
+	}
+	if len(trackIds) == 0 {
+		return
+	}
+	if err := cache.RCache.SADDRaw(ctx, pendingPlaysKey, trackIds...); err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+}
+
+// RunPlayCountFlusher flushes the play counts every interval until ctx is done, and
+// once more then
+func RunPlayCountFlusher(ctx context.Context, plays IPlayService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// the counts collected since the last tick would wait for the next process
+			flushCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			defer cancel()
+			if err := plays.FlushPlayCounts(flushCtx); err != nil {
+				log.Errorf("final flush of play counts failed: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := plays.FlushPlayCounts(ctx); err != nil {
+				log.Errorf("flush play counts failed: %v", err)
+			}
+		}
+	}
+}
+
+// claimPlay tells whether play is the only one of its track by its user at the time,
+// a track can not be listened to twice at the same time. Concurrent plays claim the
+// track in redis for the duration of the play, earlier plays are looked up.
+func claimPlay(ctx context.Context, play *model.Play) (bool, error) {
+	if cache.RCache != nil {
+		claimed, err := cache.RCache.SetNX(ctx, playingKey(play), play.ID, max(seconds(play.Duration), time.Second))
+		if err != nil {
+			return false, apperror.Internal(err)
+		} else if !claimed {
+			return false, nil
+		}
+	}
+	last, err := repository.PlayRepo.GetLastCountedPlay(ctx, play.UserID, play.TrackID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		releasePlay(ctx, play)
+		return false, apperror.Internal(err)
+	}
+	if last != nil && last.PlayedAt.Add(seconds(last.Duration)).After(play.PlayedAt) &&
+		play.PlayedAt.Add(seconds(play.Duration)).After(last.PlayedAt) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// releasePlay gives up the claim of a play which was not stored
+func releasePlay(ctx context.Context, play *model.Play) {
+	if cache.RCache == nil {
+		return
+	}
+	if err := cache.RCache.Del(ctx, playingKey(play)); err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+}
+
+func playingKey(play *model.Play) string {
+	return playingKeyPrefix + play.UserID + ":" + play.TrackID
+}
+
+// countPlay adds a counted play to the redis counter of the track, or straight to
+// the database when redis is disabled
+func countPlay(ctx context.Context, trackUuid string) error {
+	if cache.RCache == nil {
+		_, err := repository.PlayRepo.IncrPlayCounts(ctx, map[string]int64{trackUuid: 1})
+		return err
+	}
+	if err := cache.RCache.Incr(ctx, playCountKeyPrefix+trackUuid); err != nil {
+		return err
+	}
+	return cache.RCache.SADDRaw(ctx, pendingPlaysKey, trackUuid)
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -2,21 +2,38 @@ package service
 
 import (
 	"context"
+	"io"
+	"reflect"
+	"sample/common/apperror"
+	"sample/common/artwork"
 	"sample/common/model"
-	"sample/common/response"
 	"sample/repository"
 
-	"sample/common/log"
-
 	"github.com/google/uuid"
 )
 
 type IPlaylistService interface {
-	GetPlaylists(ctx context.Context, filter model.PlaylistFilter) (int, any)
-	GetPlaylistById(ctx context.Context, playlistUuid string) (int, any)
-	PostPlaylist(ctx context.Context, playlistRequest model.PlaylistRequest) (int, any)
-	DeletePlaylistById(ctx context.Context, playlistUuid string) (int, any)
-	PutPlaylistById(ctx context.Context, playlistUuid string, playlistRequest model.PlaylistRequest) (int, any)
+	GetPlaylists(ctx context.Context, filter model.PlaylistFilter) (*[]model.Playlist, error)
+	GetPlaylistById(ctx context.Context, playlistUuid string) (*model.Playlist, error)
+	GetPlaylistDetail(ctx context.Context, playlistUuid string, expand model.PlaylistExpand) (*model.PlaylistDetail, error)
+	PostPlaylist(ctx context.Context, playlistRequest model.PlaylistRequest) (*model.Playlist, error)
+	// writes take the version the client last read, see repository.IPlaylist
+	DeletePlaylistById(ctx context.Context, playlistUuid string, version int64) error
+	PutPlaylistById(ctx context.Context, playlistUuid string, version int64, playlistRequest model.PlaylistRequest) (*model.Playlist, error)
+	PatchPlaylistById(ctx context.Context, playlistUuid string, version int64, patch model.Patch) (*model.Playlist, error)
+
+	AddPlaylistTracks(ctx context.Context, playlistUuid string, version int64, request model.PlaylistTracksRequest) (*model.Playlist, error)
+	RemovePlaylistTrack(ctx context.Context, playlistUuid string, version int64, trackId string) (*model.Playlist, error)
+	RemovePlaylistTrackAt(ctx context.Context, playlistUuid string, version int64, index int) (*model.Playlist, error)
+	MovePlaylistTracks(ctx context.Context, playlistUuid string, version int64, request model.PlaylistMoveRequest) (*model.Playlist, error)
+	SetPlaylistTrackPriority(ctx context.Context, playlistUuid string, version int64, index int, priority int) (*model.Playlist, error)
+
+	ExportPlaylist(ctx context.Context, playlistUuid string) (*model.PlaylistDocument, error)
+	ImportPlaylist(ctx context.Context, doc model.PlaylistDocument) (*model.PlaylistImportReport, error)
+
+	// GetPlaylistCover returns the cover of the playlist in format, a mosaic of its tracks when it has none
+	GetPlaylistCover(ctx context.Context, playlistUuid string, size int, format artwork.Format) (*CoverFile, error)
+	PutPlaylistCover(ctx context.Context, playlistUuid string, version int64, image io.Reader) (*model.Playlist, error)
 }
 
 type Playlist struct {
@@ -26,82 +43,156 @@ func NewPlaylist() IPlaylistService {
 	return &Playlist{}
 }
 
-func (s *Playlist) GetPlaylists(ctx context.Context, filter model.PlaylistFilter) (int, any) {
-	tracks, err := repository.PlaylistRepo.GetPlaylists(ctx, filter)
+func (s *Playlist) GetPlaylists(ctx context.Context, filter model.PlaylistFilter) (*[]model.Playlist, error) {
+	playlists, err := repository.PlaylistRepo.GetPlaylists(ctx, filter)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, apperror.Internal(err)
 	}
-	return response.OK(tracks)
+	for i := range *playlists {
+		if err := resolveSmartTracks(ctx, &(*playlists)[i]); err != nil {
+			return nil, err
+		}
+	}
+	return playlists, nil
 }
 
-func (s *Playlist) PostPlaylist(ctx context.Context, playlistRequest model.PlaylistRequest) (int, any) {
+func (s *Playlist) PostPlaylist(ctx context.Context, playlistRequest model.PlaylistRequest) (*model.Playlist, error) {
 	// default value playback mode and update if playlist request set playback mode
 	playbackMode := "priority"
 	if len(playlistRequest.PlaybackMode) > 0 {
 		playbackMode = playlistRequest.PlaybackMode
 	}
-	playlist := model.Playlist{
+	playlist := &model.Playlist{
 		ID:           uuid.NewString(),
 		Name:         playlistRequest.Name,
 		TrackIds:     playlistRequest.TrackIds,
 		PlaybackMode: playbackMode,
+		Smart:        playlistRequest.Smart,
+		Version:      1,
 	}
-	err := repository.PlaylistRepo.PostPlaylist(ctx, playlist)
+	err := repository.PlaylistRepo.PostPlaylist(ctx, *playlist)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, repositoryError(err, errPlaylistNotFound)
+	}
+	if err := resolveSmartTracks(ctx, playlist); err != nil {
+		return nil, err
 	}
-	return response.OK(playlist)
+	return playlist, nil
 }
 
-func (s *Playlist) GetPlaylistById(ctx context.Context, playlistUuid string) (int, any) {
+func (s *Playlist) GetPlaylistById(ctx context.Context, playlistUuid string) (*model.Playlist, error) {
 	playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, repositoryError(err, errPlaylistNotFound)
 	}
-	return response.OK(playlist)
+	if err := resolveSmartTracks(ctx, playlist); err != nil {
+		return nil, err
+	}
+	return playlist, nil
 }
 
-func (s *Playlist) DeletePlaylistById(ctx context.Context, playlistUuid string) (int, any) {
+func (s *Playlist) DeletePlaylistById(ctx context.Context, playlistUuid string, version int64) error {
 	// check exits playlist id
-	if _, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid); err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+	playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return repositoryError(err, errPlaylistNotFound)
+	} else if playlist.Version != version {
+		return errVersionMismatch
 	}
 
-	err := repository.PlaylistRepo.DeletePlaylistById(ctx, playlistUuid)
+	err = repository.PlaylistRepo.DeletePlaylistById(ctx, playlistUuid, version)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return repositoryError(err, errPlaylistNotFound)
 	}
-	return response.OK(map[string]interface{}{
-		"delete success playlist id": playlistUuid,
-	})
+	return nil
 }
 
-func (s *Playlist) PutPlaylistById(ctx context.Context, playlistUuid string, playlistRequest model.PlaylistRequest) (int, any) {
+func (s *Playlist) PutPlaylistById(ctx context.Context, playlistUuid string, version int64, playlistRequest model.PlaylistRequest) (*model.Playlist, error) {
 	// check exits playlist id
-	if _, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid); err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+	playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return nil, repositoryError(err, errPlaylistNotFound)
+	} else if playlist.Version != version {
+		return nil, errVersionMismatch
 	}
 
-	playlistUpdate := model.Playlist{
+	playlistUpdate := &model.Playlist{
 		ID:           playlistUuid,
 		Name:         playlistRequest.Name,
 		TrackIds:     playlistRequest.TrackIds,
 		PlaybackMode: playlistRequest.PlaybackMode,
+		Smart:        playlistRequest.Smart,
+		Cover:        playlist.Cover,
+		Likes:        playlist.Likes,
+		Version:      version + 1,
+	}
+
+	err = repository.PlaylistRepo.PutPlaylistById(ctx, playlistUuid, version, *playlistUpdate)
+	if err != nil {
+		return nil, repositoryError(err, errPlaylistNotFound)
+	}
+	if err := resolveSmartTracks(ctx, playlistUpdate); err != nil {
+		return nil, err
 	}
+	return playlistUpdate, nil
+}
 
-	err := repository.PlaylistRepo.PutPlaylistById(ctx, playlistUuid, playlistUpdate)
+func (s *Playlist) PatchPlaylistById(ctx context.Context, playlistUuid string, version int64, patch model.Patch) (*model.Playlist, error) {
+	playlist, err := repository.PlaylistRepo.GetPlaylistById(ctx, playlistUuid)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, repositoryError(err, errPlaylistNotFound)
+	} else if playlist.Version != version {
+		return nil, errVersionMismatch
+	}
+
+	current := playlistPatchDocument{
+		Name:         playlist.Name,
+		TrackIds:     playlist.TrackIds,
+		PlaybackMode: playlist.PlaybackMode,
+		Smart:        playlist.Smart,
+	}
+	patched := playlistPatchDocument{}
+	if err := applyPatch(current, patch, &patched); err != nil {
+		return nil, err
+	}
+	playlistRequest := model.PlaylistRequest{
+		Name:         patched.Name,
+		TrackIds:     patched.TrackIds,
+		PlaybackMode: patched.PlaybackMode,
+		Smart:        patched.Smart,
+	}
+	if err := playlistRequest.Validate(); err != nil {
+		return nil, err
 	}
 
-	return response.OK(map[string]interface{}{
-		"update success playlist id": playlistUuid,
-	})
+	// only the fields changed by the patch are written
+	fields := map[string]any{}
+	if patched.Name != current.Name {
+		fields["name"] = patched.Name
+		playlist.Name = patched.Name
+	}
+	if !reflect.DeepEqual(patched.TrackIds, current.TrackIds) {
+		fields["track_ids"] = patched.TrackIds
+		playlist.TrackIds = patched.TrackIds
+	}
+	if patched.PlaybackMode != current.PlaybackMode {
+		fields["playback_mode"] = patched.PlaybackMode
+		playlist.PlaybackMode = patched.PlaybackMode
+	}
+	if !reflect.DeepEqual(patched.Smart, current.Smart) {
+		fields["smart"] = patched.Smart
+		playlist.Smart = patched.Smart
+	}
+	if len(fields) == 0 {
+		return playlist, resolveSmartTracks(ctx, playlist)
+	}
+
+	if err := repository.PlaylistRepo.PatchPlaylistById(ctx, playlistUuid, version, fields); err != nil {
+		return nil, repositoryError(err, errPlaylistNotFound)
+	}
+	playlist.Version = version + 1
+	if err := resolveSmartTracks(ctx, playlist); err != nil {
+		return nil, err
+	}
+	return playlist, nil
 }
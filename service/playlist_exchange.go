@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"path"
+	"sample/common/apperror"
+	"sample/common/model"
+	"sample/common/util"
+	"sample/repository"
+	"strings"
+)
+
+const (
+	// fuzzyMatchThreshold is the lowest similarity accepted for a fuzzy title match
+	fuzzyMatchThreshold = 0.8
+	// maxFuzzyCandidates bounds the tracks an entry without artist is compared with
+	maxFuzzyCandidates = 1000
+)
+
+// ExportPlaylist returns the tracks of the playlist in playlist order, tracks which
+// no longer exist are skipped. Locations are left to the caller.
+func (s *Playlist) ExportPlaylist(ctx context.Context, playlistUuid string) (*model.PlaylistDocument, error) {
+	playlist, err := s.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := playlistTracks(ctx, playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &model.PlaylistDocument{Name: playlist.Name, Tracks: []model.PlaylistEntry{}}
+	for _, track := range tracks {
+		doc.Tracks = append(doc.Tracks, model.PlaylistEntry{
+			TrackID:  track.ID,
+			Location: track.MP3File,
+			Title:    track.Title,
+			Artist:   track.Artist,
+			Album:    track.Album,
+			Duration: track.Duration,
+		})
+	}
+	return doc, nil
+}
+
+// ImportPlaylist creates a playlist from the entries of doc which match a track
+// of the catalog, and reports the entries which did not match
+func (s *Playlist) ImportPlaylist(ctx context.Context, doc model.PlaylistDocument) (*model.PlaylistImportReport, error) {
+	if len(strings.TrimSpace(doc.Name)) == 0 {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "name", Code: "required", Message: "is required"})
+	}
+	tracks, err := repository.TrackRepo.GetTracks(ctx, model.TrackFilter{})
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	matcher := newTrackMatcher(*tracks)
+
+	report := &model.PlaylistImportReport{
+		Matched:   []model.PlaylistImportMatch{},
+		Unmatched: []model.PlaylistEntry{},
+	}
+	trackIds := []model.TrackIds{}
+	for _, entry := range doc.Tracks {
+		track, matchedBy, score := matcher.match(entry)
+		if track == nil {
+			report.Unmatched = append(report.Unmatched, entry)
+			continue
+		}
+		report.Matched = append(report.Matched, model.PlaylistImportMatch{
+			Entry:     entry,
+			TrackID:   track.ID,
+			MatchedBy: matchedBy,
+			Score:     score,
+		})
+		trackIds = append(trackIds, model.TrackIds{TrackID: track.ID})
+	}
+
+	playlist, err := s.PostPlaylist(ctx, model.PlaylistRequest{Name: doc.Name, TrackIds: trackIds})
+	if err != nil {
+		return nil, err
+	}
+	report.Playlist = playlist
+	return report, nil
+}
+
+type trackMatcher struct {
+	tracks   []model.Track
+	byId     map[string]*model.Track
+	byFile   map[string][]*model.Track
+	byTitle  map[string][]*model.Track // by normalized title
+	byArtist map[string][]*model.Track // by normalized artist
+}
+
+func newTrackMatcher(tracks []model.Track) *trackMatcher {
+	m := &trackMatcher{
+		tracks:   tracks,
+		byId:     map[string]*model.Track{},
+		byFile:   map[string][]*model.Track{},
+		byTitle:  map[string][]*model.Track{},
+		byArtist: map[string][]*model.Track{},
+	}
+	for i := range tracks {
+		track := &tracks[i]
+		m.byId[track.ID] = track
+		file := strings.ToLower(track.MP3File)
+		m.byFile[file] = append(m.byFile[file], track)
+		title, artist := util.NormalizeText(track.Title), util.NormalizeText(track.Artist)
+		m.byTitle[title] = append(m.byTitle[title], track)
+		m.byArtist[artist] = append(m.byArtist[artist], track)
+	}
+	return m
+}
+
+// match finds the track of an entry by track id, by the id or the file name in its
+// location, by exact title and artist and finally by fuzzy title and artist
+func (m *trackMatcher) match(entry model.PlaylistEntry) (*model.Track, string, float64) {
+	if track, ok := m.byId[entry.TrackID]; ok {
+		return track, "id", 1
+	}
+
+	location := strings.ReplaceAll(entry.Location, `\`, "/")
+	for _, segment := range strings.Split(location, "/") {
+		if track, ok := m.byId[segment]; ok {
+			return track, "id", 1
+		}
+	}
+
+	title, artist := entry.Title, entry.Artist
+	if len(location) > 0 {
+		base := path.Base(location)
+		if track := bestTitleMatch(m.byFile[strings.ToLower(base)], title, artist); track != nil {
+			return track, "path", 1
+		}
+		if len(title) == 0 {
+			// "Artist - Title.mp3"
+			name := strings.TrimSuffix(base, path.Ext(base))
+			if fileArtist, fileTitle, ok := strings.Cut(name, " - "); ok {
+				artist, title = fileArtist, fileTitle
+			} else {
+				title = name
+			}
+		}
+	}
+	if len(util.NormalizeText(title)) == 0 {
+		return nil, "", 0
+	}
+
+	track := bestTitleMatch(m.candidates(title, artist), title, artist)
+	if track == nil {
+		return nil, "", 0
+	}
+	score := titleScore(track, title, artist)
+	if score == 1 {
+		return track, "title", 1
+	} else if score >= fuzzyMatchThreshold {
+		return track, "fuzzy", score
+	}
+	return nil, "", 0
+}
+
+// candidates narrows the catalog down to the tracks worth a fuzzy comparison: the ones
+// with the same title and, when the artist is known, the ones by that artist or by no
+// artist. Otherwise the titles are compared whose length allows a match.
+func (m *trackMatcher) candidates(title, artist string) []*model.Track {
+	title, artist = util.NormalizeText(title), util.NormalizeText(artist)
+	candidates := append([]*model.Track{}, m.byTitle[title]...)
+	if len(artist) > 0 {
+		candidates = append(candidates, m.byArtist[artist]...)
+		return append(candidates, m.byArtist[""]...)
+	}
+	length := len([]rune(title))
+	for i := range m.tracks {
+		if len(candidates) >= maxFuzzyCandidates {
+			break
+		}
+		// the distance is at least the length difference
+		other := len([]rune(util.NormalizeText(m.tracks[i].Title)))
+		if float64(abs(length-other)) <= (1-fuzzyMatchThreshold)*float64(max(length, other)) {
+			candidates = append(candidates, &m.tracks[i])
+		}
+	}
+	return candidates
+}
+
+// bestTitleMatch returns the candidate most alike title and artist, nil without candidates
+func bestTitleMatch(candidates []*model.Track, title, artist string) *model.Track {
+	var best *model.Track
+	bestScore := -1.0
+	for _, track := range candidates {
+		if score := titleScore(track, title, artist); score > bestScore {
+			best, bestScore = track, score
+		}
+	}
+	return best
+}
+
+// titleScore weights the title over the artist, the artist only counts when both are known
+func titleScore(track *model.Track, title, artist string) float64 {
+	score := util.Similarity(util.NormalizeText(track.Title), util.NormalizeText(title))
+	if len(artist) > 0 && len(track.Artist) > 0 {
+		artistScore := util.Similarity(util.NormalizeText(track.Artist), util.NormalizeText(artist))
+		score = 0.7*score + 0.3*artistScore
+	}
+	return score
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"sample/common/model"
+	"testing"
+)
+
+func TestTrackMatcher(t *testing.T) {
+	catalog := []model.Track{
+		{ID: "8b1a9953-c461-4e1b-9c3e-2c8a8b7c1d01", Title: "Bohemian Rhapsody", Artist: "Queen", MP3File: "Bohemian_Rhapsody.mp3"},
+		{ID: "8b1a9953-c461-4e1b-9c3e-2c8a8b7c1d02", Title: "Around the World", Artist: "Daft Punk", MP3File: "around.mp3"},
+		{ID: "8b1a9953-c461-4e1b-9c3e-2c8a8b7c1d03", Title: "Around the World", Artist: "Red Hot Chili Peppers", MP3File: "around.mp3"},
+		{ID: "8b1a9953-c461-4e1b-9c3e-2c8a8b7c1d04", Title: "Intro", MP3File: "intro.mp3"},
+	}
+	tests := []struct {
+		name      string
+		entry     model.PlaylistEntry
+		wantTrack string
+		wantBy    string
+	}{
+		{
+			name:      "track id",
+			entry:     model.PlaylistEntry{TrackID: catalog[1].ID, Title: "something else"},
+			wantTrack: catalog[1].ID,
+			wantBy:    "id",
+		},
+		{
+			name:      "track id in the location",
+			entry:     model.PlaylistEntry{Location: "http://music.example.com/v1/track/" + catalog[0].ID + "/stream"},
+			wantTrack: catalog[0].ID,
+			wantBy:    "id",
+		},
+		{
+			name:      "file name",
+			entry:     model.PlaylistEntry{Location: `C:\Music\BOHEMIAN_RHAPSODY.mp3`},
+			wantTrack: catalog[0].ID,
+			wantBy:    "path",
+		},
+		{
+			name:      "file name shared by two tracks",
+			entry:     model.PlaylistEntry{Location: "/music/around.mp3", Title: "Around the World", Artist: "Red Hot Chili Peppers"},
+			wantTrack: catalog[2].ID,
+			wantBy:    "path",
+		},
+		{
+			name:      "exact title and artist",
+			entry:     model.PlaylistEntry{Title: "around the world!", Artist: "DAFT PUNK"},
+			wantTrack: catalog[1].ID,
+			wantBy:    "title",
+		},
+		{
+			name:      "title without artist",
+			entry:     model.PlaylistEntry{Title: "Intro"},
+			wantTrack: catalog[3].ID,
+			wantBy:    "title",
+		},
+		{
+			name:      "misspelled title",
+			entry:     model.PlaylistEntry{Title: "Bohemian Rapsody", Artist: "Queen"},
+			wantTrack: catalog[0].ID,
+			wantBy:    "fuzzy",
+		},
+		{
+			name:      "misspelled title without artist",
+			entry:     model.PlaylistEntry{Title: "Bohemain Rhapsody"},
+			wantTrack: catalog[0].ID,
+			wantBy:    "fuzzy",
+		},
+		{
+			name:      "artist and title from an unknown file name",
+			entry:     model.PlaylistEntry{Location: "/other/Queen - Bohemian Rhapsody.mp3"},
+			wantTrack: catalog[0].ID,
+			wantBy:    "title",
+		},
+		{
+			name:  "different title",
+			entry: model.PlaylistEntry{Title: "Another One Bites the Dust", Artist: "Queen"},
+		},
+		{
+			name:  "no title",
+			entry: model.PlaylistEntry{Location: "/other/---.mp3"},
+		},
+	}
+	matcher := newTrackMatcher(catalog)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track, matchedBy, score := matcher.match(tt.entry)
+			if len(tt.wantTrack) == 0 {
+				if track != nil {
+					t.Fatalf("match() = %s by %s, want no match", track.ID, matchedBy)
+				}
+				return
+			}
+			if track == nil {
+				t.Fatalf("match() = no match, want %s by %s", tt.wantTrack, tt.wantBy)
+			}
+			if track.ID != tt.wantTrack || matchedBy != tt.wantBy {
+				t.Errorf("match() = %s by %s, want %s by %s", track.ID, matchedBy, tt.wantTrack, tt.wantBy)
+			}
+			if score < fuzzyMatchThreshold || score > 1 {
+				t.Errorf("match() score = %v, want between %v and 1", score, fuzzyMatchThreshold)
+			}
+		})
+	}
+}
+
+func TestTrackMatcherEmptyCatalog(t *testing.T) {
+	entries := []model.PlaylistEntry{
+		{TrackID: "8b1a9953-c461-4e1b-9c3e-2c8a8b7c1d01"},
+		{Location: "/music/song.mp3"},
+		{Location: "/music/Artist - Song.mp3"},
+		{Title: "Song", Artist: "Artist"},
+		{Title: "Song"},
+		{},
+	}
+	for _, catalog := range [][]model.Track{nil, {}} {
+		matcher := newTrackMatcher(catalog)
+		for _, entry := range entries {
+			if track, matchedBy, _ := matcher.match(entry); track != nil {
+				t.Errorf("match(%+v) = %s by %s, want no match", entry, track.ID, matchedBy)
+			}
+		}
+	}
+}
+
+func TestBestTitleMatch(t *testing.T) {
+	tracks := []model.Track{
+		{ID: "1", Title: "Yesterday", Artist: "The Beatles"},
+		{ID: "2", Title: "Yesterday", Artist: "Boyz II Men"},
+	}
+	tests := []struct {
+		name       string
+		candidates []*model.Track
+		title      string
+		artist     string
+		want       string
+	}{
+		{name: "no candidates", candidates: nil, title: "Yesterday"},
+		{name: "one candidate", candidates: []*model.Track{&tracks[1]}, title: "Tomorrow", want: "2"},
+		{name: "artist decides", candidates: []*model.Track{&tracks[0], &tracks[1]}, title: "Yesterday", artist: "Boyz 2 Men", want: "2"},
+		{name: "first of equals", candidates: []*model.Track{&tracks[0], &tracks[1]}, title: "Yesterday", want: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bestTitleMatch(tt.candidates, tt.title, tt.artist)
+			if len(tt.want) == 0 {
+				if got != nil {
+					t.Errorf("bestTitleMatch() = %s, want nil", got.ID)
+				}
+			} else if got == nil || got.ID != tt.want {
+				t.Errorf("bestTitleMatch() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sample/common/apperror"
+	"sample/common/model"
+	"sample/repository"
+)
+
+// Item operations change single entries of a playlist atomically, so concurrent
+// edits of other entries are kept. They are refused on smart playlists, whose
+// entries are computed from rules.
+
+func (s *Playlist) AddPlaylistTracks(ctx context.Context, playlistUuid string, version int64, request model.PlaylistTracksRequest) (*model.Playlist, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	for _, trackId := range request.TrackIds {
+		if len(trackId.TrackID) == 0 {
+			return nil, apperror.FieldValidation(apperror.FieldError{Field: "track_ids.track_id", Code: "required", Message: "is required"})
+		}
+	}
+	if request.Position != nil && *request.Position < 0 {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "position", Code: "min", Message: "is less than the minimum"})
+	}
+	playlist, err := repository.PlaylistRepo.InsertPlaylistTracks(ctx, playlistUuid, version, request.TrackIds, request.Position)
+	if err != nil {
+		return nil, itemError(err)
+	}
+	return playlist, nil
+}
+
+func (s *Playlist) RemovePlaylistTrack(ctx context.Context, playlistUuid string, version int64, trackId string) (*model.Playlist, error) {
+	playlist, err := repository.PlaylistRepo.RemovePlaylistTrack(ctx, playlistUuid, version, trackId)
+	if err != nil {
+		return nil, itemError(err)
+	}
+	return playlist, nil
+}
+
+func (s *Playlist) RemovePlaylistTrackAt(ctx context.Context, playlistUuid string, version int64, index int) (*model.Playlist, error) {
+	if index < 0 {
+		return nil, errEntryNotFound
+	}
+	playlist, err := repository.PlaylistRepo.RemovePlaylistTrackAt(ctx, playlistUuid, version, index)
+	if err != nil {
+		return nil, itemError(err)
+	}
+	return playlist, nil
+}
+
+func (s *Playlist) MovePlaylistTracks(ctx context.Context, playlistUuid string, version int64, request model.PlaylistMoveRequest) (*model.Playlist, error) {
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	playlist, err := repository.PlaylistRepo.MovePlaylistTracks(ctx, playlistUuid, version, request.From, request.Count, request.To)
+	if err != nil {
+		return nil, itemError(err)
+	}
+	return playlist, nil
+}
+
+func (s *Playlist) SetPlaylistTrackPriority(ctx context.Context, playlistUuid string, version int64, index int, priority int) (*model.Playlist, error) {
+	if index < 0 {
+		return nil, errEntryNotFound
+	}
+	playlist, err := repository.PlaylistRepo.SetPlaylistTrackPriority(ctx, playlistUuid, version, index, priority)
+	if err != nil {
+		return nil, itemError(err)
+	}
+	return playlist, nil
+}
+
+// itemError maps the errors of item operations, which refuse smart playlists
+func itemError(err error) error {
+	if errors.Is(err, repository.ErrItemsReadOnly) {
+		return errSmartPlaylist.Wrap(err)
+	}
+	return repositoryError(err, errPlaylistNotFound)
+}
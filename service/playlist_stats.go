@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"sort"
+	"time"
+)
+
+const (
+	playlistStatsTTL = 10 * time.Minute
+	topArtistsCount  = 5
+	unknownGenre     = "unknown"
+)
+
+// GetPlaylistDetail returns the playlist with its tracks and statistics expanded,
+// the tracks are read in one batch
+func (s *Playlist) GetPlaylistDetail(ctx context.Context, playlistUuid string, expand model.PlaylistExpand) (*model.PlaylistDetail, error) {
+	playlist, err := s.GetPlaylistById(ctx, playlistUuid)
+	if err != nil {
+		return nil, err
+	}
+	detail := &model.PlaylistDetail{Playlist: *playlist}
+	if !expand.Tracks && !expand.Stats {
+		return detail, nil
+	}
+
+	statsKey := ""
+	if expand.Stats && !expand.Tracks {
+		statsKey = playlistStatsKey(ctx, playlist)
+		if stats := cachedPlaylistStats(ctx, statsKey); stats != nil {
+			detail.Stats = stats
+			return detail, nil
+		}
+	}
+
+	tracks, err := playlistTracks(ctx, playlist)
+	if err != nil {
+		return nil, err
+	}
+	if expand.Tracks {
+		detail.Tracks = tracks
+	}
+	if expand.Stats {
+		detail.Stats = playlistStats(tracks)
+		if len(statsKey) == 0 {
+			statsKey = playlistStatsKey(ctx, playlist)
+		}
+		if len(statsKey) > 0 {
+			if err := cache.RCache.SetTTL(ctx, statsKey, detail.Stats, playlistStatsTTL); err != nil {
+				log.WithContext(ctx).Error(err)
+			}
+		}
+	}
+	return detail, nil
+}
+
+// playlistTracks returns the tracks of the playlist in playlist order
+func playlistTracks(ctx context.Context, playlist *model.Playlist) ([]model.Track, error) {
+	trackUuids := make([]string, 0, len(playlist.TrackIds))
+	for _, trackId := range playlist.TrackIds {
+		trackUuids = append(trackUuids, trackId.TrackID)
+	}
+	found, err := repository.TrackRepo.GetTracksByIds(ctx, trackUuids)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	byId := make(map[string]model.Track, len(*found))
+	for _, track := range *found {
+		byId[track.ID] = track
+	}
+	tracks := make([]model.Track, 0, len(playlist.TrackIds))
+	for _, trackId := range playlist.TrackIds {
+		if track, ok := byId[trackId.TrackID]; ok {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks, nil
+}
+
+func playlistStats(tracks []model.Track) *model.PlaylistStats {
+	stats := &model.PlaylistStats{
+		TrackCount: len(tracks),
+		Genres:     []model.GenreStats{},
+		TopArtists: []model.ArtistStats{},
+	}
+	genres := map[string]*model.GenreStats{}
+	artists := map[string]*model.ArtistStats{}
+	for _, track := range tracks {
+		stats.TotalDuration += track.Duration
+
+		genre := track.Genre
+		if len(genre) == 0 {
+			genre = unknownGenre
+		}
+		if _, ok := genres[genre]; !ok {
+			genres[genre] = &model.GenreStats{Genre: genre}
+		}
+		genres[genre].TrackCount++
+		genres[genre].Duration += track.Duration
+
+		if len(track.Artist) > 0 {
+			if _, ok := artists[track.Artist]; !ok {
+				artists[track.Artist] = &model.ArtistStats{Artist: track.Artist}
+			}
+			artists[track.Artist].TrackCount++
+			artists[track.Artist].Duration += track.Duration
+		}
+	}
+
+	for _, genre := range genres {
+		genre.Share = float64(genre.TrackCount) / float64(len(tracks))
+		stats.Genres = append(stats.Genres, *genre)
+	}
+	sort.Slice(stats.Genres, func(i, j int) bool {
+		if stats.Genres[i].TrackCount != stats.Genres[j].TrackCount {
+			return stats.Genres[i].TrackCount > stats.Genres[j].TrackCount
+		}
+		return stats.Genres[i].Genre < stats.Genres[j].Genre
+	})
+
+	for _, artist := range artists {
+		stats.TopArtists = append(stats.TopArtists, *artist)
+	}
+	sort.Slice(stats.TopArtists, func(i, j int) bool {
+		if stats.TopArtists[i].TrackCount != stats.TopArtists[j].TrackCount {
+			return stats.TopArtists[i].TrackCount > stats.TopArtists[j].TrackCount
+		}
+		return stats.TopArtists[i].Artist < stats.TopArtists[j].Artist
+	})
+	if len(stats.TopArtists) > topArtistsCount {
+		stats.TopArtists = stats.TopArtists[:topArtistsCount]
+	}
+	return stats
+}
+
+// playlistStatsKey returns the cache key of the stats of the playlist version under
+// the current track generation, or an empty string when stats are not cached
+func playlistStatsKey(ctx context.Context, playlist *model.Playlist) string {
+	if cache.RCache == nil {
+		return ""
+	}
+	generation, err := sharedTrackGeneration(ctx)
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return ""
+	}
+	return fmt.Sprintf("playlist_stats:%s:%d:%s", playlist.ID, playlist.Version, generation)
+}
+
+func cachedPlaylistStats(ctx context.Context, key string) *model.PlaylistStats {
+	if len(key) == 0 {
+		return nil
+	}
+	value, err := cache.RCache.Get(ctx, key)
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return nil
+	} else if len(value) == 0 {
+		return nil
+	}
+	stats := new(model.PlaylistStats)
+	if err := json.Unmarshal([]byte(value), stats); err != nil {
+		log.WithContext(ctx).Error(err)
+		return nil
+	}
+	return stats
+}
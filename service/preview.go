@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sample/common/apperror"
+	"sample/common/audio"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/common/transcode"
+	"sample/repository"
+)
+
+const (
+	defaultPreviewLength = 30.0
+	maxPreviewLength     = 120.0
+	previewFade          = 2.0
+)
+
+// fadedMP3Preview is the rendition mp3 previews are re-encoded in to fade
+var fadedMP3Preview = transcode.Rendition{Format: transcode.MP3, Bitrate: 128}
+
+var errPreviewFadeUnavailable = apperror.NotFound(apperror.CodeRenditionUnavailable, "the preview can not be faded for the audio format of this track")
+
+// PreviewFile is an open preview of a track, the caller closes it
+type PreviewFile struct {
+	*os.File
+	Track       *model.Track
+	ContentType string
+	Extension   string
+	Start       float64
+	Length      float64
+}
+
+func previewDir(track *model.Track) string {
+	return filepath.Join(filepath.Dir(AudioPath(track)), "previews")
+}
+
+// previewPath names the preview after the audio it was cut from and its excerpt in milliseconds
+func previewPath(track *model.Track, start, length float64, fade bool, extension string) string {
+	name := fmt.Sprintf("%s_%d_%d", audioKey(track), int64(start*1000), int64(length*1000))
+	if fade {
+		name += "_fade"
+	}
+	return filepath.Join(previewDir(track), name+"."+extension)
+}
+
+// removePreviews drops the previews cut from replaced audio, a failure is logged
+func removePreviews(ctx context.Context, track *model.Track) {
+	if err := os.RemoveAll(previewDir(track)); err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+}
+
+func (s *Stream) Preview(ctx context.Context, trackUuid string, request model.PreviewRequest) (*PreviewFile, error) {
+	length := request.Length
+	if length == 0 {
+		length = defaultPreviewLength
+	} else if length < 0 || length > maxPreviewLength {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "length", Code: "range", Message: fmt.Sprintf("must be between 0 and %g", maxPreviewLength)})
+	}
+	if request.Start != nil && *request.Start < 0 {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "start", Code: "min", Message: "is less than the minimum"})
+	}
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+
+	var start float64
+	if request.Start != nil {
+		start = *request.Start
+		if track.Duration > 0 && start >= track.Duration {
+			return nil, apperror.FieldValidation(apperror.FieldError{Field: "start", Code: "range", Message: "must be before the end of the track"})
+		}
+	} else {
+		// the default excerpt is kept whole by starting it earlier in short tracks
+		start = math.Max(0, math.Min(s.cfg.PreviewStart*track.Duration, track.Duration-length))
+	}
+	if track.Duration > 0 {
+		length = math.Min(length, track.Duration-start)
+	}
+	start, length = math.Round(start*1000)/1000, math.Round(length*1000)/1000
+
+	source := storedAudio{track: track}
+	if _, err := os.Stat(AudioPath(track)); err != nil {
+		return nil, renditionError(err)
+	}
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	target := transcode.Rendition{Format: string(format)}
+	if request.Fade && format == audio.FormatMP3 {
+		target = fadedMP3Preview
+	} else if format == audio.FormatFLAC {
+		target = transcode.Rendition{Format: transcode.WAV}
+	}
+
+	path := previewPath(track, start, length, request.Fade, target.Extension())
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		err = writeAtomically(path, func(w io.Writer) error {
+			if request.Fade {
+				clip := transcode.Clip{Start: start, Length: length, Fade: math.Min(previewFade, length/2)}
+				return s.clipper().Clip(ctx, transcode.Source{Format: format, Open: source.Open}, clip, target, w)
+			}
+			return cutAudio(source, format, start, length, w)
+		})
+		if err == nil {
+			f, err = os.Open(path)
+		}
+	}
+	if errors.Is(err, transcode.ErrUnsupported) {
+		return nil, errPreviewFadeUnavailable.Wrap(err)
+	} else if err != nil {
+		return nil, renditionError(err)
+	}
+	return &PreviewFile{
+		File:        f,
+		Track:       track,
+		ContentType: target.ContentType(),
+		Extension:   target.Extension(),
+		Start:       start,
+		Length:      length,
+	}, nil
+}
+
+// clipper is the configured transcoder when it can encode excerpts
+func (s *Stream) clipper() transcode.Clipper {
+	if clipper, ok := s.cfg.Transcoder.(transcode.Clipper); ok {
+		return clipper
+	}
+	return transcode.Chain{}
+}
+
+// cutAudio cuts the excerpt out of the stored audio, whole frames of mp3 and
+// exact samples of wav. Flac frames can not be cut apart, its excerpts are
+// decoded to wav.
+func cutAudio(source AudioSource, format audio.Format, start, length float64, w io.Writer) error {
+	r, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	switch format {
+	case audio.FormatWAV:
+		return audio.CutWAV(r, w, start, length)
+	case audio.FormatFLAC:
+		decoder, err := audio.NewDecoder(bufio.NewReader(r), format)
+		if err != nil {
+			return err
+		}
+		return audio.WriteWAV(w, audio.Excerpt(decoder, start, length, 0))
+	}
+	return audio.CutMP3(r, w, start, length)
+}
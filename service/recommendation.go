@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/common/util"
+	"sample/repository"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// weights of the similarity features, they add up to 1
+const (
+	artistWeight   = 0.3
+	genreWeight    = 0.2
+	yearWeight     = 0.1
+	playlistWeight = 0.2
+	coPlayWeight   = 0.2
+)
+
+const (
+	yearRange      = 10 // releases this many years apart are not close any more
+	listenerWindow = 90 * 24 * time.Hour
+
+	recommendationIndexTTL     = 10 * time.Minute
+	defaultRecommendationLimit = 10
+	maxRecommendationLimit     = 50
+	recentPlaysExcluded        = 50
+
+	radioSessionTTL = time.Hour
+	radioMemory     = 500 // served tracks a radio session keeps out of the queue
+	radioKeepRecent = 10  // served tracks still excluded when the catalog is used up, at most half of it
+	radioPickAmong  = 5   // the next radio track is drawn from the best ranked ones
+	radioSeedWeight = 0.6 // the rest goes to the last queued track, so the radio drifts
+)
+
+var errRadioSessionNotFound = apperror.NotFound(apperror.CodeRadioSessionNotFound, "radio session not found, start a new one with seed")
+
+type IRecommendationService interface {
+	// GetSimilarTracks ranks the tracks most similar to the track, without the ones the user played recently
+	GetSimilarTracks(ctx context.Context, trackUuid string, userId string, limit int) (*[]model.Recommendation, error)
+	// GetRadio starts a radio queue from seed, or continues the queue of session
+	GetRadio(ctx context.Context, userId string, seed string, session string, limit int) (*model.RadioQueue, error)
+}
+
+type Recommendation struct {
+}
+
+func NewRecommendation() IRecommendationService {
+	return &Recommendation{}
+}
+
+type radioSession struct {
+	Seed   string
+	Served []string
+}
+
+func (s *Recommendation) GetSimilarTracks(ctx context.Context, trackUuid string, userId string, limit int) (*[]model.Recommendation, error) {
+	index, err := loadRecommendationIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := index.seedTrack(ctx, trackUuid)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := recentlyPlayed(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	exclude[trackUuid] = struct{}{}
+
+	ranked := index.rank([]*model.Track{seed}, []float64{1}, exclude)
+	recommendations := []model.Recommendation{}
+	for _, recommendation := range ranked {
+		if len(recommendations) == recommendationLimit(limit) || recommendation.Score == 0 {
+			break
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+	return &recommendations, nil
+}
+
+func (s *Recommendation) GetRadio(ctx context.Context, userId string, seed string, sessionId string, limit int) (*model.RadioQueue, error) {
+	session := &radioSession{Seed: seed}
+	if len(sessionId) > 0 {
+		cached, err := cache.MCache.Get(radioKey(sessionId))
+		if err != nil {
+			return nil, apperror.Internal(err)
+		}
+		if stored, ok := cached.(radioSession); ok {
+			session = &stored
+		} else if len(seed) == 0 {
+			return nil, errRadioSessionNotFound
+		} else {
+			sessionId = ""
+		}
+	}
+	if len(sessionId) == 0 {
+		sessionId = uuid.NewString()
+	}
+
+	index, err := loadRecommendationIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seedTrack, err := index.seedTrack(ctx, session.Seed)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := recentlyPlayed(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &model.RadioQueue{Session: sessionId, Seed: session.Seed, Tracks: []model.Recommendation{}}
+	for len(queue.Tracks) < recommendationLimit(limit) {
+		last := seedTrack
+		if len(session.Served) > 0 {
+			last = index.tracks[session.Served[len(session.Served)-1]]
+		}
+		targets, weights := []*model.Track{seedTrack}, []float64{1}
+		if last != nil && last != seedTrack {
+			targets, weights = []*model.Track{seedTrack, last}, []float64{radioSeedWeight, 1 - radioSeedWeight}
+		}
+
+		ranked := index.rank(targets, weights, radioExclude(session, recent, len(session.Served)))
+		if len(ranked) == 0 {
+			// every track was queued already, start over keeping only the last ones out
+			keep := min(radioKeepRecent, (len(index.tracks)-1)/2)
+			ranked = index.rank(targets, weights, radioExclude(session, nil, keep))
+		}
+		if len(ranked) == 0 {
+			break
+		}
+		next := pickRecommendation(ranked)
+		queue.Tracks = append(queue.Tracks, next)
+		session.Served = append(session.Served, next.Track.ID)
+		if len(session.Served) > radioMemory {
+			session.Served = session.Served[len(session.Served)-radioMemory:]
+		}
+	}
+
+	if err := cache.MCache.SetTTL(radioKey(sessionId), *session, radioSessionTTL); err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+	return queue, nil
+}
+
+func radioKey(sessionId string) string {
+	return "radio:" + sessionId
+}
+
+// radioExclude keeps the seed, the last served tracks and the recent plays out of the queue
+func radioExclude(session *radioSession, recent map[string]struct{}, served int) map[string]struct{} {
+	exclude := map[string]struct{}{session.Seed: {}}
+	for trackId := range recent {
+		exclude[trackId] = struct{}{}
+	}
+	for i := len(session.Served) - 1; i >= 0 && i >= len(session.Served)-served; i-- {
+		exclude[session.Served[i]] = struct{}{}
+	}
+	return exclude
+}
+
+// pickRecommendation draws one of the best ranked tracks weighted by score, so
+// radios started from the same seed do not all play the same queue
+func pickRecommendation(ranked []model.Recommendation) model.Recommendation {
+	candidates := ranked[:min(radioPickAmong, len(ranked))]
+	total := 0.0
+	for _, candidate := range candidates {
+		total += candidate.Score + 0.01
+	}
+	draw := rand.Float64() * total
+	for _, candidate := range candidates {
+		draw -= candidate.Score + 0.01
+		if draw <= 0 {
+			return candidate
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+func recommendationLimit(limit int) int {
+	if limit <= 0 {
+		return defaultRecommendationLimit
+	}
+	return min(limit, maxRecommendationLimit)
+}
+
+// recentlyPlayed returns the tracks the user played last
+func recentlyPlayed(ctx context.Context, userId string) (map[string]struct{}, error) {
+	recent := map[string]struct{}{}
+	if len(userId) == 0 {
+		return recent, nil
+	}
+	plays, err := repository.PlayRepo.GetPlays(ctx, model.PlayFilter{UserID: userId, Limit: recentPlaysExcluded})
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	for _, play := range *plays {
+		recent[play.TrackID] = struct{}{}
+	}
+	return recent, nil
+}
+
+// recommendationIndex holds what the similarity of two tracks is computed from
+type recommendationIndex struct {
+	tracks    map[string]*model.Track
+	playlists map[string]map[string]struct{} // playlist ids by track id
+	listeners map[string]map[string]struct{} // user ids by track id
+}
+
+// loadRecommendationIndex builds the index from the catalog, without fingerprints and
+// loudness histograms, the static playlists and the recent plays. It is cached per
+// track generation and rebuilt after recommendationIndexTTL.
+func loadRecommendationIndex(ctx context.Context) (*recommendationIndex, error) {
+	generation, cacheable := currentTrackGeneration(ctx)
+	key := "recommendation_index:" + generation
+	if cacheable {
+		if cached, err := cache.MCache.Get(key); err != nil {
+			log.WithContext(ctx).Error(err)
+		} else if index, ok := cached.(*recommendationIndex); ok {
+			return index, nil
+		}
+	}
+
+	tracks, err := repository.TrackRepo.GetTracks(ctx, model.TrackFilter{})
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	playlists, err := repository.PlaylistRepo.GetPlaylists(ctx, model.PlaylistFilter{})
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	listeners, err := repository.PlayRepo.GetListeners(ctx, time.Now().Add(-listenerWindow))
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+
+	index := &recommendationIndex{
+		tracks:    make(map[string]*model.Track, len(*tracks)),
+		playlists: map[string]map[string]struct{}{},
+		listeners: make(map[string]map[string]struct{}, len(listeners)),
+	}
+	for i := range *tracks {
+		index.tracks[(*tracks)[i].ID] = &(*tracks)[i]
+	}
+	for _, playlist := range *playlists {
+		// smart playlists only repeat what their rules share
+		if playlist.Smart != nil {
+			continue
+		}
+		for _, trackId := range playlist.TrackIds {
+			if _, ok := index.playlists[trackId.TrackID]; !ok {
+				index.playlists[trackId.TrackID] = map[string]struct{}{}
+			}
+			index.playlists[trackId.TrackID][playlist.ID] = struct{}{}
+		}
+	}
+	for trackId, users := range listeners {
+		index.listeners[trackId] = make(map[string]struct{}, len(users))
+		for _, user := range users {
+			index.listeners[trackId][user] = struct{}{}
+		}
+	}
+
+	if cacheable {
+		if err := cache.MCache.SetTTL(key, index, recommendationIndexTTL); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+	return index, nil
+}
+
+// seedTrack returns a track of the index, a track stored after the index was built
+// is loaded on its own
+func (index *recommendationIndex) seedTrack(ctx context.Context, trackUuid string) (*model.Track, error) {
+	if track, ok := index.tracks[trackUuid]; ok {
+		return track, nil
+	}
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	return track, nil
+}
+
+// rank scores every track outside exclude by its weighted similarity to the
+// targets, best first; the reasons are the ones shared with the first target
+func (index *recommendationIndex) rank(targets []*model.Track, weights []float64, exclude map[string]struct{}) []model.Recommendation {
+	ranked := []model.Recommendation{}
+	for id, track := range index.tracks {
+		if _, ok := exclude[id]; ok {
+			continue
+		}
+		score := 0.0
+		var reasons []string
+		for i, target := range targets {
+			similarity, shared := index.similarity(target, track)
+			score += weights[i] * similarity
+			if i == 0 {
+				reasons = shared
+			}
+		}
+		ranked = append(ranked, model.Recommendation{Track: *track, Score: score, Reasons: reasons})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Track.ID < ranked[j].Track.ID
+	})
+	return ranked
+}
+
+// similarity of a and b between 0 and 1, with the features they share
+func (index *recommendationIndex) similarity(a, b *model.Track) (float64, []string) {
+	score := 0.0
+	reasons := []string{}
+	if artist := util.NormalizeText(a.Artist); len(artist) > 0 && artist == util.NormalizeText(b.Artist) {
+		score += artistWeight
+		reasons = append(reasons, "same artist")
+	}
+	if genre := util.NormalizeText(a.Genre); len(genre) > 0 && genre == util.NormalizeText(b.Genre) {
+		score += genreWeight
+		reasons = append(reasons, "same genre")
+	}
+	if a.ReleaseYear > 0 && b.ReleaseYear > 0 {
+		if proximity := 1 - math.Abs(float64(a.ReleaseYear-b.ReleaseYear))/yearRange; proximity > 0 {
+			score += yearWeight * proximity
+			reasons = append(reasons, "released around the same time")
+		}
+	}
+	if overlap := cosineOverlap(index.playlists[a.ID], index.playlists[b.ID]); overlap > 0 {
+		score += playlistWeight * overlap
+		reasons = append(reasons, "in the same playlists")
+	}
+	if overlap := cosineOverlap(index.listeners[a.ID], index.listeners[b.ID]); overlap > 0 {
+		score += coPlayWeight * overlap
+		reasons = append(reasons, "played by the same listeners")
+	}
+	return score, reasons
+}
+
+// cosineOverlap is |a ∩ b| / sqrt(|a| |b|)
+func cosineOverlap(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	shared := 0
+	for member := range a {
+		if _, ok := b[member]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / math.Sqrt(float64(len(a))*float64(len(b)))
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"sample/common/audio"
+	"sample/common/model"
+	"sample/common/util"
+)
+
+// fileAudio is an audio file on disk as an AudioSource, named after the upload it came from
+type fileAudio struct {
+	name string
+	path string
+}
+
+func (a fileAudio) Filename() string {
+	return a.name
+}
+
+func (a fileAudio) Open() (io.ReadCloser, error) {
+	return os.Open(a.path)
+}
+
+// trimSilence cuts the leading and trailing silence off an upload into a temporary
+// file, which the returned func removes. Wav files are cut at the sample, mp3 files
+// at the frames around the audio, keeping their ID3v2 tags. Uploads in other
+// formats, which would lose their own format, and uploads without silence are
+// returned as they are.
+func (s *Track) trimSilence(source AudioSource) (AudioSource, func(), error) {
+	keep := func() {}
+	if !s.trim {
+		return source, keep, nil
+	}
+	format, err := detectAudioFormat(source)
+	if err != nil || (format != audio.FormatWAV && format != audio.FormatMP3) {
+		return source, keep, nil
+	}
+	r, err := source.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	decoder, err := audio.NewDecoder(bufio.NewReader(r), format)
+	if err != nil {
+		return nil, nil, errInvalidAudio.Wrap(err)
+	}
+	silence := audio.NewSilenceDetector(decoder.SampleRate(), decoder.Channels(), s.silenceThreshold)
+	if err := audio.Analyze(decoder, silence); err != nil {
+		return nil, nil, errInvalidAudio.Wrap(err)
+	}
+	start, end, ok := silence.Bounds()
+	if !ok || (start == 0 && end >= silence.Duration()) {
+		// all silence is kept, there would be nothing left
+		return source, keep, nil
+	}
+
+	// the trimmed copy is as large as the upload, it goes next to the uploads rather than to /tmp
+	if err := os.MkdirAll(util.GetUploadDir(), 0755); err != nil {
+		return nil, nil, err
+	}
+	tmp, err := os.CreateTemp(util.GetUploadDir(), "trim-*."+string(format))
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() { os.Remove(tmp.Name()) }
+	if err := trimAudio(source, format, start, end-start, tmp); err != nil {
+		tmp.Close()
+		remove()
+		return nil, nil, errInvalidAudio.Wrap(err)
+	}
+	if err := tmp.Close(); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return fileAudio{name: source.Filename(), path: tmp.Name()}, remove, nil
+}
+
+// trimAudio cuts the audio like a preview, the tags of mp3 files are kept
+func trimAudio(source AudioSource, format audio.Format, start, length float64, w io.Writer) error {
+	if format == audio.FormatMP3 {
+		r, err := source.Open()
+		if err != nil {
+			return err
+		}
+		err = audio.CopyID3v2(bufio.NewReader(r), w)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return cutAudio(source, format, start, length, w)
+}
+
+func (s *Track) GetPlaybackHints(ctx context.Context, trackUuid string) (*model.PlaybackHints, error) {
+	track, err := s.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, err
+	}
+	hints := &model.PlaybackHints{
+		TrackID:  track.ID,
+		Duration: track.Duration,
+		AudioEnd: track.Duration,
+		Analyzed: track.Analysis == model.AnalysisDone,
+	}
+	// audio which is silence throughout has no bounds and is played whole
+	if track.AudioEnd > 0 {
+		hints.AudioStart, hints.AudioEnd = track.AudioStart, track.AudioEnd
+	}
+	if track.Loudness != nil {
+		gain := track.Loudness.TrackGain
+		hints.TrackGain, hints.AlbumGain = &gain, track.Loudness.AlbumGain
+	}
+	return hints, nil
+}
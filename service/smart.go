@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"time"
+)
+
+const smartPlaylistTTL = 10 * time.Minute
+
+var errSmartPlaylist = apperror.Conflict(apperror.CodeSmartPlaylist, "tracks of a smart playlist are computed from its rules")
+
+// resolveSmartTracks fills the track ids of a smart playlist from its rules
+func resolveSmartTracks(ctx context.Context, playlist *model.Playlist) error {
+	if playlist.Smart == nil {
+		return nil
+	}
+	generation, cacheable := currentTrackGeneration(ctx)
+	key := fmt.Sprintf("smart_playlist:%s:%d:%s", playlist.ID, playlist.Version, generation)
+	cacheable = cacheable && cache.MCache != nil
+	if cacheable {
+		if cached, err := cache.MCache.Get(key); err != nil {
+			log.WithContext(ctx).Error(err)
+		} else if trackIds, ok := cached.([]model.TrackIds); ok {
+			playlist.TrackIds = trackIds
+			return nil
+		}
+	}
+
+	filter := model.TrackFilter{
+		Rules: &playlist.Smart.Rules,
+		Sort:  playlist.Smart.Sort,
+		Limit: playlist.Smart.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = model.MaxSmartLimit
+	}
+	tracks, err := repository.TrackRepo.GetTracks(ctx, filter)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	trackIds := make([]model.TrackIds, 0, len(*tracks))
+	for _, track := range *tracks {
+		trackIds = append(trackIds, model.TrackIds{TrackID: track.ID})
+	}
+	playlist.TrackIds = trackIds
+
+	if cacheable {
+		if err := cache.MCache.SetTTL(key, trackIds, smartPlaylistTTL); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"sample/common/apperror"
+	"sample/common/cache"
+	"sample/common/hls"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/common/transcode"
+	"sample/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jobRenditions = "renditions"
+
+var errRenditionUnavailable = apperror.NotFound(apperror.CodeRenditionUnavailable, "the track can not be streamed in this format and bitrate")
+
+// renditionJobs holds the tracks whose configured renditions are made ahead of time
+var renditionJobs = newJobQueue()
+
+func queueRenditions(trackUuid string) {
+	renditionJobs.push(job{kind: jobRenditions, key: trackUuid})
+}
+
+type IStreamService interface {
+	// Stream returns the rendition of a track, transcoding it on first use
+	Stream(ctx context.Context, trackUuid string, rendition transcode.Rendition) (*StreamFile, error)
+	// PrepareRenditions transcodes the renditions configured ahead of time
+	PrepareRenditions(ctx context.Context, trackUuid string) error
+	// HLSMaster lists the mp3 renditions of a track for adaptive streaming
+	HLSMaster(ctx context.Context, trackUuid string) (*hls.MasterPlaylist, error)
+	// HLSMedia lists the segments of an mp3 rendition of a track
+	HLSMedia(ctx context.Context, trackUuid string, rendition transcode.Rendition) (*hls.MediaPlaylist, error)
+	// HLSSegment returns a segment of an mp3 rendition of a track, the caller closes it
+	HLSSegment(ctx context.Context, trackUuid string, rendition transcode.Rendition, index int) (*HLSSegment, error)
+	// Preview returns an excerpt of a track, cut without re-encoding unless it fades
+	Preview(ctx context.Context, trackUuid string, request model.PreviewRequest) (*PreviewFile, error)
+}
+
+// StreamConfig holds the settings of the stream service
+type StreamConfig struct {
+	// Dir stores the renditions, least recently used ones are removed beyond CacheBytes
+	Dir        string
+	CacheBytes int64
+	Transcoder transcode.Transcoder
+	// Renditions are made ahead of time after upload, any other on first request.
+	// Their mp3 ones are the variants of HLS.
+	Renditions []transcode.Rendition
+	// SegmentDuration is the shortest HLS segment but the last, 6s by default
+	SegmentDuration time.Duration
+	// PreviewStart is the share of the duration previews start at unless asked otherwise
+	PreviewStart float64
+}
+
+// StreamFile is an open rendition of a track, the caller closes it
+type StreamFile struct {
+	*os.File
+	Track     *model.Track
+	Rendition transcode.Rendition
+}
+
+type Stream struct {
+	cfg   StreamConfig
+	cache *cache.DiskCache
+}
+
+func NewStream(cfg StreamConfig) (IStreamService, error) {
+	renditions, err := cache.NewDiskCache(cfg.Dir, cfg.CacheBytes)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Transcoder == nil {
+		cfg.Transcoder = transcode.Native{}
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = defaultSegmentDuration
+	}
+	return &Stream{cfg: cfg, cache: renditions}, nil
+}
+
+// RunRenditionWorker makes the renditions of uploaded tracks in the background until ctx is done
+func RunRenditionWorker(ctx context.Context, streamService IStreamService) {
+	renditionJobs.run(ctx, func(next job) {
+		if err := streamService.PrepareRenditions(ctx, next.key); err != nil {
+			log.Errorf("renditions of track %s failed: %v", next.key, err)
+		}
+	})
+}
+
+// renditionKey names the cached rendition after the audio it was made from, so
+// renditions of replaced audio are never served and age out of the cache
+func renditionKey(track *model.Track, rendition transcode.Rendition) string {
+	return path.Join(track.ID, audioKey(track), rendition.String()+"."+rendition.Extension())
+}
+
+// audioKey tells the stored audio of a track apart from the audio it replaced
+func audioKey(track *model.Track) string {
+	if track.Fingerprint != nil {
+		hash := strings.TrimPrefix(track.Fingerprint.ContentHash, "sha256:")
+		return hash[:min(len(hash), 16)]
+	}
+	return "v" + strconv.FormatInt(track.Version, 10)
+}
+
+func (s *Stream) Stream(ctx context.Context, trackUuid string, rendition transcode.Rendition) (*StreamFile, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	f, err := s.open(ctx, track, rendition)
+	if err != nil {
+		return nil, renditionError(err)
+	}
+	return &StreamFile{File: f, Track: track, Rendition: rendition}, nil
+}
+
+// renditionError maps the errors of opening a rendition
+func renditionError(err error) error {
+	if errors.Is(err, transcode.ErrUnsupported) {
+		return errRenditionUnavailable.Wrap(err)
+	} else if os.IsNotExist(err) {
+		return errAudioFileNotFound.Wrap(err)
+	}
+	return apperror.Internal(err)
+}
+
+func (s *Stream) PrepareRenditions(ctx context.Context, trackUuid string) error {
+	if len(s.cfg.Renditions) == 0 {
+		return nil
+	}
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, rendition := range s.cfg.Renditions {
+		f, err := s.open(ctx, track, rendition)
+		if errors.Is(err, transcode.ErrUnsupported) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return nil
+}
+
+func (s *Stream) open(ctx context.Context, track *model.Track, rendition transcode.Rendition) (*os.File, error) {
+	source := storedAudio{track: track}
+	// the stored audio is checked first, so a missing file is reported as such and not as a failed transcode
+	if _, err := os.Stat(AudioPath(track)); err != nil {
+		return nil, err
+	}
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.cache.OpenOrFill(renditionKey(track, rendition), func(f *os.File) error {
+		return s.cfg.Transcoder.Transcode(ctx, transcode.Source{Format: format, Open: source.Open}, rendition, f)
+	})
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"sample/common/apperror"
+	"sample/common/artwork"
+	"sample/common/audio"
+	"sample/common/log"
+	"sample/common/model"
+	"sample/repository"
+	"sync"
+)
+
+// tagCoverSize is the cover size embedded in written tags
+const tagCoverSize = 1000
+
+// tagLocks serialize the rewrites of the stored file of a track, a track takes
+// the lock at the hash of its id
+var tagLocks [64]sync.Mutex
+
+func tagLock(trackUuid string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(trackUuid))
+	return &tagLocks[h.Sum32()%uint32(len(tagLocks))]
+}
+
+// TrackDownload is the audio file of a track as it is downloaded, the caller closes it
+type TrackDownload struct {
+	io.ReadSeeker
+	Track       *model.Track
+	ContentType string
+	Size        int64
+	file        *os.File
+}
+
+func (d *TrackDownload) Close() error {
+	return d.file.Close()
+}
+
+// trackTags are the catalog fields of track as tags, with its stored cover when it has one
+func trackTags(ctx context.Context, track *model.Track) audio.Tags {
+	tags := audio.Tags{
+		Title:  track.Title,
+		Artist: track.Artist,
+		Album:  track.Album,
+		Genre:  track.Genre,
+		Year:   track.ReleaseYear,
+	}
+	if track.Cover != nil {
+		cover, err := os.ReadFile(coverPath(trackCoverDir(track.ID), "cover", track.Cover.Hash, tagCoverSize, artwork.JPEG))
+		if err != nil {
+			log.WithContext(ctx).Warningf("track %s cover is not tagged: %v", track.ID, err)
+		}
+		tags.Cover = cover
+	}
+	return tags
+}
+
+// tagStoredAudio writes the fields of track into the tags of its stored mp3 file.
+// Only the tags are replaced, so the content hash and the renditions stay valid.
+// The file is left alone once the track has a newer version, whose update tags it
+// after this one.
+func (s *Track) tagStoredAudio(ctx context.Context, track *model.Track) {
+	if s.tags != model.TagWritingStore {
+		return
+	}
+	lock := tagLock(track.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	if format, err := detectAudioFormat(storedAudio{track: track}); err != nil || format != audio.FormatMP3 {
+		return
+	}
+	f, err := os.Open(AudioPath(track))
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	tagged, err := audio.TagMP3(f, info.Size(), trackTags(ctx, track))
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	current, err := repository.TrackRepo.GetTrackById(ctx, track.ID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.WithContext(ctx).Error(err)
+		}
+		return
+	} else if current.Version != track.Version {
+		return
+	}
+	err = writeAtomically(AudioPath(track), func(w io.Writer) error {
+		_, err := io.Copy(w, tagged)
+		return err
+	})
+	if err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+}
+
+func (s *Track) DownloadTrack(ctx context.Context, trackUuid string) (*TrackDownload, error) {
+	track, err := s.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, err
+	}
+	format, err := detectAudioFormat(storedAudio{track: track})
+	if os.IsNotExist(err) {
+		return nil, errAudioFileNotFound.Wrap(err)
+	} else if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	f, err := os.Open(AudioPath(track))
+	if os.IsNotExist(err) {
+		return nil, errAudioFileNotFound.Wrap(err)
+	} else if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, apperror.Internal(err)
+	}
+
+	download := &TrackDownload{ReadSeeker: f, Track: track, Size: info.Size(), file: f}
+	if s.tags == model.TagWritingDownload && format == audio.FormatMP3 {
+		// the tags are put in front of the stored frames as they are read
+		tagged, err := audio.TagMP3(f, info.Size(), trackTags(ctx, track))
+		if err != nil {
+			f.Close()
+			return nil, errInvalidAudio.Wrap(err)
+		}
+		download.ReadSeeker, download.Size = tagged, tagged.Size()
+	}
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(download, head)
+	if _, err := download.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, apperror.Internal(err)
+	}
+	download.ContentType = http.DetectContentType(head[:n])
+	if format == audio.FormatFLAC {
+		// which the content sniffing does not know
+		download.ContentType = "audio/flac"
+	}
+	return download, nil
+}
@@ -3,54 +3,121 @@ package service
 import (
 	"context"
 	"io"
-	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sample/common/apperror"
+	"sample/common/artwork"
+	"sample/common/audio"
 	"sample/common/model"
-	"sample/common/response"
 	"sample/repository"
 	"strings"
+	"time"
 
 	"sample/common/log"
 
-	"github.com/tcolgate/mp3"
-
 	"github.com/google/uuid"
 )
 
 type ITrackService interface {
-	GetTracks(ctx context.Context, filter model.TrackFilter) (int, any)
-	GetTrackById(ctx context.Context, trackUuid string) (int, any)
-	PostTrack(ctx context.Context, track model.TrackRequest, fileUpload *multipart.FileHeader) (int, any)
-	DeleteTrackById(ctx context.Context, trackUuid string) (int, any)
-	PutTrackById(ctx context.Context, trackUuid string, trackUpdate model.TrackRequest, fileUpload *multipart.FileHeader) (int, any)
+	GetTracks(ctx context.Context, filter model.TrackFilter) (*[]model.Track, error)
+	GetTrackById(ctx context.Context, trackUuid string) (*model.Track, error)
+	// ReceiveAudio stores an upload temporarily for PostTrack or PutTrackById, the caller closes it
+	ReceiveAudio(ctx context.Context, r io.Reader, filename string) (*UploadedAudio, error)
+	PostTrack(ctx context.Context, track model.TrackRequest, audio AudioSource) (*model.Track, error)
+	// writes take the version the client last read, see repository.ITracks
+	DeleteTrackById(ctx context.Context, trackUuid string, version int64) error
+	PutTrackById(ctx context.Context, trackUuid string, version int64, trackUpdate model.TrackRequest, audio AudioSource) (*model.Track, error)
+	PatchTrackById(ctx context.Context, trackUuid string, version int64, patch model.Patch) (*model.Track, error)
+	// GetDuplicates returns the groups of tracks with the same audio
+	GetDuplicates(ctx context.Context) (*[]model.DuplicateCluster, error)
+	// GetWaveform returns the waveform of the track with at most samples pixels
+	GetWaveform(ctx context.Context, trackUuid string, samples int) (*audio.Waveform, error)
+	// GetTrackCover returns the cover of the track at one of the artwork sizes, in JPEG when it has none in format
+	GetTrackCover(ctx context.Context, trackUuid string, size int, format artwork.Format) (*CoverFile, error)
+	// PutTrackCover replaces the cover of the track, also an embedded one
+	PutTrackCover(ctx context.Context, trackUuid string, version int64, image io.Reader) (*model.Track, error)
+	// GetPlaybackHints returns where the audio of the track starts and ends after its silence
+	GetPlaybackHints(ctx context.Context, trackUuid string) (*model.PlaybackHints, error)
+	// DownloadTrack opens the stored audio of the track, tagged with its fields when configured
+	DownloadTrack(ctx context.Context, trackUuid string) (*TrackDownload, error)
+}
+
+// TrackConfig holds the settings of the track service
+type TrackConfig struct {
+	// DuplicateUploads decides what happens to uploads whose audio is already in the catalog
+	DuplicateUploads model.DuplicatePolicy
+	// TagWriting decides when the catalog fields are written into mp3 tags, off by default
+	TagWriting model.TagWriting
+	// TrimSilence cuts leading and trailing silence off wav and mp3 uploads before they
+	// are stored, flac uploads are stored as they are
+	TrimSilence bool
+	// SilenceThreshold is the level in dBFS below which audio is silence
+	SilenceThreshold float64
+	// MaxUploadBytes bounds the size of uploaded audio files
+	MaxUploadBytes int64
 }
 
 type Track struct {
+	duplicates       model.DuplicatePolicy
+	tags             model.TagWriting
+	trim             bool
+	silenceThreshold float64
+	maxUpload        int64
 }
 
-func NewTrack() ITrackService {
-	return &Track{}
+func NewTrack(cfg TrackConfig) ITrackService {
+	if cfg.DuplicateUploads != model.DuplicateLink {
+		cfg.DuplicateUploads = model.DuplicateReject
+	}
+	if cfg.TagWriting != model.TagWritingStore && cfg.TagWriting != model.TagWritingDownload {
+		cfg.TagWriting = model.TagWritingOff
+	}
+	if cfg.SilenceThreshold >= 0 {
+		cfg.SilenceThreshold = audio.DefaultSilenceThreshold
+	}
+	if cfg.MaxUploadBytes <= 0 {
+		cfg.MaxUploadBytes = defaultMaxUploadBytes
+	}
+	return &Track{
+		duplicates:       cfg.DuplicateUploads,
+		tags:             cfg.TagWriting,
+		trim:             cfg.TrimSilence,
+		silenceThreshold: cfg.SilenceThreshold,
+		maxUpload:        cfg.MaxUploadBytes,
+	}
 }
 
-func (s *Track) GetTracks(ctx context.Context, filter model.TrackFilter) (int, any) {
+func (s *Track) GetTracks(ctx context.Context, filter model.TrackFilter) (*[]model.Track, error) {
+	if filter.BPMMin < 0 || filter.BPMMax < 0 || (filter.BPMMax > 0 && filter.BPMMin > filter.BPMMax) {
+		return nil, apperror.FieldValidation(apperror.FieldError{Field: "bpm_min", Code: "range", Message: "must be between 0 and bpm_max"})
+	}
+	if len(filter.Key) > 0 {
+		key, err := audio.ParseKey(filter.Key)
+		if err != nil {
+			return nil, apperror.FieldValidation(apperror.FieldError{Field: "key", Code: "format", Message: `must be a key like "A minor", "Am" or "Bb"`})
+		}
+		filter.Key = key
+	}
 	tracks, err := repository.TrackRepo.GetTracks(ctx, filter)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, apperror.Internal(err)
 	}
-	return response.OK(tracks)
+	return tracks, nil
 }
 
-func (s *Track) PostTrack(ctx context.Context, trackRequest model.TrackRequest, fileUpload *multipart.FileHeader) (int, any) {
-	// Parse audio file duration
+func (s *Track) PostTrack(ctx context.Context, trackRequest model.TrackRequest, audio AudioSource) (*model.Track, error) {
+	audio, removeTrimmed, err := s.trimSilence(audio)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTrimmed()
 
-	fileExtension := fileUpload.Filename[strings.LastIndex(fileUpload.Filename, ".")+1:]
-	duration, err := HandleParseAudioDuration(fileUpload)
+	duration, fingerprint, err := probeAudio(audio)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, errInvalidAudio.Wrap(err)
 	}
 
-	track := model.Track{
+	track := &model.Track{
 		ID:          uuid.NewString(),
 		Title:       trackRequest.Title,
 		Artist:      trackRequest.Artist,
@@ -58,66 +125,100 @@ func (s *Track) PostTrack(ctx context.Context, trackRequest model.TrackRequest,
 		Genre:       trackRequest.Genre,
 		ReleaseYear: trackRequest.ReleaseYear,
 		Duration:    duration,
-		MP3File:     trackRequest.Title + "." + fileExtension,
+		MP3File:     audioFileName(trackRequest.Title, audio.Filename()),
+		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+		Fingerprint: fingerprint,
 	}
-	err = repository.TrackRepo.PostTrack(ctx, track)
-	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+	if err := s.checkDuplicate(ctx, track); err != nil {
+		return nil, err
 	}
-	return response.OK(track)
+	cover := extractCover(ctx, audio)
+	if cover != nil {
+		track.Cover = &cover.art
+	}
+	// the audio goes in place first, the directory of a new track is unused until its record exists
+	if err := stageAudio(audio, AudioPath(track)); err != nil {
+		return nil, apperror.Internal(err)
+	}
+	if err := repository.TrackRepo.PostTrack(ctx, *track); err != nil {
+		if err := os.RemoveAll(filepath.Dir(AudioPath(track))); err != nil {
+			log.WithContext(ctx).Error(err)
+		}
+		return nil, duplicateError(err)
+	}
+	storeWaveforms(ctx, track)
+	storeTrackCover(ctx, track, cover)
+	s.tagStoredAudio(ctx, track)
+	invalidateTrackCaches(ctx)
+	queueTrackAnalysis(track.ID)
+	queueRenditions(track.ID)
+	return track, nil
 }
 
-func (s *Track) GetTrackById(ctx context.Context, trackUuid string) (int, any) {
+func (s *Track) GetTrackById(ctx context.Context, trackUuid string) (*model.Track, error) {
 	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, repositoryError(err, errTrackNotFound)
 	}
-	return response.OK(track)
+	return track, nil
 }
 
-func (s *Track) DeleteTrackById(ctx context.Context, trackUuid string) (int, any) {
+func (s *Track) DeleteTrackById(ctx context.Context, trackUuid string, version int64) error {
 	// check exits track id
-	if _, err := repository.TrackRepo.GetTrackById(ctx, trackUuid); err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return repositoryError(err, errTrackNotFound)
+	} else if track.Version != version {
+		return errVersionMismatch
 	}
 
-	err := repository.TrackRepo.DeleteTrackById(ctx, trackUuid)
+	err = repository.TrackRepo.DeleteTrackById(ctx, trackUuid, version)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return repositoryError(err, errTrackNotFound)
 	}
-	return response.OK(map[string]interface{}{
-		"delete success track id": trackUuid,
-	})
+	invalidateTrackCaches(ctx)
+	queueAlbumGain(track.Album)
+	return nil
 }
 
-func (s *Track) PutTrackById(ctx context.Context, trackUuid string, trackRequest model.TrackRequest, fileUpload *multipart.FileHeader) (int, any) {
+func (s *Track) PutTrackById(ctx context.Context, trackUuid string, version int64, trackRequest model.TrackRequest, audio AudioSource) (*model.Track, error) {
 	// check exits track id
 	trackExist, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
-	} else if trackExist == nil {
-		log.Error(err)
-		return response.BadRequestMsg("track not found")
+		return nil, repositoryError(err, errTrackNotFound)
+	} else if trackExist.Version != version {
+		return nil, errVersionMismatch
 	}
 
-	if fileUpload != nil {
-		duration, err := HandleParseAudioDuration(fileUpload)
+	var cover *renderedCover
+	if audio != nil {
+		trimmed, removeTrimmed, err := s.trimSilence(audio)
+		if err != nil {
+			return nil, err
+		}
+		defer removeTrimmed()
+		audio = trimmed
+		duration, fingerprint, err := probeAudio(audio)
 		if err != nil {
-			log.Error(err)
-			return response.ServiceUnavailableMsg(err.Error())
+			return nil, errInvalidAudio.Wrap(err)
 		}
 		trackExist.Duration = duration
-
-		fileExtension := fileUpload.Filename[strings.LastIndex(fileUpload.Filename, ".")+1:]
-		trackExist.MP3File = trackRequest.Title + "." + fileExtension
+		trackExist.MP3File = audioFileName(trackRequest.Title, audio.Filename())
+		trackExist.Fingerprint = fingerprint
+		if err := s.checkDuplicate(ctx, trackExist); err != nil {
+			return nil, err
+		}
+		// an uploaded cover outlives the audio, an embedded one comes with it
+		if trackExist.Cover == nil || trackExist.Cover.Source == model.CoverEmbedded {
+			trackExist.Cover = nil
+			if cover = extractCover(ctx, audio); cover != nil {
+				trackExist.Cover = &cover.art
+			}
+		}
 	}
 
-	trackUpdate := model.Track{
+	trackUpdate := &model.Track{
 		ID:          trackUuid,
 		Title:       trackRequest.Title,
 		Artist:      trackRequest.Artist,
@@ -126,39 +227,144 @@ func (s *Track) PutTrackById(ctx context.Context, trackUuid string, trackRequest
 		ReleaseYear: trackRequest.ReleaseYear,
 		Duration:    trackExist.Duration,
 		MP3File:     trackExist.MP3File,
+		CreatedAt:   trackExist.CreatedAt,
+		Likes:       trackExist.Likes,
+		Version:     version + 1,
+		Fingerprint: trackExist.Fingerprint,
+		AlternateOf: trackExist.AlternateOf,
+		Analysis:    trackExist.Analysis,
+		Loudness:    trackExist.Loudness,
+		BPM:         trackExist.BPM,
+		Key:         trackExist.Key,
+		AudioStart:  trackExist.AudioStart,
+		AudioEnd:    trackExist.AudioEnd,
+		Cover:       trackExist.Cover,
+	}
+	// new audio is analyzed again, until then it has no analysis results
+	if audio != nil {
+		trackUpdate.Analysis, trackUpdate.Loudness, trackUpdate.BPM, trackUpdate.Key = "", nil, 0, ""
+		trackUpdate.AudioStart, trackUpdate.AudioEnd = 0, 0
 	}
 
-	err = repository.TrackRepo.PutTrackById(ctx, trackUuid, trackUpdate)
+	// new audio is staged next to the old one and only replaces it once the record is updated
+	var pending string
+	if audio != nil {
+		pending = filepath.Join(filepath.Dir(AudioPath(trackUpdate)), ".pending-"+trackUpdate.MP3File)
+		if err := stageAudio(audio, pending); err != nil {
+			return nil, apperror.Internal(err)
+		}
+		defer os.Remove(pending)
+	}
+	err = repository.TrackRepo.PutTrackById(ctx, trackUuid, version, *trackUpdate)
 	if err != nil {
-		log.Error(err)
-		return response.ServiceUnavailableMsg(err.Error())
+		return nil, duplicateError(err)
 	}
+	invalidateTrackCaches(ctx)
 
-	return response.OK(trackUpdate)
+	if audio != nil {
+		if err := os.Rename(pending, AudioPath(trackUpdate)); err != nil {
+			s.restoreTrack(ctx, trackExist, version+1)
+			return nil, apperror.Internal(err)
+		}
+		if trackExist.MP3File != trackUpdate.MP3File {
+			if err := os.Remove(AudioPath(trackExist)); err != nil && !os.IsNotExist(err) {
+				log.WithContext(ctx).Error(err)
+			}
+		}
+		storeWaveforms(ctx, trackUpdate)
+		storeTrackCover(ctx, trackUpdate, cover)
+		removePreviews(ctx, trackUpdate)
+		queueTrackAnalysis(trackUuid)
+		queueRenditions(trackUuid)
+	}
+	s.tagStoredAudio(ctx, trackUpdate)
+	if trackUpdate.Album != trackExist.Album {
+		queueAlbumGain(trackExist.Album, trackUpdate.Album)
+	}
+	return trackUpdate, nil
 }
 
-func HandleParseAudioDuration(file *multipart.FileHeader) (float64, error) {
-	var duration float64
-	fd, err := file.Open()
+func (s *Track) PatchTrackById(ctx context.Context, trackUuid string, version int64, patch model.Patch) (*model.Track, error) {
+	track, err := repository.TrackRepo.GetTrackById(ctx, trackUuid)
 	if err != nil {
-		log.Error(err)
-		return 0, err
-	}
-	defer fd.Close()
-
-	decode := mp3.NewDecoder(fd)
-	var frame mp3.Frame
-	skipped := 0
-	for {
-		if err := decode.Decode(&frame, &skipped); err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Error(err)
-			return 0, err
-		}
-		duration = duration + frame.Duration().Seconds()
+		return nil, repositoryError(err, errTrackNotFound)
+	} else if track.Version != version {
+		return nil, errVersionMismatch
+	}
+
+	current := trackPatchDocument{
+		Title:       track.Title,
+		Artist:      track.Artist,
+		Album:       track.Album,
+		Genre:       track.Genre,
+		ReleaseYear: track.ReleaseYear,
+	}
+	patched := trackPatchDocument{}
+	if err := applyPatch(current, patch, &patched); err != nil {
+		return nil, err
+	}
+	trackRequest := model.TrackRequest{
+		Title:       patched.Title,
+		Artist:      patched.Artist,
+		Album:       patched.Album,
+		Genre:       patched.Genre,
+		ReleaseYear: patched.ReleaseYear,
+	}
+	if err := trackRequest.Validate(); err != nil {
+		return nil, err
 	}
 
-	return duration, nil
+	// only the fields changed by the patch are written
+	fields := map[string]any{}
+	if patched.Title != current.Title {
+		fields["title"] = patched.Title
+		track.Title = patched.Title
+	}
+	if patched.Artist != current.Artist {
+		fields["artist"] = patched.Artist
+		track.Artist = patched.Artist
+	}
+	if patched.Album != current.Album {
+		fields["album"] = patched.Album
+		track.Album = patched.Album
+	}
+	if patched.Genre != current.Genre {
+		fields["genre"] = patched.Genre
+		track.Genre = patched.Genre
+	}
+	if patched.ReleaseYear != current.ReleaseYear {
+		fields["release_year"] = patched.ReleaseYear
+		track.ReleaseYear = patched.ReleaseYear
+	}
+	if len(fields) == 0 {
+		return track, nil
+	}
+
+	if err := repository.TrackRepo.PatchTrackById(ctx, trackUuid, version, fields); err != nil {
+		return nil, repositoryError(err, errTrackNotFound)
+	}
+	track.Version = version + 1
+	invalidateTrackCaches(ctx)
+	s.tagStoredAudio(ctx, track)
+	if patched.Album != current.Album {
+		queueAlbumGain(current.Album, patched.Album)
+	}
+	return track, nil
+}
+
+// restoreTrack puts back the record of a track whose new audio could not be stored,
+// the analysis results dropped with the audio are computed again
+func (s *Track) restoreTrack(ctx context.Context, track *model.Track, version int64) {
+	if err := repository.TrackRepo.PutTrackById(ctx, track.ID, version, *track); err != nil {
+		log.WithContext(ctx).Error(err)
+		return
+	}
+	invalidateTrackCaches(ctx)
+	queueTrackAnalysis(track.ID)
+}
+
+// audioFileName names the stored file after the track title, keeping the upload extension
+func audioFileName(title, uploadName string) string {
+	fileExtension := uploadName[strings.LastIndex(uploadName, ".")+1:]
+	return filepath.Base(title + "." + fileExtension)
 }
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sample/common/apperror"
+	"sample/common/audio"
+	"sample/common/model"
+	"sample/common/util"
+	"sync"
+)
+
+// defaultMaxUploadBytes bounds the size of an uploaded audio file
+const defaultMaxUploadBytes = 200 << 20
+
+var errUploadInterrupted = apperror.BadRequest(apperror.CodeInvalidForm, "the upload ended before the audio file was complete")
+
+// UploadedAudio is an audio file received into temporary storage, it was hashed
+// and probed on the way in. It is an AudioSource, and Close removes it unless a
+// track took it over.
+type UploadedAudio struct {
+	fileAudio
+	Size        int64
+	duration    float64
+	fingerprint *model.AudioFingerprint
+}
+
+func (u *UploadedAudio) Close() error {
+	if err := os.Remove(u.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// uploadReader remembers the error of reading the upload, apart from the errors of storing it
+type uploadReader struct {
+	r   io.Reader
+	err error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err != nil && err != io.EOF {
+		u.err = err
+	}
+	return n, err
+}
+
+// ReceiveAudio writes r to temporary storage while the content hash, the duration
+// and, for decodable formats, the acoustic fingerprint are computed from the same
+// bytes, so the upload is read only once
+func (s *Track) ReceiveAudio(ctx context.Context, r io.Reader, filename string) (*UploadedAudio, error) {
+	src := &uploadReader{r: io.LimitReader(r, s.maxUpload+1)}
+	br := bufio.NewReader(src)
+	head, _ := br.Peek(12)
+	if src.err != nil {
+		return nil, errUploadInterrupted.Wrap(src.err)
+	}
+	format, err := audio.DetectFormat(head)
+	if err != nil {
+		// mp3 streams may start with junk before the first frame, which the frame decoder skips
+		format = audio.FormatMP3
+	}
+
+	if err := os.MkdirAll(util.GetUploadDir(), 0755); err != nil {
+		return nil, apperror.Internal(err)
+	}
+	tmp, err := os.CreateTemp(util.GetUploadDir(), "upload-*")
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+	upload := &UploadedAudio{fileAudio: fileAudio{name: filename, path: tmp.Name()}}
+
+	var probes sync.WaitGroup
+	writers := []io.Writer{tmp}
+	probe := func(fn func(r io.Reader) error) *error {
+		pr, pw := io.Pipe()
+		writers = append(writers, pw)
+		var probeErr error
+		probes.Add(1)
+		go func() {
+			defer probes.Done()
+			probeErr = fn(pr)
+			// the other probes and the file still need the rest
+			io.Copy(io.Discard, pr)
+		}()
+		return &probeErr
+	}
+	hashErr := probe(func(r io.Reader) error {
+		contentHash, err := audio.ContentHash(r, format)
+		upload.fingerprint = &model.AudioFingerprint{ContentHash: contentHash}
+		return err
+	})
+	durationErr := probe(func(r io.Reader) error {
+		var err error
+		upload.duration, err = audioDuration(r, format)
+		return err
+	})
+	var acoustic []uint32
+	acousticErr := new(error)
+	if audio.Decodable(format) {
+		acousticErr = probe(func(r io.Reader) error {
+			decoder, err := audio.NewDecoder(r, format)
+			if err != nil {
+				return err
+			}
+			acoustic, err = audio.AcousticFingerprint(decoder)
+			return err
+		})
+	}
+
+	size, copyErr := io.Copy(io.MultiWriter(writers...), br)
+	for _, w := range writers[1:] {
+		w.(*io.PipeWriter).CloseWithError(copyErr)
+	}
+	probes.Wait()
+	if err := tmp.Close(); copyErr == nil {
+		copyErr = err
+	}
+	upload.Size = size
+
+	switch {
+	case src.err != nil:
+		err = errUploadInterrupted.Wrap(src.err)
+	case copyErr != nil:
+		err = apperror.Internal(copyErr)
+	case size > s.maxUpload:
+		err = apperror.TooLarge(apperror.CodeUploadTooLarge, fmt.Sprintf("the audio file must be at most %d MB", s.maxUpload>>20))
+	case *hashErr != nil:
+		err = errInvalidAudio.Wrap(*hashErr)
+	case *durationErr != nil:
+		err = errInvalidAudio.Wrap(*durationErr)
+	case *acousticErr != nil:
+		err = errInvalidAudio.Wrap(*acousticErr)
+	}
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+	upload.fingerprint.Acoustic = acoustic
+	return upload, nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sample/common/apperror"
+	"sample/common/audio"
+	"sample/common/log"
+	"sample/common/model"
+)
+
+// waveformResolutions are the samples per pixel of the stored waveforms, finest first
+var waveformResolutions = []int{256, 2048, 16384}
+
+const defaultWaveformSamples = 1000
+
+var errWaveformUnavailable = apperror.NotFound(apperror.CodeWaveformUnavailable, "no waveform can be computed for the audio format of this track")
+
+// storedAudio is the stored audio file of a track as an AudioSource
+type storedAudio struct {
+	track *model.Track
+}
+
+func (a storedAudio) Filename() string {
+	return a.track.MP3File
+}
+
+func (a storedAudio) Open() (io.ReadCloser, error) {
+	return os.Open(AudioPath(a.track))
+}
+
+func waveformPath(track *model.Track, samplesPerPixel int) string {
+	return filepath.Join(filepath.Dir(AudioPath(track)), fmt.Sprintf("waveform_%d.dat", samplesPerPixel))
+}
+
+// generateWaveforms decodes the stored audio of track and stores its waveforms
+// next to it, audio.ErrNotDecodable is returned for formats without a decoder
+func generateWaveforms(track *model.Track) error {
+	source := storedAudio{track: track}
+	format, err := detectAudioFormat(source)
+	if err != nil {
+		return err
+	} else if !audio.Decodable(format) {
+		return audio.ErrNotDecodable
+	}
+	r, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	decoder, err := audio.NewDecoder(bufio.NewReader(r), format)
+	if err != nil {
+		return err
+	}
+	waveforms, err := audio.ComputeWaveforms(decoder, waveformResolutions...)
+	if err != nil {
+		return err
+	}
+	for _, waveform := range waveforms {
+		if err := writeWaveform(waveformPath(track, waveform.SamplesPerPixel), waveform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWaveform replaces the file at path at once, readers never see a partial waveform
+func writeWaveform(path string, waveform *audio.Waveform) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if _, err := waveform.WriteTo(w); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// storeWaveforms replaces the waveforms of a track after its audio was stored,
+// a failure only costs the waveform and is logged
+func storeWaveforms(ctx context.Context, track *model.Track) {
+	if err := removeWaveforms(track); err != nil {
+		log.WithContext(ctx).Error(err)
+	}
+	if err := generateWaveforms(track); err != nil && !errors.Is(err, audio.ErrNotDecodable) {
+		log.WithContext(ctx).Error(err)
+	}
+}
+
+func removeWaveforms(track *model.Track) error {
+	for _, samplesPerPixel := range waveformResolutions {
+		if err := os.Remove(waveformPath(track, samplesPerPixel)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readWaveform(path string) (*audio.Waveform, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return audio.ReadWaveform(bufio.NewReader(f))
+}
+
+func (s *Track) GetWaveform(ctx context.Context, trackUuid string, samples int) (*audio.Waveform, error) {
+	track, err := s.GetTrackById(ctx, trackUuid)
+	if err != nil {
+		return nil, err
+	}
+	if samples <= 0 {
+		samples = defaultWaveformSamples
+	}
+
+	// the coarsest stored waveform with enough pixels is resized to the requested samples,
+	// tracks uploaded before waveforms existed get theirs on first request
+	generated := false
+	var waveform *audio.Waveform
+	for i := len(waveformResolutions) - 1; i >= 0; i-- {
+		waveform, err = readWaveform(waveformPath(track, waveformResolutions[i]))
+		if os.IsNotExist(err) && !generated {
+			generated = true
+			if err := generateWaveforms(track); errors.Is(err, audio.ErrNotDecodable) {
+				return nil, errWaveformUnavailable.Wrap(err)
+			} else if os.IsNotExist(err) {
+				return nil, errAudioFileNotFound.Wrap(err)
+			} else if err != nil {
+				return nil, apperror.Internal(err)
+			}
+			waveform, err = readWaveform(waveformPath(track, waveformResolutions[i]))
+		}
+		if err != nil {
+			return nil, apperror.Internal(err)
+		}
+		if waveform.Length >= samples {
+			break
+		}
+	}
+	return waveform.Resize(samples), nil
+}